@@ -1,20 +1,30 @@
 package collector
 
 import (
-	"os"
+	"fmt"
+	"time"
 
 	"github.com/ozla/hrtester/internal/collector"
 	"github.com/ozla/hrtester/internal/config"
 	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
 	"github.com/spf13/cobra"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
 var (
+	// delimiter is the --delimiter flag, parsed into config.Collector.Delimiter.
+	delimiter string
+
 	Cmd = &cobra.Command{
 		Use:   "collect",
 		Short: "Run hrtester in collector mode.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			config.Collector.Delimiter, err = parseDelimiter(delimiter)
+			return err
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			service := collector.NewCollectService()
 			if service == nil {
@@ -34,17 +44,80 @@ func init() {
 		&config.Collector.CSVFile,
 		"csv",
 		"",
-		"Path to a CSV file for test results. (required)",
+		"Path to a CSV file for test results; {testName} and {timestamp} give each test run its own file.",
+	)
+	Cmd.Flags().DurationVar(
+		&config.Collector.CSVIdleTimeout,
+		"csv-idle-timeout",
+		time.Minute,
+		"Close the file of a test run once it got no result for this long, with --csv placeholders.",
+	)
+	Cmd.Flags().StringVar(
+		&delimiter,
+		"delimiter",
+		",",
+		"Field delimiter of the CSV files, a single character; 'tab' or '\\t' for tabs.",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Collector.CRLF,
+		"crlf",
+		false,
+		"End the lines of the CSV files with \\r\\n instead of \\n.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Collector.Split,
+		"split",
+		"",
+		"Split results into separate CSV files by 'name' or 'statusClass'.",
+	)
+	Cmd.Flags().StringSliceVar(
+		&config.Collector.Columns,
+		"columns",
+		nil,
+		"Fields of the results to write to the CSV file, in order, with a header row (default all, without header).",
+	)
+	Cmd.Flags().StringVar(
+		&config.Collector.HistogramFile,
+		"histogram",
+		"",
+		"Path to a CSV file for the latency histogram, written on shutdown.",
+	)
+	Cmd.Flags().StringSliceVar(
+		&config.Collector.Buckets,
+		"buckets",
+		collector.DefaultBuckets,
+		"Ascending histogram bucket upper bounds.",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Collector.Metadata,
+		"metadata",
+		false,
+		"Record the start and end of each test run in a JSON Lines file next to the CSV file.",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Collector.ServeResults,
+		"serve-results",
+		false,
+		"Serve the CSV contents at GET /__service/results.",
 	)
 	Cmd.Flags().Uint16Var(
 		&config.Collector.Port,
 		"port",
 		config.DefaultPort,
-		"Port on which hrtester in collector mode will listen.",
+		"Port on which hrtester in collector mode will listen (0 picks a free port).",
 	)
-	if err := Cmd.MarkFlagRequired("csv"); err != nil {
-		os.Exit(1)
+	Cmd.MarkFlagsOneRequired("csv", "histogram")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// parseDelimiter returns the delimiter rune of the --delimiter flag v.
+func parseDelimiter(v string) (rune, error) {
+	r, err := shared.ParseDelimiter(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --delimiter %q: %v", v, err)
 	}
+	return r, nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
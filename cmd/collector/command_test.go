@@ -0,0 +1,16 @@
+package collector
+
+import "testing"
+
+func TestParseDelimiter(t *testing.T) {
+	for in, want := range map[string]rune{",": ',', ";": ';', "|": '|', "tab": '\t', `\t`: '\t', "\t": '\t', "§": '§'} {
+		if got, err := parseDelimiter(in); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+	for _, in := range []string{"", ";;", `"`, "\n", "\r", "\xff"} {
+		if _, err := parseDelimiter(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
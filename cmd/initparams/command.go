@@ -0,0 +1,61 @@
+package initparams
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ozla/hrtester/internal/tester"
+	"github.com/spf13/cobra"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// asJSON writes the params as JSON rather than as commented YAML.
+	asJSON bool
+	// output is the file to write the params to, rather than stdout.
+	output string
+
+	Cmd = &cobra.Command{
+		Use:   "init",
+		Short: "Write starter test params to edit and post to the tester.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := tester.StarterParams(asJSON)
+			if output == "" {
+				_, err := fmt.Fprint(cmd.OutOrStdout(), params)
+				return err
+			}
+			// Existing files are kept, as they may hold edited params.
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := f.WriteString(params); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Cmd.Flags().BoolVar(
+		&asJSON,
+		"json",
+		false,
+		"Write the params as JSON rather than as commented YAML.",
+	)
+	Cmd.Flags().StringVarP(
+		&output,
+		"output",
+		"o",
+		"",
+		"File to write the params to; it must not exist yet. (default stdout)",
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
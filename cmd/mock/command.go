@@ -44,13 +44,19 @@ func init() {
 		&config.Mocker.CAs,
 		"cas",
 		"",
-		"Path to the trusted CA certificate bundle (PEM file).",
+		"Paths to trusted CA certificate bundles (PEM files), comma-separated.",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Mocker.HTTP2,
+		"http2",
+		true,
+		"Negotiate HTTP/2 with clients when TLS is enabled.",
 	)
 	Cmd.Flags().Uint16Var(
 		&config.Mocker.Port,
 		"port",
 		config.DefaultPort,
-		"Port on which hrtester in mock mode will listen.",
+		"Port on which hrtester in mock mode will listen (0 picks a free port).",
 	)
 }
 
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ozla/hrtester/internal/report"
+	"github.com/ozla/hrtester/internal/shared"
+	"github.com/spf13/cobra"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// asJSON prints the stats as JSON rather than as tables.
+	asJSON bool
+	// minPassRate fails the command if the overall pass rate, in percent, is
+	// lower.
+	minPassRate float64
+	// delimiter separates the fields of the files, as the collector's
+	// --delimiter flag.
+	delimiter string
+
+	Cmd = &cobra.Command{
+		Use:   "report <csv file>...",
+		Short: "Print summary stats of collector CSV files.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rp := report.New()
+			var err error
+			if rp.Delimiter, err = shared.ParseDelimiter(delimiter); err != nil {
+				return fmt.Errorf("invalid --delimiter %q: %v", delimiter, err)
+			}
+			for _, fn := range args {
+				f, err := os.Open(fn)
+				if err != nil {
+					return err
+				}
+				err = rp.Read(f)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %v", fn, err)
+				}
+			}
+			if asJSON {
+				if rp.Skipped > 0 {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%d malformed records skipped\n", rp.Skipped)
+				}
+				err = rp.WriteJSON(cmd.OutOrStdout())
+			} else {
+				err = rp.Write(cmd.OutOrStdout())
+			}
+			if err != nil || minPassRate <= 0 {
+				return err
+			}
+			// A missed pass rate is no usage error.
+			cmd.SilenceUsage = true
+			rate, ok := rp.Stats.Overall().PassRate()
+			if !ok {
+				return fmt.Errorf("no record says whether it passed its success criteria")
+			}
+			if rate*100 < minPassRate {
+				return fmt.Errorf("pass rate %.2f%% is below %.2f%%", rate*100, minPassRate)
+			}
+			return nil
+		},
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Cmd.Flags().BoolVar(
+		&asJSON,
+		"json",
+		false,
+		"Print the stats as JSON, with the schema of the tester's stats endpoint.",
+	)
+	Cmd.Flags().Float64Var(
+		&minPassRate,
+		"min-pass-rate",
+		0,
+		"Fail if the overall pass rate, in percent, is lower, e.g. 99.",
+	)
+	Cmd.Flags().StringVar(
+		&delimiter,
+		"delimiter",
+		",",
+		"Field delimiter of the CSV files, as given to the collector; 'tab' or '\\t' for tabs.",
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
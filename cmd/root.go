@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/ozla/hrtester/cmd/collector"
+	"github.com/ozla/hrtester/cmd/initparams"
 	"github.com/ozla/hrtester/cmd/mock"
+	"github.com/ozla/hrtester/cmd/report"
 	"github.com/ozla/hrtester/cmd/tester"
+	"github.com/ozla/hrtester/cmd/version"
+	"github.com/ozla/hrtester/internal/config"
 	"github.com/ozla/hrtester/internal/log"
 	"github.com/spf13/cobra"
 )
@@ -14,6 +20,12 @@ var (
 	rootCmd = &cobra.Command{
 		Use:   "hrtester",
 		Short: "hrtester is an HTTP roundtrip benchmarking tool",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if config.ShutdownTimeout <= 0 {
+				return errors.New("invalid --shutdown-timeout: must be > 0")
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
@@ -27,6 +39,8 @@ func init() {
 	cobra.OnInitialize(log.Init)
 
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.Version = version.String()
+	rootCmd.SetVersionTemplate("{{.Version}}\n")
 	rootCmd.Flags().SortFlags = false
 
 	rootCmd.PersistentFlags().StringVar(
@@ -41,8 +55,21 @@ func init() {
 		false,
 		"Enable debug mode for verbose logging.",
 	)
+	rootCmd.PersistentFlags().BoolVar(
+		&log.Quiet,
+		"quiet",
+		false,
+		"Log warnings and errors only.",
+	)
+	rootCmd.MarkFlagsMutuallyExclusive("debug", "quiet")
+	rootCmd.PersistentFlags().DurationVar(
+		&config.ShutdownTimeout,
+		"shutdown-timeout",
+		config.DefaultShutdownTimeout,
+		"Time to wait for open requests when a service shuts down.",
+	)
 
-	rootCmd.AddCommand(tester.Cmd, collector.Cmd, mock.Cmd)
+	rootCmd.AddCommand(tester.Cmd, collector.Cmd, mock.Cmd, report.Cmd, initparams.Cmd, version.Cmd)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
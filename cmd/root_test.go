@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	defer func() { config.ShutdownTimeout = config.DefaultShutdownTimeout }()
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	for _, v := range []string{"0s", "-1s"} {
+		rootCmd.SetArgs([]string{"--shutdown-timeout", v, "version"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--shutdown-timeout") {
+			t.Errorf("%s: expected an invalid --shutdown-timeout, got %v", v, err)
+		}
+	}
+	rootCmd.SetArgs([]string{"--shutdown-timeout", "2s", "version"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if config.ShutdownTimeout != 2*time.Second {
+		t.Errorf("expected a shutdown timeout of 2s, got %v", config.ShutdownTimeout)
+	}
+}
@@ -1,8 +1,16 @@
 package tester
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/ozla/hrtester/cmd/version"
 	"github.com/ozla/hrtester/internal/config"
 	"github.com/ozla/hrtester/internal/log"
 	"github.com/ozla/hrtester/internal/tester"
@@ -12,9 +20,69 @@ import (
 ////////////////////////////////////////////////////////////////////////////////
 
 var (
+	// stdinBody reads stdin at startup, for requests with the body "@-".
+	stdinBody bool
+
 	Cmd = &cobra.Command{
 		Use:   "test",
 		Short: "Run hrtester in test mode.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			target, scheme, err := normalizeAddr("target", config.Tester.Target)
+			if err != nil {
+				return err
+			}
+			config.Tester.Target, config.Tester.TargetScheme = target, scheme
+			switch config.Tester.Sink {
+			case "collector-http":
+				if len(config.Tester.Collectors) == 0 {
+					return errors.New(`required flag(s) "collector" not set`)
+				}
+			case "statsd-udp":
+				if config.Tester.StatsdAddr == "" {
+					return errors.New("invalid --sink 'statsd-udp': requires --statsd")
+				}
+				if config.Tester.StatsdAddr, err = normalizeStatsdAddr(config.Tester.StatsdAddr); err != nil {
+					return err
+				}
+				if len(config.Tester.Collectors) > 0 {
+					return errors.New("invalid --sink 'statsd-udp': does not go with --collector")
+				}
+			default:
+				return fmt.Errorf("invalid --sink %q: must be 'collector-http' or 'statsd-udp'", config.Tester.Sink)
+			}
+			if config.Tester.CollectorMode != "mirror" && config.Tester.CollectorMode != "failover" {
+				return fmt.Errorf("invalid --collector-mode %q: must be 'mirror' or 'failover'", config.Tester.CollectorMode)
+			}
+			schemeSet := cmd.Flags().Changed("collector-scheme")
+			for i, c := range config.Tester.Collectors {
+				addr, scheme, err := normalizeAddr("collector", c)
+				if err != nil {
+					return err
+				}
+				if err := applyScheme("collector", c, scheme, &config.Tester.CollectorScheme, &schemeSet); err != nil {
+					return err
+				}
+				config.Tester.Collectors[i] = addr
+			}
+			for i := range config.Tester.Collectors {
+				if config.Tester.CollectorPath, err = validateCollectorURL(
+					config.Tester.CollectorScheme,
+					config.Tester.Collectors[i],
+					config.Tester.CollectorPath,
+				); err != nil {
+					return err
+				}
+			}
+			if config.Tester.MaxDuration < 0 {
+				return errors.New("invalid --max-duration: must be >= 0")
+			}
+			if stdinBody {
+				if config.Tester.StdinBody, err = readStdinBody(cmd.InOrStdin()); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			service := tester.NewService()
 			if service == nil {
@@ -34,25 +102,73 @@ func init() {
 		&config.Tester.Target,
 		"target",
 		"",
-		"Target IP and port to benchmark. (required)",
+		"Target IP and port to benchmark; an http:// or https:// prefix sets the reqSchema of the tests. (required)",
 	)
-	Cmd.Flags().StringVar(
-		&config.Tester.Collector,
+	Cmd.Flags().StringSliceVar(
+		&config.Tester.Collectors,
 		"collector",
+		nil,
+		"Collector IP and port; repeat or separate with commas for several collectors. An http:// or https:// prefix sets --collector-scheme. (required with --sink collector-http)",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.CollectorMode,
+		"collector-mode",
+		"mirror",
+		"Delivery to several collectors: 'mirror' sends every result to each, 'failover' to one at a time.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.CollectorScheme,
+		"collector-scheme",
+		"http",
+		"Scheme of the collector, 'http' or 'https'; https uses --cas, --cert and --key.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.CollectorPath,
+		"collector-path",
+		"",
+		"Base path of the collector, e.g. when it sits behind a reverse proxy.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.Instance,
+		"instance",
 		"",
-		"Collector IP and port. (required)",
+		"ID of this tester recorded with each result, to group the results of several testers sharing a collector.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.Sink,
+		"sink",
+		"collector-http",
+		"Where results go: 'collector-http' posts each to the collectors, 'statsd-udp' sends aggregate metrics to --statsd.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.StatsdAddr,
+		"statsd",
+		"",
+		"Statsd host and port the 'statsd-udp' sink sends metrics to, e.g. 127.0.0.1:8125.",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.StatsdPrefix,
+		"statsd-prefix",
+		"hrtester",
+		"Prefix of the statsd metric names.",
 	)
 	Cmd.Flags().StringVar(
 		&config.Tester.CAs,
 		"cas",
 		"",
-		"Path to the trusted CA certificate bundle (PEM file).",
+		"Paths to trusted CA certificate bundles (PEM files), comma-separated.",
 	)
 	Cmd.Flags().BoolVar(
 		&config.Tester.SkipNameCheck,
 		"skip-name-check",
 		false,
-		"Skip target name verification for HTTPS requests",
+		"Skip target name verification for HTTPS requests; the certificate chain is still verified.",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Tester.Insecure,
+		"insecure",
+		false,
+		"Skip all certificate verification for HTTPS requests, e.g. for self-signed dev targets.",
 	)
 	Cmd.Flags().StringVar(
 		&config.Tester.Cert,
@@ -66,18 +182,150 @@ func init() {
 		"",
 		"Path to the tester’s private key (PEM file).",
 	)
+	Cmd.Flags().StringVar(
+		&config.Tester.UserAgent,
+		"user-agent",
+		"hrtester/"+version.Version,
+		"Default User-Agent for test requests.",
+	)
+	Cmd.Flags().DurationVar(
+		&config.Tester.ProgressInterval,
+		"progress-interval",
+		0,
+		"Interval at which to log the progress of a run, e.g. 30s (0 disables it).",
+	)
+	Cmd.Flags().DurationVar(
+		&config.Tester.MaxDuration,
+		"max-duration",
+		0,
+		"Longest duration a run may have; runs without a duration end after it (0 means no cap).",
+	)
+	Cmd.Flags().BoolVar(
+		&config.Tester.Validate,
+		"validate",
+		false,
+		"Send each request once before every run, and refuse to start it if any gets a 404, 405 or 501 (see the preflight params).",
+	)
+	Cmd.Flags().StringVar(
+		&config.Tester.BodySamplesDir,
+		"body-samples-dir",
+		"body-samples",
+		"Directory to save the response bodies sampled by the bodySamples params to.",
+	)
+	Cmd.Flags().BoolVar(
+		&stdinBody,
+		"stdin-body",
+		false,
+		"Read stdin at startup as the body of the request whose body is \"@-\".",
+	)
 	Cmd.Flags().Uint16Var(
 		&config.Tester.Port,
 		"port",
 		config.DefaultPort,
-		"Port on which hrtester in test mode will listen.",
+		"Port on which hrtester in test mode will listen (0 picks a free port).",
 	)
-	if err := Cmd.MarkFlagRequired("collector"); err != nil {
-		os.Exit(1)
-	}
+	Cmd.MarkFlagsMutuallyExclusive("insecure", "skip-name-check")
 	if err := Cmd.MarkFlagRequired("target"); err != nil {
 		os.Exit(1)
 	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+// readStdinBody reads all of r, stdin, as the body to send, which must not be
+// empty.
+func readStdinBody(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stdin: %v", err)
+	}
+	if len(b) == 0 {
+		return nil, errors.New("invalid --stdin-body: stdin is empty")
+	}
+	return b, nil
+}
+
+// normalizeAddr reduces the value of an address flag to host:port, and returns
+// the scheme it was given with, http or https, if any. A trailing slash is
+// stripped.
+func normalizeAddr(flag, v string) (addr, scheme string, err error) {
+	addr = strings.TrimSpace(v)
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid --%s %q: %v", flag, v, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", "", fmt.Errorf("invalid --%s %q: unsupported scheme '%s'", flag, v, u.Scheme)
+		}
+		if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return "", "", fmt.Errorf("invalid --%s %q: must not contain a path or query", flag, v)
+		}
+		addr, scheme = u.Host, u.Scheme
+	} else {
+		addr = strings.TrimSuffix(addr, "/")
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || strings.Contains(host, "/") {
+		return "", "", fmt.Errorf("invalid --%s %q: expected host:port, e.g. 127.0.0.1:8080", flag, v)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", "", fmt.Errorf("invalid --%s %q: port must be between 1 and 65535", flag, v)
+	}
+	return addr, scheme, nil
+}
+
+// applyScheme sets *dst to scheme, the scheme the address v of flag was given
+// with, if any. It fails if *set tells *dst was set to another scheme before.
+func applyScheme(flag, v, scheme string, dst *string, set *bool) error {
+	if scheme == "" {
+		return nil
+	}
+	if *set && *dst != scheme {
+		return fmt.Errorf("invalid --%s %q: scheme '%s' conflicts with '%s'", flag, v, scheme, *dst)
+	}
+	*dst, *set = scheme, true
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// normalizeStatsdAddr checks the --statsd address, host:port without a
+// scheme.
+func normalizeStatsdAddr(v string) (string, error) {
+	addr := strings.TrimSpace(v)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || strings.Contains(host, "/") {
+		return "", fmt.Errorf("invalid --statsd %q: expected host:port, e.g. 127.0.0.1:8125", v)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("invalid --statsd %q: port must be between 1 and 65535", v)
+	}
+	return addr, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// validateCollectorURL checks the collector scheme and base path and returns
+// the base path without a trailing slash.
+func validateCollectorURL(scheme, addr, path string) (string, error) {
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("invalid --collector-scheme %q: must be 'http' or 'https'", scheme)
+	}
+	path = strings.TrimSuffix(strings.TrimSpace(path), "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("invalid --collector-path %q: must start with '/'", path)
+	}
+	raw := scheme + "://" + addr + path
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid collector URL %q: %v", raw, err)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.Path != path {
+		return "", fmt.Errorf("invalid --collector-path %q: must be a plain path", path)
+	}
+	return path, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
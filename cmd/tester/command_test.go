@@ -0,0 +1,107 @@
+package tester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAddr(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		want   string
+		scheme string
+	}{
+		{"127.0.0.1:8080", "127.0.0.1:8080", ""},
+		{"localhost:8080/", "localhost:8080", ""},
+		{"http://localhost:8080", "localhost:8080", "http"},
+		{"https://example.com:443/", "example.com:443", "https"},
+		{" [::1]:8080 ", "[::1]:8080", ""},
+	} {
+		got, scheme, err := normalizeAddr("target", tc.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+		} else if got != tc.want || scheme != tc.scheme {
+			t.Errorf("%q: expected %q over %q, got %q over %q", tc.in, tc.want, tc.scheme, got, scheme)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"localhost",
+		"http://localhost",
+		"ftp://localhost:21",
+		"http://localhost:8080/api",
+		"localhost:8080/api",
+		"localhost:http",
+		"localhost:0",
+		"localhost:70000",
+	} {
+		if _, _, err := normalizeAddr("target", in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestApplyScheme(t *testing.T) {
+	scheme, set := "http", false
+	// The first scheme given replaces the default, and the same one again
+	// goes with it.
+	for _, s := range []string{"", "https", "https"} {
+		if err := applyScheme("collector", "a:1", s, &scheme, &set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if scheme != "https" {
+		t.Errorf("expected https, got %s", scheme)
+	}
+	if err := applyScheme("collector", "a:1", "http", &scheme, &set); err == nil {
+		t.Error("expected a conflicting scheme to fail")
+	}
+
+	// A scheme set explicitly is not overridden.
+	scheme, set = "http", true
+	if err := applyScheme("collector", "a:1", "https", &scheme, &set); err == nil || scheme != "http" {
+		t.Errorf("expected a conflict with the explicit scheme, got %v and %s", err, scheme)
+	}
+}
+
+func TestValidateCollectorURL(t *testing.T) {
+	for _, tc := range []struct {
+		scheme, path string
+		want         string
+	}{
+		{"http", "", ""},
+		{"https", "/", ""},
+		{"https", "/hrtester/", "/hrtester"},
+		{"http", "/a/b", "/a/b"},
+	} {
+		got, err := validateCollectorURL(tc.scheme, "localhost:8080", tc.path)
+		if err != nil {
+			t.Errorf("%s %q: unexpected error: %v", tc.scheme, tc.path, err)
+		} else if got != tc.want {
+			t.Errorf("%s %q: expected %q, got %q", tc.scheme, tc.path, tc.want, got)
+		}
+	}
+
+	for _, tc := range []struct{ scheme, path string }{
+		{"ftp", ""},
+		{"", ""},
+		{"http", "api"},
+		{"http", "/api?x=1"},
+		{"http", "/api#top"},
+	} {
+		if _, err := validateCollectorURL(tc.scheme, "localhost:8080", tc.path); err == nil {
+			t.Errorf("%s %q: expected error", tc.scheme, tc.path)
+		}
+	}
+}
+
+func TestReadStdinBody(t *testing.T) {
+	b, err := readStdinBody(strings.NewReader("payload\n"))
+	if err != nil || string(b) != "payload\n" {
+		t.Errorf("unexpected body %q, %v", b, err)
+	}
+	if _, err := readStdinBody(strings.NewReader("")); err == nil {
+		t.Error("expected error for empty stdin")
+	}
+}
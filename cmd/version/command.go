@@ -0,0 +1,72 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Build information, set at build time via:
+//
+//	-ldflags "-X github.com/ozla/hrtester/cmd/version.Version=... \
+//	          -X github.com/ozla/hrtester/cmd/version.Commit=... \
+//	          -X github.com/ozla/hrtester/cmd/version.Date=..."
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Date    = "dev"
+)
+
+var (
+	Cmd = &cobra.Command{
+		Use:   "version",
+		Short: "Print hrtester version and build information.",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprintln(cmd.OutOrStdout(), String())
+		},
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if Commit == "dev" {
+				Commit = s.Value
+			}
+		case "vcs.time":
+			if Date == "dev" {
+				Date = s.Value
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func String() string {
+	return fmt.Sprintf(
+		"hrtester %s (commit: %s, built: %s, %s %s/%s)",
+		Version,
+		Commit,
+		Date,
+		runtime.Version(),
+		runtime.GOOS,
+		runtime.GOARCH,
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -2,10 +2,14 @@ module github.com/ozla/hrtester
 
 go 1.23.4
 
-require github.com/spf13/cobra v1.8.1
+require (
+	github.com/google/uuid v1.6.0
+	github.com/spf13/cobra v1.8.1
+	golang.org/x/time v0.12.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 )
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// columns selects the fields of the results written to the CSV files, in
+// order. Files with a selection start with a header row naming the fields.
+type columns struct {
+	names []string
+	index []int
+}
+
+// parseColumns checks names against the fields of a result. It returns nil
+// for no names, to write all fields without a header row as before.
+func parseColumns(names []string) (*columns, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	c := &columns{}
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		i, ok := shared.ColumnIndex(n)
+		if !ok {
+			return nil, fmt.Errorf(
+				"unknown column '%s': must be one of %s",
+				n, strings.Join(shared.ColumnNames(), ", "),
+			)
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("duplicate column '%s'", n)
+		}
+		seen[n] = true
+		c.names = append(c.names, n)
+		c.index = append(c.index, i)
+	}
+	return c, nil
+}
+
+// header returns the header row of the files, or nil without a selection.
+func (c *columns) header() []string {
+	if c == nil {
+		return nil
+	}
+	return c.names
+}
+
+// record returns the selected fields of r.
+func (c *columns) record(r shared.TestResult) []string {
+	if c == nil {
+		return r.Slice()
+	}
+	record := make([]string, len(c.index))
+	for i, idx := range c.index {
+		record[i] = r[idx]
+	}
+	return record
+}
+
+////////////////////////////////////////////////////////////////////////////////
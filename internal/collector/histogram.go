@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var DefaultBuckets = []string{
+	"1ms", "2ms", "5ms",
+	"10ms", "20ms", "50ms",
+	"100ms", "200ms", "500ms",
+	"1s", "2s", "5s", "10s",
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// histogram counts round durations per test name. Bucket i counts durations
+// in (bounds[i-1], bounds[i]]; the last bucket counts durations above the
+// highest bound.
+type histogram struct {
+	bounds []time.Duration
+	counts map[string][]uint64
+}
+
+func newHistogram(buckets []string) (*histogram, error) {
+	h := &histogram{
+		bounds: make([]time.Duration, len(buckets)),
+		counts: make(map[string][]uint64),
+	}
+	for i, b := range buckets {
+		d, err := time.ParseDuration(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket '%s': %v", b, err)
+		}
+		if d <= 0 || (i > 0 && d <= h.bounds[i-1]) {
+			return nil, fmt.Errorf("invalid bucket '%s': bounds must be positive and ascending", b)
+		}
+		h.bounds[i] = d
+	}
+	return h, nil
+}
+
+func (h *histogram) observe(r shared.TestResult) error {
+	d, err := r.RoundDuration()
+	if err != nil {
+		return err
+	}
+	counts, ok := h.counts[r.TestName()]
+	if !ok {
+		counts = make([]uint64, len(h.bounds)+1)
+		h.counts[r.TestName()] = counts
+	}
+	i, _ := slices.BinarySearch(h.bounds, d)
+	counts[i]++
+	return nil
+}
+
+// writeFile writes the histogram as CSV rows of test name, bucket upper bound
+// and count.
+func (h *histogram) writeFile(fn string) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	w := newCSVWriter(f)
+
+	names := make([]string, 0, len(h.counts))
+	for name := range h.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Write([]string{"TestName", "LE", "Count"})
+	for _, name := range names {
+		for i, c := range h.counts[name] {
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = h.bounds[i].String()
+			}
+			w.Write([]string{name, le, strconv.FormatUint(c, 10)})
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
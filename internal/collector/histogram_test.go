@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestHistogram(t *testing.T) {
+	h, err := newHistogram([]string{"10ms", "100ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []time.Duration{1, 10, 11, 100, 250} {
+		var r shared.TestResult
+		r.SetTestName("run")
+		r.SetRoundDuration(shared.Duration(ms * time.Millisecond))
+		if err := h.observe(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := h.counts["run"]
+	if counts[0] != 2 || counts[1] != 2 || counts[2] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+
+	if _, err := newHistogram([]string{"100ms", "10ms"}); err == nil {
+		t.Error("expected error for descending bounds")
+	}
+}
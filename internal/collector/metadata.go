@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// metadata appends run events to a JSON Lines sidecar of the CSV file, so
+// that runs accumulated into one CSV file can be told apart.
+type metadata struct {
+	mu sync.Mutex
+	fn string
+}
+
+func newMetadata(csvFile string) *metadata {
+	return &metadata{fn: metadataFileName(csvFile)}
+}
+
+// metadataFileName returns the sidecar of a CSV file, e.g. results.meta.jsonl
+// for results.csv.
+func metadataFileName(csvFile string) string {
+	return strings.TrimSuffix(csvFile, filepath.Ext(csvFile)) + ".meta.jsonl"
+}
+
+// setCSVFile moves the sidecar along with the CSV file.
+func (m *metadata) setCSVFile(csvFile string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fn = metadataFileName(csvFile)
+}
+
+func (m *metadata) write(ev shared.RunEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestMetadataAppendsEvents(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "results.csv")
+	m := newMetadata(csvFile)
+	if want := filepath.Join(filepath.Dir(csvFile), "results.meta.jsonl"); m.fn != want {
+		t.Fatalf("expected sidecar %s, got %s", want, m.fn)
+	}
+
+	for _, ev := range []shared.RunEvent{
+		{Event: shared.RunEventStart, Name: "a", ParamsHash: "abc"},
+		{Event: shared.RunEventEnd, Name: "a", Requests: 10},
+	} {
+		if err := m.write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(m.fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var evs []shared.RunEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var ev shared.RunEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	if len(evs) != 2 || evs[0].ParamsHash != "abc" || evs[1].Requests != 10 {
+		t.Errorf("unexpected events: %+v", evs)
+	}
+}
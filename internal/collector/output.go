@@ -0,0 +1,301 @@
+package collector
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	splitNone        = ""
+	splitName        = "name"
+	splitStatusClass = "statusClass"
+
+	// Placeholders of the CSV file name, filled in when the first result of
+	// a test name arrives.
+	placeholderTestName  = "{testName}"
+	placeholderTimestamp = "{timestamp}"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type output struct {
+	fn string
+	wc io.WriteCloser
+	rw *retryWriter
+	w  *csv.Writer
+	// lastWrite is the time of the last record written, to close the
+	// outputs of templated file names once their run is over.
+	lastWrite time.Time
+}
+
+// openOutput opens fn for appending. A new or empty file starts with header,
+// if any.
+func openOutput(fn string, header []string) (*output, error) {
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o := newOutput(f)
+	o.fn = fn
+	if header == nil {
+		return o, nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		if err := o.write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func newOutput(wc io.WriteCloser) *output {
+	rw := &retryWriter{
+		w:        wc,
+		attempts: WriteAttempts,
+		backoff:  WriteBackoff * time.Millisecond,
+	}
+	return &output{wc: wc, rw: rw, w: newCSVWriter(rw)}
+}
+
+// newCSVWriter returns a CSV writer with the configured delimiter and line
+// terminator.
+func newCSVWriter(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if config.Collector.Delimiter != 0 {
+		cw.Comma = config.Collector.Delimiter
+	}
+	cw.UseCRLF = config.Collector.CRLF
+	return cw
+}
+
+// write buffers the record. Errors of the underlying writer surface here or
+// from flush, after the retries are exhausted; the buffered records are lost
+// then and the output starts over with an empty buffer.
+func (o *output) write(record []string) error {
+	o.lastWrite = time.Now()
+	if err := o.w.Write(record); err != nil {
+		o.w = newCSVWriter(o.rw)
+		return err
+	}
+	return nil
+}
+
+func (o *output) flush() error {
+	o.w.Flush()
+	if err := o.w.Error(); err != nil {
+		o.w = newCSVWriter(o.rw)
+		return err
+	}
+	return nil
+}
+
+func (o *output) close() error {
+	if err := o.flush(); err != nil {
+		o.wc.Close()
+		return err
+	}
+	return o.wc.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// retryWriter retries failed writes, to ride out transient failures such as
+// a briefly full disk.
+type retryWriter struct {
+	w        io.Writer
+	attempts int
+	backoff  time.Duration
+}
+
+func (rw *retryWriter) Write(p []byte) (int, error) {
+	var (
+		written int
+		err     error
+	)
+	for i := range rw.attempts {
+		if i > 0 {
+			time.Sleep(rw.backoff)
+		}
+		var n int
+		n, err = rw.w.Write(p[written:])
+		written += n
+		if err == nil {
+			return written, nil
+		}
+	}
+	return written, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// splitKey returns the key the result is routed by for the configured split
+// mode.
+func splitKey(r shared.TestResult) string {
+	switch config.Collector.Split {
+	case splitName:
+		return sanitizeKey(r.TestName(), "unnamed")
+	case splitStatusClass:
+		if code := r.ResponseCode(); len(code) == 3 {
+			return code[:1] + "xx"
+		}
+		return "nostatus"
+	default:
+		return ""
+	}
+}
+
+func sanitizeKey(s, fallback string) string {
+	s = strings.Map(
+		func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+				r == '-', r == '_', r == '.':
+				return r
+			default:
+				return '_'
+			}
+		},
+		s,
+	)
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// templated reports whether the CSV file name fn has placeholders, in which
+// case each test name gets its own file.
+func templated(fn string) bool {
+	return strings.Contains(fn, placeholderTestName) ||
+		strings.Contains(fn, placeholderTimestamp)
+}
+
+// expandFileName fills in the placeholders of the CSV file name fn.
+func expandFileName(fn, testName string, t time.Time) string {
+	return strings.NewReplacer(
+		placeholderTestName, sanitizeKey(testName, "unnamed"),
+		placeholderTimestamp, t.Format(resetTimeLayout),
+	).Replace(fn)
+}
+
+// outputKey returns the key of the output r is written to: its split key,
+// along with its test name if the CSV file name is templated.
+func (s *service) outputKey(r shared.TestResult) string {
+	key := splitKey(r)
+	if !templated(*s.csvFile.Load()) || config.Collector.Split == splitName {
+		return key
+	}
+	name := sanitizeKey(r.TestName(), "unnamed")
+	if key == "" {
+		return name
+	}
+	return name + "-" + key
+}
+
+// outputFileName derives the CSV file name for r from the current CSV file,
+// with its placeholders filled in and its split key added, e.g. results.csv
+// -> results-2xx.csv.
+func (s *service) outputFileName(r shared.TestResult) string {
+	fn := *s.csvFile.Load()
+	if templated(fn) {
+		fn = expandFileName(fn, r.TestName(), time.Now())
+	}
+	key := splitKey(r)
+	if key == "" {
+		return fn
+	}
+	ext := filepath.Ext(fn)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(fn, ext), key, ext)
+}
+
+// output returns the output of key, opening it for r, its first result, if
+// needed.
+func (s *service) output(key string, r shared.TestResult) (*output, error) {
+	if o, ok := s.outputs[key]; ok {
+		return o, nil
+	}
+	fn := s.outputFileName(r)
+	o, err := openOutput(fn, s.columns.header())
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("opened CSV file", slog.String("file", fn))
+	s.outputs[key] = o
+	return o, nil
+}
+
+func (s *service) flushOutputs() {
+	flushed := len(s.outputs) > 0
+	for _, o := range s.outputs {
+		if err := o.flush(); err != nil {
+			s.writeFailed(o, err)
+			flushed = false
+		}
+	}
+	if flushed {
+		s.writeFailing.Store(false)
+	}
+}
+
+func (s *service) writeFailed(o *output, err error) {
+	s.writeErrors.Add(1)
+	s.writeFailing.Store(true)
+	log.Error(
+		"failed to write CSV file; buffered results are lost",
+		err,
+		slog.String("file", o.fn),
+		slog.Uint64("writeErrors", s.writeErrors.Load()),
+	)
+}
+
+func (s *service) closeOutput(o *output) {
+	if err := o.close(); err != nil {
+		s.writeErrors.Add(1)
+		s.writeFailing.Store(true)
+		log.Error("failed to close CSV file", err, slog.String("file", o.fn))
+	}
+}
+
+func (s *service) closeOutputs() {
+	for _, o := range s.outputs {
+		s.closeOutput(o)
+	}
+	clear(s.outputs)
+}
+
+// closeIdleOutputs closes the outputs of templated file names that got no
+// result for the idle timeout, as their run appears to be over. The next
+// result of their test name starts a new file.
+func (s *service) closeIdleOutputs(now time.Time) {
+	if !templated(*s.csvFile.Load()) || config.Collector.CSVIdleTimeout <= 0 {
+		return
+	}
+	for key, o := range s.outputs {
+		if now.Sub(o.lastWrite) < config.Collector.CSVIdleTimeout {
+			continue
+		}
+		s.closeOutput(o)
+		delete(s.outputs, key)
+		log.Info("closed idle CSV file", slog.String("file", o.fn))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
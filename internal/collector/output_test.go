@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+// flakyWriter fails its first `failures` writes.
+type flakyWriter struct {
+	bytes.Buffer
+	failures int
+	closed   bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, errors.New("disk full")
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *flakyWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestOutputRetriesTransientFailures(t *testing.T) {
+	fw := &flakyWriter{failures: WriteAttempts - 1}
+	o := newOutput(fw)
+	o.rw.backoff = 0
+
+	if err := o.write([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.flush(); err != nil {
+		t.Fatalf("expected transient failures to be retried: %v", err)
+	}
+	if fw.String() != "a,b\n" {
+		t.Errorf("unexpected output: %q", fw.String())
+	}
+}
+
+func TestOutputPersistentFailure(t *testing.T) {
+	fw := &flakyWriter{failures: WriteAttempts}
+	o := newOutput(fw)
+	o.rw.backoff = 0
+
+	if err := o.write([]string{"lost"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.flush(); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+
+	// The output recovers once the writer does.
+	if err := o.write([]string{"kept"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.close(); err != nil {
+		t.Fatal(err)
+	}
+	if fw.String() != "kept\n" || !fw.closed {
+		t.Errorf("unexpected output: %q, closed: %v", fw.String(), fw.closed)
+	}
+}
+
+func TestTemplatedOutputs(t *testing.T) {
+	dir := t.TempDir()
+	defer func(fn string, idle time.Duration) {
+		config.Collector.CSVFile, config.Collector.CSVIdleTimeout = fn, idle
+	}(config.Collector.CSVFile, config.Collector.CSVIdleTimeout)
+	config.Collector.CSVFile = filepath.Join(dir, "results-{testName}-{timestamp}.csv")
+	config.Collector.CSVIdleTimeout = time.Minute
+
+	s := NewCollectService()
+	defer s.closeOutputs()
+	write := func(name string) *output {
+		var r shared.TestResult
+		r.SetTestName(name)
+		o, err := s.output(s.outputKey(r), r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.write(r.Slice()); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	a, b := write("run a"), write("run-b")
+	if write("run a") != a || len(s.outputs) != 2 {
+		t.Fatalf("expected one output per test name, got %d", len(s.outputs))
+	}
+	if base := filepath.Base(a.fn); !strings.HasPrefix(base, "results-run_a-") || strings.Contains(base, "{") {
+		t.Errorf("unexpected file name %s", base)
+	}
+
+	// Only the idle output is closed; its next result starts a new file.
+	b.lastWrite = time.Now().Add(-2 * time.Minute)
+	s.closeIdleOutputs(time.Now())
+	if _, ok := s.outputs["run-b"]; ok || len(s.outputs) != 1 {
+		t.Errorf("expected only the idle output to be closed, got %d outputs", len(s.outputs))
+	}
+	if write("run-b") == b {
+		t.Error("expected a new output after the idle one was closed")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	if _, err := parseColumns([]string{"TestName", "Bogus"}); err == nil {
+		t.Error("expected an unknown column to be rejected")
+	}
+	if _, err := parseColumns([]string{"TestName", "TestName"}); err == nil {
+		t.Error("expected a duplicate column to be rejected")
+	}
+	if c, err := parseColumns(nil); err != nil || c != nil {
+		t.Fatalf("expected all columns by default, got %v, %v", c, err)
+	}
+
+	c, err := parseColumns([]string{"RespCode", "TestName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "results.csv")
+	var r shared.TestResult
+	r.SetTestName("a")
+	r.SetResponseCode(200)
+	// Reopening the file does not repeat the header.
+	for range 2 {
+		o, err := openOutput(fn, c.header())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.write(c.record(r)); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "RespCode,TestName\n200,a\n200,a\n"; string(b) != want {
+		t.Errorf("expected %q, got %q", want, b)
+	}
+}
+
+func TestOutputDelimiter(t *testing.T) {
+	defer func(d rune, crlf bool) {
+		config.Collector.Delimiter, config.Collector.CRLF = d, crlf
+	}(config.Collector.Delimiter, config.Collector.CRLF)
+
+	for _, c := range []struct {
+		delim rune
+		crlf  bool
+		want  string
+	}{
+		{0, false, "a,b c,d;e\n"},
+		{'\t', false, "a\tb c\td;e\n"},
+		{';', true, "a;b c;\"d;e\"\r\n"},
+	} {
+		config.Collector.Delimiter, config.Collector.CRLF = c.delim, c.crlf
+		fw := &flakyWriter{}
+		o := newOutput(fw)
+		if err := o.write([]string{"a", "b c", "d;e"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fw.String(); got != c.want {
+			t.Errorf("delimiter %q: expected %q, got %q", c.delim, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// resetTimeLayout is the timestamp of CSV files started by a reset without an
+// explicit path.
+const resetTimeLayout = "20060102T150405"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// resetRequest asks processResults to close the current CSV files and move on
+// to the file called name. Results arriving meanwhile wait in the buffer, so
+// none are lost.
+type resetRequest struct {
+	name  string
+	reply chan resetResult
+}
+
+type resetResult struct {
+	path string
+	err  error
+}
+
+// timestampedFileName returns the configured CSV file name with t inserted,
+// e.g. results-20250102T100000.csv for results.csv.
+func timestampedFileName(csvFile string, t time.Time) string {
+	ext := filepath.Ext(csvFile)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(csvFile, ext), t.Format(resetTimeLayout), ext)
+}
+
+// reset moves the collector on to the file called name in the directory of the
+// configured CSV file, or to a timestamped one if name is empty. Callers of
+// the reset endpoint are not trusted with other directories.
+func (s *service) reset(name string) resetResult {
+	path := timestampedFileName(config.Collector.CSVFile, time.Now())
+	if name != "" {
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return resetResult{err: fmt.Errorf("invalid path '%s': must be a file name", name)}
+		}
+		path = filepath.Join(filepath.Dir(config.Collector.CSVFile), name)
+	}
+	// Open the new file first, so a bad path leaves the current one in use.
+	var next *output
+	if config.Collector.Split == splitNone && !templated(path) {
+		o, err := openOutput(path, s.columns.header())
+		if err != nil {
+			return resetResult{err: err}
+		}
+		next = o
+	} else if fi, err := os.Stat(filepath.Dir(path)); err != nil || !fi.IsDir() {
+		return resetResult{err: fmt.Errorf("directory of %s does not exist", path)}
+	}
+
+	s.closeOutputs()
+	s.csvFile.Store(&path)
+	if next != nil {
+		s.outputs[""] = next
+	}
+	if s.metadata != nil {
+		s.metadata.setCSVFile(path)
+	}
+	// The stats cover the results of the current file.
+	s.stats.Reset()
+	log.Info("rotated CSV file", slog.String("file", path))
+	return resetResult{path: path}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// handleReset moves the collector on to a new CSV file, named by ?path next to
+// the configured one, or derived from it with a timestamp.
+func (s *service) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+	if config.Collector.CSVFile == "" {
+		shared.HTTPError(
+			w,
+			"No CSV file configured.",
+			http.StatusConflict,
+		)
+		return
+	}
+
+	req := resetRequest{
+		name:  r.URL.Query().Get("path"),
+		reply: make(chan resetResult, 1),
+	}
+	select {
+	case s.resets <- req:
+	case <-s.terminated:
+		shared.HTTPError(
+			w,
+			"Collector is shutting down.",
+			http.StatusServiceUnavailable,
+		)
+		return
+	}
+	res := <-req.reply
+	if res.err != nil {
+		shared.HTTPError(
+			w,
+			fmt.Sprintf("Failed to open CSV file: %v", res.err),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	b, err := json.Marshal(struct {
+		CSV string `json:"csv"`
+	}{res.path})
+	if err != nil {
+		log.Debug("failed to marshal response body", slog.Any("err", err))
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestTimestampedFileName(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	if got := timestampedFileName("out/results.csv", ts); got != "out/results-20250102T100000.csv" {
+		t.Errorf("unexpected file name: %s", got)
+	}
+}
+
+func TestResetMovesToNewFile(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "results.csv")
+	defer func(fn string) { config.Collector.CSVFile = fn }(config.Collector.CSVFile)
+	config.Collector.CSVFile = csvFile
+
+	s := NewCollectService()
+	o, err := openOutput(csvFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.outputs[""] = o
+	s.metadata = newMetadata(csvFile)
+
+	if err := o.write([]string{"old"}); err != nil {
+		t.Fatal(err)
+	}
+	var r shared.TestResult
+	r.SetRoundDuration(shared.Duration(time.Millisecond))
+	s.stats.Add(r)
+	next := filepath.Join(dir, "run2.csv")
+	if res := s.reset("run2.csv"); res.err != nil || res.path != next {
+		t.Fatalf("unexpected reset result: %+v", res)
+	}
+	if n := s.stats.Overall().Count; n != 0 {
+		t.Errorf("expected the stats reset with the file, got %d results", n)
+	}
+	if err := s.outputs[""].write([]string{"new"}); err != nil {
+		t.Fatal(err)
+	}
+	s.closeOutputs()
+
+	for fn, want := range map[string]string{csvFile: "old\n", next: "new\n"} {
+		if b, err := os.ReadFile(fn); err != nil || string(b) != want {
+			t.Errorf("%s: expected %q, got %q (%v)", fn, want, b, err)
+		}
+	}
+	if s.metadata.fn != filepath.Join(dir, "run2.meta.jsonl") {
+		t.Errorf("metadata did not move: %s", s.metadata.fn)
+	}
+
+	for _, name := range []string{"../x.csv", "sub/x.csv", filepath.Join(dir, "x.csv"), ".."} {
+		if res := s.reset(name); res.err == nil {
+			t.Errorf("%s: expected error for a path outside the directory of the CSV file", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.csv")); err == nil {
+		t.Error("expected no file created by a rejected reset")
+	}
+}
@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// snapshotRequest asks processResults, the only writer of the CSV files, to
+// flush the output for key and report its size. The bytes up to that size hold
+// complete records and are never rewritten, so they can be read while
+// processResults keeps appending.
+type snapshotRequest struct {
+	key   string
+	reply chan snapshot
+}
+
+type snapshot struct {
+	fn   string
+	size int64
+	err  error
+}
+
+func (s *service) snapshot(key string) snapshot {
+	o, ok := s.outputs[key]
+	if !ok {
+		return snapshot{err: os.ErrNotExist}
+	}
+	if err := o.flush(); err != nil {
+		s.writeFailed(o, err)
+		return snapshot{err: err}
+	}
+	fi, err := os.Stat(o.fn)
+	if err != nil {
+		return snapshot{err: err}
+	}
+	return snapshot{fn: o.fn, size: fi.Size()}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// handleResults streams the CSV file selected by the split key in ?split,
+// starting at the byte offset in ?since. X-Results-Size holds the offset to
+// pass as since on the next call.
+func (s *service) handleResults(w http.ResponseWriter, r *http.Request) {
+	if !config.Collector.ServeResults {
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusNotFound),
+			http.StatusNotFound,
+		)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			shared.HTTPError(
+				w,
+				"Invalid since: must be a byte offset >= 0",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		since = n
+	}
+
+	req := snapshotRequest{
+		key:   r.URL.Query().Get("split"),
+		reply: make(chan snapshot, 1),
+	}
+	select {
+	case s.snapshots <- req:
+	case <-s.terminated:
+		shared.HTTPError(
+			w,
+			"Collector is shutting down.",
+			http.StatusServiceUnavailable,
+		)
+		return
+	}
+	snap := <-req.reply
+	if snap.err != nil {
+		if os.IsNotExist(snap.err) {
+			shared.HTTPError(
+				w,
+				fmt.Sprintf("No results for split key '%s'", req.key),
+				http.StatusNotFound,
+			)
+			return
+		}
+		log.Error("failed to snapshot CSV file", snap.err)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	if since > snap.size {
+		shared.HTTPError(
+			w,
+			fmt.Sprintf("Invalid since: beyond the end of the results (%d bytes)", snap.size),
+			http.StatusRequestedRangeNotSatisfiable,
+		)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.FormatInt(snap.size-since, 10))
+	w.Header().Set("X-Results-Size", strconv.FormatInt(snap.size, 10))
+	w.WriteHeader(http.StatusOK)
+	if err := copyRange(w, snap.fn, since, snap.size); err != nil {
+		log.Debug("failed to stream CSV file", slog.Any("err", err))
+	}
+}
+
+// copyRange copies the bytes [from, to) of the file fn to w.
+func copyRange(w io.Writer, fn string, from, to int64) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, io.NewSectionReader(f, from, to-from))
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/config"
+)
+
+func TestSnapshotFlushesAndReadsFromOffset(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "results.csv")
+	defer func(fn string) { config.Collector.CSVFile = fn }(config.Collector.CSVFile)
+	config.Collector.CSVFile = csvFile
+
+	s := NewCollectService()
+	o, err := openOutput(csvFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.close()
+	s.outputs[""] = o
+
+	if err := o.write([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	first := s.snapshot("")
+	if first.err != nil || first.size != int64(len("a,b\n")) {
+		t.Fatalf("unexpected snapshot: %+v", first)
+	}
+
+	if err := o.write([]string{"c", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	second := s.snapshot("")
+	var buf bytes.Buffer
+	if err := copyRange(&buf, second.fn, first.size, second.size); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "c,d\n" {
+		t.Errorf("unexpected contents since %d: %q", first.size, buf.String())
+	}
+
+	if snap := s.snapshot("2xx"); !os.IsNotExist(snap.err) {
+		t.Errorf("expected missing split key to fail, got %+v", snap)
+	}
+}
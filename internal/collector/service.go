@@ -1,15 +1,20 @@
 package collector
 
 import (
+	"bufio"
 	"context"
-	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ozla/hrtester/internal/config"
@@ -23,6 +28,8 @@ import (
 const (
 	BufferSize    = 10
 	FlushInterval = 1000
+	WriteAttempts = 3
+	WriteBackoff  = 100
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -30,34 +37,111 @@ const (
 type service struct {
 	server       *http.Server
 	terminated   chan struct{}
+	listening    chan struct{}
+	addr         net.Addr
 	shutdownOnce sync.Once
+	shuttingDown atomic.Bool
+	// writeCtx ends the writing of results once cancelled. Results still
+	// buffered are written; later ones are dropped.
+	writeCtx     context.Context
 	cancelWrite  context.CancelFunc
+	streamCtx    context.Context
+	cancelStream context.CancelFunc
 	results      chan shared.TestResult
-	csv          io.WriteCloser
+	snapshots    chan snapshotRequest
+	outputs      map[string]*output
+	columns      *columns
+	histogram    *histogram
+	metadata     *metadata
+	// csvFile is the current CSV file, which a reset may move.
+	csvFile     atomic.Pointer[string]
+	resets      chan resetRequest
+	sla         *slaStats
+	received    *atomic.Uint64
+	writeErrors *atomic.Uint64
+	// writeFailing is set when the CSV output fails to open or write, and
+	// cleared once all the outputs flush again.
+	writeFailing atomic.Bool
+	// stats aggregates every result received, across testers and runs.
+	stats *shared.Stats
 }
 
 func NewCollectService() *service {
 	s := &service{
-		terminated: make(chan struct{}),
-		results:    make(chan shared.TestResult, BufferSize),
+		terminated:  make(chan struct{}),
+		listening:   make(chan struct{}),
+		results:     make(chan shared.TestResult, BufferSize),
+		snapshots:   make(chan snapshotRequest),
+		resets:      make(chan resetRequest),
+		outputs:     make(map[string]*output),
+		sla:         newSLAStats(),
+		stats:       shared.NewStats(),
+		received:    &atomic.Uint64{},
+		writeErrors: &atomic.Uint64{},
 	}
+	csvFile := config.Collector.CSVFile
+	s.csvFile.Store(&csvFile)
+	s.writeCtx, s.cancelWrite = context.WithCancel(context.Background())
 	return s
 }
 
 func (s *service) Start() {
-	f, err := os.OpenFile(config.Collector.CSVFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if config.Collector.HistogramFile != "" {
+		h, err := newHistogram(config.Collector.Buckets)
+		if err != nil {
+			log.Fatal("invalid histogram buckets", err)
+		}
+		s.histogram = h
+	}
+
+	c, err := parseColumns(config.Collector.Columns)
 	if err != nil {
-		log.Fatal("failed to open CSV file", err)
+		log.Fatal("invalid columns", err)
+	}
+	s.columns = c
+
+	if config.Collector.CSVFile != "" {
+		if templated(filepath.Dir(config.Collector.CSVFile)) {
+			log.Fatal(
+				"CSV file placeholders may only be used in the file name",
+				nil,
+				slog.String("csv", config.Collector.CSVFile),
+			)
+		}
+		switch config.Collector.Split {
+		case splitNone:
+			if templated(config.Collector.CSVFile) {
+				s.checkWritable()
+				break
+			}
+			o, err := openOutput(config.Collector.CSVFile, s.columns.header())
+			if err != nil {
+				log.Fatal("failed to open CSV file", err)
+			}
+			s.outputs[""] = o
+		case splitName, splitStatusClass:
+			s.checkWritable()
+		default:
+			log.Fatal(
+				"invalid split mode: must be 'name' or 'statusClass'",
+				nil,
+				slog.String("split", config.Collector.Split),
+			)
+		}
+	}
+
+	if config.Collector.Metadata {
+		if config.Collector.CSVFile == "" {
+			log.Fatal("metadata requires a CSV file", nil)
+		}
+		if templated(config.Collector.CSVFile) {
+			log.Fatal("metadata requires a CSV file name without placeholders", nil)
+		}
+		s.metadata = newMetadata(config.Collector.CSVFile)
 	}
-	s.csv = f
 
-	ctx, cancel := context.WithCancel(context.Background())
-	s.cancelWrite = cancel
-	go func() {
-		<-ctx.Done()
-		close(s.results)
-	}()
 	go s.processResults()
+	s.streamCtx, s.cancelStream = context.WithCancel(context.Background())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(
@@ -68,6 +152,22 @@ func (s *service) Start() {
 			middleware.DebugHandler,
 		),
 	)
+	mux.HandleFunc(
+		"/stream",
+		middleware.WrapHandlerFuncs(
+			s.handleStream,
+			middleware.DrainAndCloseHandler,
+			middleware.DebugHandler,
+		),
+	)
+	mux.HandleFunc(
+		"/run",
+		middleware.WrapHandlerFuncs(
+			s.handleRun,
+			middleware.DrainAndCloseHandler,
+			middleware.DebugHandler,
+		),
+	)
 	mux.HandleFunc(
 		"/__service/",
 		middleware.WrapHandlerFuncs(
@@ -80,16 +180,20 @@ func (s *service) Start() {
 	if err != nil {
 		log.Fatal("failed to bind server to port", err, slog.Int("port", int(config.Collector.Port)))
 	}
+	s.addr = l.Addr()
+	close(s.listening)
 
 	log.Info(
 		"collector server is listening",
-		slog.Int("port", int(config.Collector.Port)),
+		slog.Int("port", l.Addr().(*net.TCPAddr).Port),
 	)
 
 	s.server = &http.Server{
 		Handler:           mux,
 		ReadHeaderTimeout: time.Minute,
 	}
+	// Open result streams would otherwise hold up the shutdown.
+	s.server.RegisterOnShutdown(s.cancelStream)
 
 	go func() {
 		if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
@@ -97,16 +201,64 @@ func (s *service) Start() {
 		}
 	}()
 
-	<-s.terminated
+	shared.AwaitTermination(s.terminated, s.shutdown)
+}
+
+// Addr returns the address the collector listens on, once bound.
+func (s *service) Addr() net.Addr {
+	<-s.listening
+	return s.addr
+}
+
+// healthy reports whether the service is up and its CSV output is not
+// failing.
+func (s *service) healthy() bool {
+	if s.shuttingDown.Load() {
+		return false
+	}
+	return !s.writeFailing.Load()
+}
+
+// checkWritable marks the CSV output as failing if the files it creates later
+// cannot be written.
+func (s *service) checkWritable() {
+	if fn := *s.csvFile.Load(); !writable(fn) {
+		log.Warn("CSV files cannot be created", slog.String("csv", fn))
+		s.writeFailing.Store(true)
+	}
+}
+
+// writable reports whether the CSV file fn opens for appending, or, while it
+// does not exist, as with placeholders or a split, whether a file can be
+// created next to it.
+func writable(fn string) bool {
+	if !templated(fn) {
+		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND, 0)
+		if err == nil {
+			f.Close()
+			return true
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(fn), ".hrtester-health-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
 }
 
 func (s *service) shutdown() {
 	s.shutdownOnce.Do(
 		func() {
+			s.shuttingDown.Store(true)
 			log.Info("shutting down collector server; hrtester process will terminate")
 
 			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 				defer cancel()
 				if err := s.server.Shutdown(ctx); err != nil {
 					log.Warn("server forced to shut down", slog.Any("err", err))
@@ -123,12 +275,12 @@ func (s *service) handleDefault(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
-			http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+			shared.HTTPError(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
 			return
 		}
 		if err := r.ParseForm(); err != nil {
 			log.Debug("invalid form data", slog.Any("err", err))
-			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			shared.HTTPError(w, "Invalid form data", http.StatusBadRequest)
 			return
 		}
 		select {
@@ -138,7 +290,102 @@ func (s *service) handleDefault(w http.ResponseWriter, r *http.Request) {
 		}
 	default:
 		w.Header().Set("Allow", http.MethodPost)
-		http.Error(
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
+// handleStream consumes a long-lived request whose body carries one
+// URL-encoded result per line.
+func (s *service) handleStream(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		rc := http.NewResponseController(w)
+		stop := context.AfterFunc(s.streamCtx, func() {
+			_ = rc.SetReadDeadline(time.Now())
+		})
+		defer stop()
+
+		n := 0
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			if len(sc.Bytes()) == 0 {
+				continue
+			}
+			vs, err := url.ParseQuery(sc.Text())
+			if err != nil {
+				log.Debug("invalid result record", slog.Any("err", err))
+				continue
+			}
+			select {
+			case s.results <- shared.NewTestResult(vs):
+				n++
+				continue
+			case <-s.writeCtx.Done():
+			}
+			log.Warn(
+				"result stream cut off by the shutdown",
+				slog.String("remoteAddr", r.RemoteAddr),
+				slog.Int("results", n),
+			)
+			shared.HTTPError(w, "Service is shutting down.", http.StatusServiceUnavailable)
+			return
+		}
+		if err := sc.Err(); err != nil {
+			log.Warn("result stream interrupted", slog.Any("err", err))
+		}
+		log.Debug(
+			"result stream closed",
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.Int("results", n),
+		)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodPost)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
+// handleRun records the start or end of a test run if metadata is enabled.
+func (s *service) handleRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var ev shared.RunEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			log.Debug("invalid run event", slog.Any("err", err))
+			shared.HTTPError(w, "Invalid run event", http.StatusBadRequest)
+			return
+		}
+		if ev.Event != shared.RunEventStart && ev.Event != shared.RunEventEnd {
+			shared.HTTPError(
+				w,
+				"Invalid run event: event must be 'start' or 'end'",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		if s.metadata != nil {
+			if err := s.metadata.write(ev); err != nil {
+				log.Error("failed to write run metadata", err)
+				shared.HTTPError(
+					w,
+					http.StatusText(http.StatusInternalServerError),
+					http.StatusInternalServerError,
+				)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodPost)
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusMethodNotAllowed),
 			http.StatusMethodNotAllowed,
@@ -148,13 +395,58 @@ func (s *service) handleDefault(w http.ResponseWriter, r *http.Request) {
 
 func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
+	case "/__service", "/__service/":
+		switch r.Method {
+		case http.MethodGet:
+			body := struct {
+				Status      string              `json:"status"`
+				Received    uint64              `json:"received"`
+				WriteErrors uint64              `json:"writeErrors"`
+				SLA         map[string]slaCount `json:"sla,omitempty"`
+			}{
+				Status:      "running",
+				Received:    s.received.Load(),
+				WriteErrors: s.writeErrors.Load(),
+				SLA:         s.sla.summary(),
+			}
+
+			b, err := json.Marshal(body)
+			if err != nil {
+				log.Debug("failed to marshal response body", slog.Any("err", err))
+				shared.HTTPError(
+					w,
+					http.StatusText(http.StatusInternalServerError),
+					http.StatusInternalServerError,
+				)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(b)
+		default:
+			w.Header().Set("Allow", http.MethodGet)
+			shared.HTTPError(
+				w,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed,
+			)
+			return
+		}
+	case "/__service/stats", "/__service/stats/":
+		s.handleStats(w, r)
+	case "/__service/health", "/__service/health/":
+		shared.HandleHealth(w, r, s.healthy())
+	case "/__service/results", "/__service/results/":
+		s.handleResults(w, r)
+	case "/__service/reset", "/__service/reset/":
+		s.handleReset(w, r)
 	case "/__service/terminate", "/__service/terminate/":
 		switch r.Method {
 		case http.MethodPost:
 			s.shutdown()
 		default:
 			w.Header().Set("Allow", http.MethodPost)
-			http.Error(
+			shared.HTTPError(
 				w,
 				http.StatusText(http.StatusMethodNotAllowed),
 				http.StatusMethodNotAllowed,
@@ -162,7 +454,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	default:
-		http.Error(
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusNotFound),
 			http.StatusNotFound,
@@ -173,30 +465,119 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+func (s *service) writeHistogram() {
+	if s.histogram == nil {
+		return
+	}
+	if err := s.histogram.writeFile(config.Collector.HistogramFile); err != nil {
+		log.Error(
+			"failed to write histogram file",
+			err,
+			slog.String("file", config.Collector.HistogramFile),
+		)
+	}
+}
+
+func (s *service) logSLA() {
+	for endpoint, c := range s.sla.summary() {
+		log.Info(
+			"latency budget summary",
+			slog.String("endpoint", endpoint),
+			slog.Uint64("within", c.Within),
+			slog.Uint64("total", c.Total),
+			slog.Float64("percentage", c.Percentage),
+		)
+	}
+}
+
+// handleStats returns the stats of the results received so far. The stats are
+// locked against processResults, which adds to them.
+func (s *service) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+	b, err := json.Marshal(s.stats)
+	if err != nil {
+		log.Debug("failed to marshal response body", slog.Any("err", err))
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
 func (s *service) processResults() {
 	defer close(s.terminated)
 
-	w := csv.NewWriter(s.csv)
 	ticker := time.NewTicker(FlushInterval * time.Millisecond)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case r, ok := <-s.results:
-			if !ok {
-				w.Flush()
-				if err := s.csv.Close(); err != nil {
-					log.Error("failed to close CSV file", err)
+		case r := <-s.results:
+			s.processResult(r)
+		case <-s.writeCtx.Done():
+			// The results channel is never closed, as handlers may still
+			// send on it; those buffered so far are written.
+			for drained := false; !drained; {
+				select {
+				case r := <-s.results:
+					s.processResult(r)
+				default:
+					drained = true
 				}
-				return
-			}
-			if err := w.Write(r.Slice()); err != nil {
-				log.Error("failed to write result", err)
 			}
-		case <-ticker.C:
-			w.Flush()
+			s.closeOutputs()
+			s.writeHistogram()
+			s.logSLA()
+			return
+		case req := <-s.snapshots:
+			req.reply <- s.snapshot(req.key)
+		case req := <-s.resets:
+			req.reply <- s.reset(req.name)
+		case now := <-ticker.C:
+			s.flushOutputs()
+			s.closeIdleOutputs(now)
+		}
+	}
+}
+
+// processResult adds r to the stats and writes it to its output.
+func (s *service) processResult(r shared.TestResult) {
+	s.received.Add(1)
+	s.sla.observe(r)
+	if err := s.stats.Add(r); err != nil {
+		log.Debug("result left out of the stats", slog.Any("err", err))
+	}
+	if s.histogram != nil {
+		if err := s.histogram.observe(r); err != nil {
+			log.Debug("invalid round duration", slog.Any("err", err))
 		}
 	}
+	if config.Collector.CSVFile == "" {
+		return
+	}
+	o, err := s.output(s.outputKey(r), r)
+	if err != nil {
+		s.writeErrors.Add(1)
+		s.writeFailing.Store(true)
+		log.Error("failed to open CSV file", err)
+		return
+	}
+	if err := o.write(s.columns.record(r)); err != nil {
+		s.writeFailed(o, err)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	defer func(d time.Duration) { config.ShutdownTimeout = d }(config.ShutdownTimeout)
+	config.ShutdownTimeout = 100 * time.Millisecond
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	go http.Get(srv.URL)
+	<-entered
+
+	// The writer is stopped once the open request is given up on.
+	stopped := make(chan struct{})
+	s := &service{server: srv.Config, cancelWrite: func() { close(stopped) }}
+	start := time.Now()
+	s.shutdown()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the collector to stop writing")
+	}
+	if d := time.Since(start); d < config.ShutdownTimeout {
+		t.Errorf("expected the collector to wait %v for the open request, stopped after %v", config.ShutdownTimeout, d)
+	}
+}
+
+func TestHealthyWritesCSV(t *testing.T) {
+	defer func(fn string) { config.Collector.CSVFile = fn }(config.Collector.CSVFile)
+	dir := t.TempDir()
+	healthy := func(fn string) bool {
+		config.Collector.CSVFile = fn
+		s := NewCollectService()
+		s.checkWritable()
+		return s.healthy()
+	}
+
+	csvFile := filepath.Join(dir, "results.csv")
+	if err := os.WriteFile(csvFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !healthy(csvFile) {
+		t.Error("expected an existing CSV file to be writable")
+	}
+	// Split and per-run files are created later, next to the CSV file.
+	if !healthy(filepath.Join(dir, "results-{testName}.csv")) {
+		t.Error("expected files to be creatable in the CSV directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the health check to leave no files, got %d entries", len(entries))
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if healthy(sub) {
+		t.Error("expected a directory in place of the CSV file to be unhealthy")
+	}
+	if healthy(filepath.Join(dir, "gone", "results.csv")) {
+		t.Error("expected a missing CSV directory to be unhealthy")
+	}
+
+	// Past the startup check, the outcome of the last write counts.
+	config.Collector.CSVFile = csvFile
+	s := NewCollectService()
+	s.writeFailed(&output{fn: csvFile}, errors.New("disk full"))
+	if s.healthy() {
+		t.Error("expected a failed write to be unhealthy")
+	}
+	s.processResult(shared.TestResult{})
+	s.flushOutputs()
+	s.closeOutputs()
+	if !s.healthy() {
+		t.Error("expected a flushed output to be healthy again")
+	}
+}
+
+func TestStream(t *testing.T) {
+	defer func(fn string) { config.Collector.CSVFile = fn }(config.Collector.CSVFile)
+	config.Collector.CSVFile = ""
+
+	s := NewCollectService()
+	s.streamCtx = context.Background()
+	go s.processResults()
+	body := "testName=a&respCode=200\n\n%zz\ntestName=a&respCode=503\n"
+	w := httptest.NewRecorder()
+	s.handleStream(w, httptest.NewRequest(http.MethodPost, "/stream", strings.NewReader(body)))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+	s.cancelWrite()
+	<-s.terminated
+	// Empty and invalid lines are skipped.
+	if n := s.received.Load(); n != 2 {
+		t.Errorf("expected 2 results received, got %d", n)
+	}
+}
+
+func TestStreamShutdown(t *testing.T) {
+	s := NewCollectService()
+	s.streamCtx = context.Background()
+	// Nothing takes the results, as when writing is held up.
+	s.results = make(chan shared.TestResult)
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		s.handleStream(w, httptest.NewRequest(http.MethodPost, "/stream", strings.NewReader("testName=a\n")))
+		done <- w.Code
+	}()
+	s.cancelWrite()
+	select {
+	case code := <-done:
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("expected the stream cut off, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stream handler to return once writing stopped")
+	}
+	// Single results are dropped rather than sent on.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("testName=a"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.handleDefault(w, r)
+}
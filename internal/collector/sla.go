@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"math"
+	"sync"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type slaCount struct {
+	Within     uint64  `json:"within"`
+	Total      uint64  `json:"total"`
+	Percentage float64 `json:"percentage"`
+}
+
+// slaStats counts results within their latency budget per endpoint, i.e.
+// method and path. Results without a budget are ignored.
+type slaStats struct {
+	mu     sync.Mutex
+	counts map[string]*slaCount
+}
+
+func newSLAStats() *slaStats {
+	return &slaStats{counts: make(map[string]*slaCount)}
+}
+
+func (st *slaStats) observe(r shared.TestResult) {
+	met, ok := r.SLAMet()
+	if !ok {
+		return
+	}
+	key := r.RequestMethod() + " " + r.RequestPath()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, ok := st.counts[key]
+	if !ok {
+		c = &slaCount{}
+		st.counts[key] = c
+	}
+	c.Total++
+	if met {
+		c.Within++
+	}
+}
+
+// summary returns the counts per endpoint along with the percentage of
+// results within budget, rounded to two decimals.
+func (st *slaStats) summary() map[string]slaCount {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	m := make(map[string]slaCount, len(st.counts))
+	for k, c := range st.counts {
+		sc := *c
+		sc.Percentage = math.Round(float64(c.Within)*10000/float64(c.Total)) / 100
+		m[k] = sc
+	}
+	return m
+}
+
+////////////////////////////////////////////////////////////////////////////////
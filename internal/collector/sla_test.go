@@ -0,0 +1,25 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestSLAStats(t *testing.T) {
+	st := newSLAStats()
+	for _, met := range []string{"true", "true", "false", ""} {
+		var r shared.TestResult
+		r.SetRequesMethod("GET")
+		r.SetRequestPath("/a")
+		if met != "" {
+			r.SetSLAMet(met == "true")
+		}
+		st.observe(r)
+	}
+
+	c := st.summary()["GET /a"]
+	if c.Within != 2 || c.Total != 3 || c.Percentage != 66.67 {
+		t.Errorf("unexpected counts: %+v", c)
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestLiveStats(t *testing.T) {
+	defer func(fn string) { config.Collector.CSVFile = fn }(config.Collector.CSVFile)
+	config.Collector.CSVFile = ""
+
+	s := NewCollectService()
+	go s.processResults()
+	for i, code := range []int{200, 200, 503} {
+		var r shared.TestResult
+		r.SetTestName("a")
+		r.SetRequestPath("/x")
+		r.SetResponseCode(code)
+		r.SetRoundDuration(shared.Duration(time.Duration(i+1) * 10 * time.Millisecond))
+		s.results <- r
+	}
+
+	// The stats catch up with the results as processResults takes them.
+	var body struct {
+		Overall struct {
+			Count       uint64            `json:"count"`
+			StatusCodes map[string]uint64 `json:"statusCodes"`
+			Latency     struct {
+				P50 string `json:"p50"`
+			} `json:"latency"`
+		} `json:"overall"`
+		Names map[string]json.RawMessage `json:"names"`
+	}
+	deadline := time.Now().Add(time.Second)
+	for body.Overall.Count < 3 && time.Now().Before(deadline) {
+		rec := httptest.NewRecorder()
+		s.handleService(rec, httptest.NewRequest(http.MethodGet, "/__service/stats", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.cancelWrite()
+	<-s.terminated
+
+	if body.Overall.Count != 3 || body.Overall.StatusCodes["503"] != 1 || body.Overall.Latency.P50 != "20ms" {
+		t.Errorf("unexpected stats %+v", body.Overall)
+	}
+	if _, ok := body.Names["a"]; !ok {
+		t.Errorf("expected stats of test name a, got %v", body.Names)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleService(rec, httptest.NewRequest(http.MethodPost, "/__service/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
@@ -1,34 +1,94 @@
 package config
 
+import "time"
+
 ////////////////////////////////////////////////////////////////////////////////
 
 const (
-	DefaultPort = 51250
+	DefaultPort            = 51250
+	DefaultShutdownTimeout = 30 * time.Second
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
 var (
+	// ShutdownTimeout bounds how long a service waits for its open requests
+	// when shutting down.
+	ShutdownTimeout = DefaultShutdownTimeout
+
 	Tester = struct {
-		Collector     string
+		// Collectors get the results as CollectorMode says: "mirror" sends
+		// every result to each of them, "failover" to one at a time.
+		Collectors    []string
+		CollectorMode string
 		Target        string
+		// TargetScheme is the scheme --target was given with, if any, which
+		// the test params use unless they set reqSchema.
+		TargetScheme  string
 		CAs           string
 		Cert          string
 		Key           string
 		SkipNameCheck bool
-		Port          uint16
+		Insecure      bool
+		UserAgent     string
+		// CollectorScheme and CollectorPath let the collector sit behind a
+		// TLS-terminating reverse proxy on a subpath.
+		CollectorScheme string
+		CollectorPath   string
+		// Sink is where results go: "collector-http" to the collectors,
+		// "statsd-udp" as statsd metrics to StatsdAddr, named below
+		// StatsdPrefix.
+		Sink         string
+		StatsdAddr   string
+		StatsdPrefix string
+		// ProgressInterval is the interval of the progress log during a run;
+		// 0 disables it.
+		ProgressInterval time.Duration
+		// MaxDuration caps the duration of runs, and ends runs without a
+		// duration after it; 0 means no cap.
+		MaxDuration time.Duration
+		// BodySamplesDir is the directory sampled response bodies are saved
+		// to, in a subdirectory per run.
+		BodySamplesDir string
+		// StdinBody is the body read from stdin at startup, which request
+		// bodies reference as "@-"; nil unless asked for.
+		StdinBody []byte
+		// Instance identifies this tester in its results, to tell apart
+		// several testers sharing a collector; empty by default.
+		Instance string
+		// Validate runs the preflight check of the params before every run,
+		// even if the params do not ask for it.
+		Validate bool
+		Port     uint16
 	}{}
 
 	Collector = struct {
 		CSVFile string
-		Port    uint16
+		// Columns are the fields of the results written to the CSV file,
+		// in order; all of them if empty.
+		Columns []string
+		// CSVIdleTimeout closes the files of a CSV file name with
+		// placeholders once they got no result for that long.
+		CSVIdleTimeout time.Duration
+		Split          string
+		HistogramFile  string
+		Buckets        []string
+		Metadata       bool
+		ServeResults   bool
+		Port           uint16
+
+		// Delimiter separates the fields of the CSV files, and CRLF ends
+		// their lines with \r\n instead of \n.
+		Delimiter rune
+		CRLF      bool
 	}{}
 
 	Mocker = struct {
-		CAs  string
-		Cert string
-		Key  string
-		Port uint16
+		CAs   string
+		Cert  string
+		Key   string
+		HTTP2 bool
+		Port  uint16
 	}{}
 )
 
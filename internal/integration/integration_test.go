@@ -0,0 +1,181 @@
+package integration
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/collector"
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/mock"
+	"github.com/ozla/hrtester/internal/shared"
+	"github.com/ozla/hrtester/internal/tester"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func post(t *testing.T, u, body string) {
+	t.Helper()
+	resp, err := http.Post(u, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: unexpected status %s", u, resp.Status)
+	}
+}
+
+func status(t *testing.T, addr net.Addr) string {
+	t.Helper()
+	resp, err := http.Get("http://" + addr.String() + "/__service/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Status
+}
+
+func healthy(t *testing.T, addr net.Addr) bool {
+	t.Helper()
+	resp, err := http.Get("http://" + addr.String() + "/__service/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func terminate(t *testing.T, addr net.Addr, done <-chan struct{}) {
+	t.Helper()
+	resp, err := http.Post("http://"+addr.String()+"/__service/terminate", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("service on %s did not terminate", addr)
+	}
+}
+
+func start(svc interface{ Start() }) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.Start()
+	}()
+	return done
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestRoundtrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	csvFile := filepath.Join(t.TempDir(), "results.csv")
+
+	config.Mocker.Port = 0
+	config.Collector.Port = 0
+	config.Collector.CSVFile = csvFile
+	config.Tester.Port = 0
+
+	mockSvc := mock.NewService()
+	mockDone := start(mockSvc)
+	collectorSvc := collector.NewCollectService()
+	collectorDone := start(collectorSvc)
+
+	// The tester needs the addresses of the mock and the collector.
+	mockAddr, collectorAddr := mockSvc.Addr(), collectorSvc.Addr()
+	config.Tester.Target = mockAddr.String()
+	config.Tester.Collectors = []string{collectorAddr.String()}
+	testerSvc := tester.NewService()
+	testerDone := start(testerSvc)
+	testerAddr := testerSvc.Addr()
+	for _, addr := range []net.Addr{mockAddr, collectorAddr, testerAddr} {
+		if !healthy(t, addr) {
+			t.Fatalf("service on %s is not healthy", addr)
+		}
+	}
+
+	post(
+		t,
+		"http://"+mockAddr.String()+"/__mock",
+		`{"duration": "1m", "response": {"duration": {"min": "5ms", "max": "10ms"}}}`,
+	)
+	post(
+		t,
+		"http://"+testerAddr.String()+"/test",
+		`{
+			"name": "integration",
+			"duration": "1s",
+			"pace": "20rps",
+			"parallelTesters": 2,
+			"timeout": "500ms",
+			"choice": "roundrobin",
+			"requests": [{"method": "GET", "path": "/1"}, {"method": "GET", "path": "/2"}]
+		}`,
+	)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status(t, testerAddr) != "ready" {
+		if time.Now().After(deadline) {
+			t.Fatal("test run did not finish")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	terminate(t, testerAddr, testerDone)
+	terminate(t, collectorAddr, collectorDone)
+	terminate(t, mockAddr, mockDone)
+
+	f, err := os.Open(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rd := csv.NewReader(f)
+	rd.FieldsPerRecord = -1
+	records, err := rd.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 requests per second for one second, less the tester spinup.
+	if n := len(records); n < 10 || n > 25 {
+		t.Errorf("unexpected number of results: %d", n)
+	}
+	for _, rec := range records {
+		r, err := shared.ParseTestResult(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.TestName() != "integration" {
+			t.Errorf("unexpected test name: %v", rec)
+		}
+		if r.ResponseCode() != "200" {
+			t.Errorf("unexpected response code: %v", rec)
+		}
+		d, err := r.RoundDuration()
+		if err != nil || d < 5*time.Millisecond || d > 500*time.Millisecond {
+			t.Errorf("implausible round duration: %v", rec)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
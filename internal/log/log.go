@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"time"
 )
 
@@ -15,6 +16,8 @@ import (
 var (
 	FileName  string
 	Debugging bool
+	// Quiet logs warnings and errors only.
+	Quiet bool
 
 	logger *slog.Logger = slog.Default()
 )
@@ -38,9 +41,12 @@ func Init() {
 	} else {
 		w = os.Stderr
 	}
-	if Debugging {
+	switch {
+	case Debugging:
 		lv.Set(slog.LevelDebug)
-	} else {
+	case Quiet:
+		lv.Set(slog.LevelWarn)
+	default:
 		lv.Set(slog.LevelInfo)
 	}
 
@@ -68,10 +74,15 @@ func Init() {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// Enabled reports whether records of level are logged. Hot paths check it
+// before building their attributes.
+func Enabled(level slog.Level) bool {
+	return slog.Default().Enabled(context.Background(), level)
+}
+
 func logAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
 	ctx := context.Background()
-	l := slog.Default()
-	if !l.Enabled(ctx, level) {
+	if !Enabled(level) {
 		return
 	}
 	r := slog.NewRecord(time.Now(), level, msg, sourcePC())
@@ -83,7 +94,7 @@ func logAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
 
 func sourcePC() uintptr {
 	var pcs [1]uintptr
-	// skip: Callers, sourcePC, logAttrs, Debug|Info|Error|Fatal
+	// skip: Callers, sourcePC, logAttrs, Debug|Info|Error|Fatal or a Logger method
 	runtime.Callers(4, pcs[:])
 	return pcs[0]
 }
@@ -132,3 +143,48 @@ func Fatal(msg string, err error, attrs ...slog.Attr) {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+// Logger logs like the package functions, adding its bound attributes to every
+// record.
+type Logger struct {
+	attrs []slog.Attr
+}
+
+// With returns a Logger bound to attrs.
+func With(attrs ...slog.Attr) *Logger {
+	return &Logger{attrs: attrs}
+}
+
+func (l *Logger) Debug(msg string, attrs ...slog.Attr) {
+	if !Enabled(slog.LevelDebug) {
+		return
+	}
+	logAttrs(slog.LevelDebug, msg, slices.Concat(l.attrs, attrs)...)
+}
+
+func (l *Logger) Info(msg string, attrs ...slog.Attr) {
+	if !Enabled(slog.LevelInfo) {
+		return
+	}
+	logAttrs(slog.LevelInfo, msg, slices.Concat(l.attrs, attrs)...)
+}
+
+func (l *Logger) Warn(msg string, attrs ...slog.Attr) {
+	if !Enabled(slog.LevelWarn) {
+		return
+	}
+	logAttrs(slog.LevelWarn, msg, slices.Concat(l.attrs, attrs)...)
+}
+
+func (l *Logger) Error(msg string, err error, attrs ...slog.Attr) {
+	if !Enabled(slog.LevelError) {
+		return
+	}
+	attrsE := slices.Clone(l.attrs)
+	if err != nil {
+		attrsE = append(attrsE, slog.Any("error", err))
+	}
+	logAttrs(slog.LevelError, msg, append(attrsE, attrs...)...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,73 @@
+package mock
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// maxBodySize bounds the sampled body sizes.
+const maxBodySize = 1 << 30
+
+////////////////////////////////////////////////////////////////////////////////
+
+// sizeRange is a range of response body sizes in bytes.
+type sizeRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+func (sr sizeRange) validate() error {
+	if sr.Min < 0 || sr.Min > sr.Max || sr.Max > maxBodySize {
+		return fmt.Errorf("min must be >= 0 and <= max, max <= %d", maxBodySize)
+	}
+	return nil
+}
+
+// sample returns a random size in [Min, Max] drawn from rng.
+func (sr sizeRange) sample(rng *lockedRand) int64 {
+	return sr.Min + rng.Int64N(sr.Max-sr.Min+1)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// bodySize returns the size of the next response body, or -1 for the default
+// body.
+func (r response) bodySize(rng *lockedRand) int64 {
+	if r.BodySize == nil {
+		return -1
+	}
+	return r.BodySize.sample(rng)
+}
+
+// writeBody writes a body of n filler bytes, or the default body for n < 0.
+// The Content-Length of sized bodies must be set along with the headers.
+func writeBody(w io.Writer, n int64) {
+	if n < 0 {
+		w.Write([]byte("\n"))
+		return
+	}
+	for n > 0 {
+		k := min(n, int64(len(shared.FillPattern)))
+		if _, err := w.Write(shared.FillPattern[:k]); err != nil {
+			return
+		}
+		n -= k
+	}
+}
+
+// setContentLength sets the Content-Length of a sized body of n bytes, unless
+// the status of the response allows no body.
+func setContentLength(h http.Header, n int64, status int) {
+	noBody := status < 200 || status == http.StatusNoContent || status == http.StatusNotModified
+	if n >= 0 && !noBody {
+		h.Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
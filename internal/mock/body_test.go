@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodySize(t *testing.T) {
+	var r response
+	if err := json.Unmarshal([]byte(`{"bodySize": {"min": 1000, "max": 70000}}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	rng := newLockedRand(1)
+	sizes := make(map[int64]bool)
+	for range 100 {
+		n := r.bodySize(rng)
+		if n < 1000 || n > 70000 {
+			t.Fatalf("size %d out of range", n)
+		}
+		sizes[n] = true
+
+		w := httptest.NewRecorder()
+		setContentLength(w.Header(), n, http.StatusOK)
+		writeBody(w, n)
+		if int64(w.Body.Len()) != n || w.Header().Get("Content-Length") == "" {
+			t.Fatalf("expected a body of %d bytes, got %d, headers %v", n, w.Body.Len(), w.Header())
+		}
+	}
+	if len(sizes) < 50 {
+		t.Errorf("expected varying sizes, got %d distinct", len(sizes))
+	}
+
+	if n := (response{}).bodySize(rng); n != -1 {
+		t.Errorf("expected the default body without bodySize, got %d", n)
+	}
+	w := httptest.NewRecorder()
+	writeBody(w, -1)
+	if w.Body.String() != "\n" {
+		t.Errorf("unexpected default body %q", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	setContentLength(w.Header(), 10, http.StatusNoContent)
+	if w.Header().Get("Content-Length") != "" {
+		t.Error("expected no Content-Length for a 204")
+	}
+
+	for _, raw := range []string{
+		`{"bodySize": {"min": 10, "max": 5}}`,
+		`{"bodySize": {"min": -1, "max": 5}}`,
+		`{"bodySize": {"min": 0, "max": 2000000000}}`,
+		`{"bodySize": {"min": 1, "max": 5}, "headers": {"content-length": "3"}}`,
+	} {
+		var r response
+		if err := json.Unmarshal([]byte(raw), &r); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.validate(); err == nil || !strings.Contains(err.Error(), "bodySize") {
+			t.Errorf("expected bodySize error for %s, got %v", raw, err)
+		}
+	}
+}
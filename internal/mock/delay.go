@@ -0,0 +1,117 @@
+package mock
+
+import (
+	"fmt"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// response sets the delays of mock responses in one of three ways:
+//
+//   - HeaderLatency and Duration: Duration is the total response time, of
+//     which the headers take HeaderLatency. A header delay longer than the
+//     total delays the headers only and sends the body right after them.
+//   - Duration and TTFB: the headers take the TTFB fraction of the total
+//     response time, which correlates both delays.
+//   - HeaderLatency and BodyLatency: the body follows the headers after its
+//     own, independent delay.
+type response struct {
+	HeaderLatency latency        `json:"headerLatency"`
+	Duration      latency        `json:"duration"`
+	TTFB          *fractionRange `json:"ttfb"`
+	BodyLatency   *latency       `json:"bodyLatency"`
+	Ramp          *ramp          `json:"ramp"`
+	// Statuses weights the response statuses; all responses are 200 when
+	// unset.
+	Statuses []weightedStatus `json:"statuses"`
+	// ContentType replaces the default text/plain content type, and Headers
+	// are added to every response.
+	ContentType string `json:"contentType"`
+	Headers     header `json:"headers"`
+	// BodySize samples the size of each response body, filled with filler
+	// bytes; the body is a line break when unset.
+	BodySize *sizeRange `json:"bodySize"`
+}
+
+func (r response) validate() error {
+	if r.TTFB != nil {
+		if !r.TTFB.valid() {
+			return fmt.Errorf("ttfb: min must be >= 0 and <= max, max <= 1")
+		}
+		if r.HeaderLatency != (latency{}) || r.BodyLatency != nil {
+			return fmt.Errorf("ttfb excludes headerLatency and bodyLatency")
+		}
+		if r.Ramp != nil && r.Ramp.HeaderLatency != (latency{}) {
+			return fmt.Errorf("ttfb excludes a ramp of headerLatency")
+		}
+	}
+	if r.ContentType != "" && r.Headers != nil {
+		if _, ok := r.Headers["Content-Type"]; ok {
+			return fmt.Errorf("contentType conflicts with a Content-Type header")
+		}
+	}
+	if r.BodySize != nil {
+		if err := r.BodySize.validate(); err != nil {
+			return fmt.Errorf("bodySize: %v", err)
+		}
+		if _, ok := r.Headers["Content-Length"]; ok {
+			return fmt.Errorf("bodySize conflicts with a Content-Length header")
+		}
+	}
+	if r.BodyLatency != nil {
+		if !r.BodyLatency.valid() {
+			return fmt.Errorf("bodyLatency: min must be >= 0 and <= max")
+		}
+		if r.Duration != (latency{}) {
+			return fmt.Errorf("bodyLatency excludes duration")
+		}
+		if r.Ramp != nil {
+			return fmt.Errorf("bodyLatency excludes a ramp")
+		}
+	}
+	return nil
+}
+
+// delays samples the delay before the headers and the delay between the
+// headers and the body, given the header latency and total duration ranges
+// for the current point of the run.
+func (r response) delays(head, total latency, rng *lockedRand) (time.Duration, time.Duration) {
+	switch {
+	case r.BodyLatency != nil:
+		return head.sample(rng), r.BodyLatency.sample(rng)
+	case r.TTFB != nil:
+		t := total.sample(rng)
+		h := time.Duration(float64(t) * r.TTFB.sample(rng))
+		return h, t - h
+	default:
+		h, t := head.sample(rng), total.sample(rng)
+		return h, max(t-h, 0)
+	}
+}
+
+// splitsHeaders reports whether the headers are sent ahead of the body. Without
+// a header delay, the headers go out along with the body, as clients timing
+// the headers only would otherwise see no delay at all.
+func (r response) splitsHeaders(headDelay time.Duration) bool {
+	return headDelay > 0 || r.TTFB != nil || r.BodyLatency != nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fractionRange is a range of fractions of the total response time.
+type fractionRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (f fractionRange) valid() bool {
+	return f.Min >= 0 && f.Min <= f.Max && f.Max <= 1
+}
+
+// sample returns a random fraction in [Min, Max].
+func (f fractionRange) sample(rng *lockedRand) float64 {
+	return f.Min + (f.Max-f.Min)*rng.Float64()
+}
+
+////////////////////////////////////////////////////////////////////////////////
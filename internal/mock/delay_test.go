@@ -0,0 +1,151 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func fixed(d time.Duration) latency {
+	return latency{Min: shared.Duration(d), Max: shared.Duration(d)}
+}
+
+func TestResponseDelays(t *testing.T) {
+	rng := newLockedRand(1)
+	for _, tc := range []struct {
+		name       string
+		r          response
+		head, body time.Duration
+	}{
+		{
+			name: "total",
+			r:    response{HeaderLatency: fixed(20 * time.Millisecond), Duration: fixed(50 * time.Millisecond)},
+			head: 20 * time.Millisecond,
+			body: 30 * time.Millisecond,
+		},
+		{
+			// The header delay is kept; the body follows the headers at once.
+			name: "header exceeds total",
+			r:    response{HeaderLatency: fixed(80 * time.Millisecond), Duration: fixed(50 * time.Millisecond)},
+			head: 80 * time.Millisecond,
+			body: 0,
+		},
+		{
+			name: "ttfb",
+			r:    response{Duration: fixed(100 * time.Millisecond), TTFB: &fractionRange{Min: 0.25, Max: 0.25}},
+			head: 25 * time.Millisecond,
+			body: 75 * time.Millisecond,
+		},
+		{
+			name: "additive",
+			r: response{
+				HeaderLatency: fixed(80 * time.Millisecond),
+				BodyLatency:   &latency{Min: shared.Duration(50 * time.Millisecond), Max: shared.Duration(50 * time.Millisecond)},
+			},
+			head: 80 * time.Millisecond,
+			body: 50 * time.Millisecond,
+		},
+	} {
+		if err := tc.r.validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		head, body := tc.r.delays(tc.r.HeaderLatency, tc.r.Duration, rng)
+		if head != tc.head || body != tc.body {
+			t.Errorf("%s: expected %v/%v, got %v/%v", tc.name, tc.head, tc.body, head, body)
+		}
+	}
+}
+
+func TestResponseValidate(t *testing.T) {
+	for _, raw := range []string{
+		`{"duration": {"min": "10ms", "max": "20ms"}, "ttfb": {"min": 0.5, "max": 1.5}}`,
+		`{"headerLatency": {"min": "1ms", "max": "2ms"}, "ttfb": {"min": 0.1, "max": 0.2}}`,
+		`{"duration": {"min": "10ms", "max": "20ms"}, "bodyLatency": {"min": "1ms", "max": "2ms"}}`,
+		`{"bodyLatency": {"min": "2ms", "max": "1ms"}}`,
+	} {
+		var r response
+		if err := json.Unmarshal([]byte(raw), &r); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.validate(); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestSeedReproducesResponses(t *testing.T) {
+	sample := func(seed string) []string {
+		body := `{"duration": "1m", "seed": ` + seed + `, "response": {
+			"headerLatency": {"min": "10ms", "max": "50ms"},
+			"duration": {"min": "60ms", "max": "200ms"},
+			"statuses": [{"status": 200, "weight": 3}, {"status": 503, "weight": 1}]
+		}}`
+		p, ok := readParams(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/__service/mock", strings.NewReader(body)))
+		if !ok {
+			t.Fatal("expected valid params")
+		}
+		var seq []string
+		for range 50 {
+			head, body := p.Response.delays(p.Response.HeaderLatency, p.Response.Duration, p.rng)
+			seq = append(seq, fmt.Sprintf("%v/%v/%d", head, body, p.responseStatus()))
+		}
+		return seq
+	}
+	a, b := sample("42"), sample("42")
+	if !slices.Equal(a, b) {
+		t.Errorf("expected the same sequence for the same seed, got\n%v\n%v", a, b)
+	}
+	if c := sample("43"); slices.Equal(a, c) {
+		t.Error("expected another sequence for another seed")
+	}
+}
+
+func TestLatencyRamp(t *testing.T) {
+	for _, tc := range []struct {
+		curve curve
+		// mid is the response duration halfway through the run.
+		mid time.Duration
+	}{
+		{"linear", 60 * time.Millisecond},
+		{"quadratic", 35 * time.Millisecond},
+	} {
+		p := &params{
+			Duration: shared.Duration(10 * time.Second),
+			Response: response{
+				HeaderLatency: fixed(10 * time.Millisecond),
+				Duration:      fixed(10 * time.Millisecond),
+				Ramp: &ramp{
+					HeaderLatency: fixed(50 * time.Millisecond),
+					Duration:      fixed(110 * time.Millisecond),
+					Curve:         tc.curve,
+				},
+			},
+		}
+		for _, at := range []struct {
+			elapsed time.Duration
+			resp    time.Duration
+		}{
+			{0, 10 * time.Millisecond},
+			{5 * time.Second, tc.mid},
+			// The ramp holds its end values past the duration.
+			{20 * time.Second, 110 * time.Millisecond},
+		} {
+			p.startedAt = time.Now().Add(-at.elapsed)
+			_, resp := p.latencies()
+			if d := time.Duration(resp.Min) - at.resp; d < 0 || d > time.Millisecond || resp.Min != resp.Max {
+				t.Errorf("%s after %v: expected a duration of %v, got %v", tc.curve, at.elapsed, at.resp, resp)
+			}
+		}
+		p.startedAt = time.Now().Add(-20 * time.Second)
+		if head, _ := p.latencies(); head != fixed(50*time.Millisecond) {
+			t.Errorf("%s: expected the header latency to reach the ramp, got %v", tc.curve, head)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const defaultContentType = "text/plain; charset=utf-8"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// header holds the extra headers of mock responses. Values are a string or an
+// array of strings.
+type header http.Header
+
+func (h *header) UnmarshalJSON(data []byte) error {
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return fmt.Errorf("invalid JSON object: %v", err)
+	}
+	hh := make(http.Header, len(raws))
+	for k, raw := range raws {
+		if k == "" {
+			return fmt.Errorf("invalid header: empty name")
+		}
+		ck := http.CanonicalHeaderKey(k)
+		if _, ok := hh[ck]; ok {
+			return fmt.Errorf("conflicting header keys for '%s'", ck)
+		}
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			hh[ck] = []string{v}
+			continue
+		}
+		var vs []string
+		if err := json.Unmarshal(raw, &vs); err != nil {
+			return fmt.Errorf("invalid header %s value: must be a string or an array of strings", k)
+		}
+		hh[ck] = vs
+	}
+	*h = header(hh)
+	return nil
+}
+
+func (h header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(http.Header(h))
+}
+
+// writeHeaders sets the headers of a mock response: the content type of r,
+// the protocol of the request and the extra headers of r, which may replace
+// the others.
+func (r response) writeHeaders(w http.ResponseWriter, req *http.Request) {
+	ct := r.ContentType
+	if ct == "" {
+		ct = defaultContentType
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Mock-Proto", req.Proto)
+	for k, vs := range r.Headers {
+		w.Header()[k] = vs
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
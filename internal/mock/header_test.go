@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	var r response
+	raw := `{"contentType": "application/json", "headers": {"cache-control": "no-store", "X-Trace": ["a", "b"]}}`
+	if err := json.Unmarshal([]byte(raw), &r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.writeHeaders(w, httptest.NewRequest("GET", "/", nil))
+	h := w.Header()
+	if h.Get("Content-Type") != "application/json" ||
+		h.Get("Cache-Control") != "no-store" ||
+		!slices.Equal(h.Values("X-Trace"), []string{"a", "b"}) ||
+		h.Get("X-Mock-Proto") != "HTTP/1.1" {
+		t.Errorf("unexpected headers: %v", h)
+	}
+
+	w = httptest.NewRecorder()
+	response{}.writeHeaders(w, httptest.NewRequest("GET", "/", nil))
+	if ct := w.Header().Get("Content-Type"); ct != defaultContentType {
+		t.Errorf("expected the default content type, got %q", ct)
+	}
+
+	for _, raw := range []string{
+		`{"headers": {"X-A": 1}}`,
+		`{"headers": {"X-A": "a", "x-a": "b"}}`,
+	} {
+		if err := json.Unmarshal([]byte(raw), &response{}); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+	r = response{}
+	if err := json.Unmarshal([]byte(`{"contentType": "text/html", "headers": {"content-type": "text/xml"}}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.validate(); err == nil {
+		t.Error("expected error for conflicting content types")
+	}
+}
@@ -0,0 +1,162 @@
+package mock
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ozla/hrtester/internal/log"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// limitListener caps the connections served at once, like a server that can
+// only accept so many. A connection takes a slot with its first request for a
+// mock response, so the /__mock and /__service endpoints stay reachable over
+// the limit. The limit is read from the current run on every such request; 0
+// means no limit. Requests of excess connections wait for a free slot, or
+// their connection is closed if the limit says so.
+type limitListener struct {
+	net.Listener
+	limit func() (max int, closeExcess bool)
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active int
+	closed bool
+}
+
+func newLimitListener(l net.Listener, limit func() (int, bool)) *limitListener {
+	ll := &limitListener{Listener: l, limit: limit}
+	ll.cond = sync.NewCond(&ll.mu)
+	return ll
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &limitConn{Conn: c, l: l}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	return l.Listener.Close()
+}
+
+// acquire takes a slot for c, unless it holds one already, waiting until one
+// is free or ctx is done. It reports false if c is over the limit and must be
+// closed, or ctx is done.
+func (l *limitListener) acquire(ctx context.Context, c *limitConn) bool {
+	stop := context.AfterFunc(ctx, l.update)
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for !c.holds {
+		max, closeExcess := l.limit()
+		if l.closed || max == 0 || l.active < max {
+			l.active++
+			c.holds = true
+			break
+		}
+		if closeExcess || ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	return true
+}
+
+// update wakes up the waiting requests after the limit changed.
+func (l *limitListener) update() {
+	l.mu.Lock()
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+func (l *limitListener) release(c *limitConn) {
+	l.mu.Lock()
+	if c.holds {
+		c.holds = false
+		l.active--
+		l.cond.Broadcast()
+	}
+	l.mu.Unlock()
+}
+
+// limitConn gives its slot back to the listener when closed.
+type limitConn struct {
+	net.Conn
+	l *limitListener
+	// holds is guarded by the mutex of l.
+	holds bool
+	once  sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.l.release(c) })
+	return err
+}
+
+// limitConnKey is the context key of the limitConn of a request.
+type limitConnKey struct{}
+
+// connContext keeps the limitConn of a connection in the context of its
+// requests, under TLS too.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if lc, ok := c.(*limitConn); ok {
+		ctx = context.WithValue(ctx, limitConnKey{}, lc)
+	}
+	return ctx
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// admit takes a connection slot for r, if the run limits connections. It
+// reports false if the connection of r is over the limit and is to be closed.
+func (s *service) admit(r *http.Request) bool {
+	c, ok := r.Context().Value(limitConnKey{}).(*limitConn)
+	if !ok {
+		return true
+	}
+	if c.l.acquire(r.Context(), c) {
+		return true
+	}
+	max, _ := s.connLimit()
+	log.Debug(
+		"closing connection over the limit",
+		slog.String("remoteAddr", r.RemoteAddr),
+		slog.Int("maxConnections", max),
+	)
+	return false
+}
+
+// connLimit returns the connection limit of the current run, if any.
+func (s *service) connLimit() (int, bool) {
+	if s.status.Load() != statusRunning {
+		return 0, false
+	}
+	p := s.params.Load()
+	return p.MaxConnections, p.CloseExcessConnections
+}
+
+// limitChanged applies a new connection limit to the waiting connections.
+func (s *service) limitChanged() {
+	if s.conns != nil {
+		s.conns.update()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
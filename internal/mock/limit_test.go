@@ -0,0 +1,72 @@
+package mock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService()
+	s.status.Store(statusRunning)
+	s.params.Store(&params{MaxConnections: 1, rng: newLockedRand(1)})
+	s.conns = newLimitListener(inner, s.connLimit)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleDefault)
+	mux.HandleFunc("/__service/", s.handleService)
+	srv := &http.Server{Handler: mux, ConnContext: connContext}
+	go srv.Serve(s.conns)
+	defer srv.Close()
+
+	url := "http://" + inner.Addr().String()
+	get := func(c *http.Client, path string, timeout time.Duration) (int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	first := &http.Client{Transport: &http.Transport{}}
+	second := &http.Client{Transport: &http.Transport{}}
+
+	// The first connection holds the only slot while idle.
+	if code, err := get(first, "/", time.Second); err != nil || code != http.StatusOK {
+		t.Fatalf("expected the first request served, got %d (%v)", code, err)
+	}
+	if _, err := get(second, "/", 50*time.Millisecond); err == nil {
+		t.Fatal("expected the second connection to wait while the first is open")
+	}
+	// The service endpoints stay reachable over the limit.
+	if code, err := get(second, "/__service/", time.Second); err != nil || code != http.StatusOK {
+		t.Fatalf("expected the status served over the limit, got %d (%v)", code, err)
+	}
+	first.CloseIdleConnections()
+	if code, err := get(second, "/", time.Second); err != nil || code != http.StatusOK {
+		t.Fatalf("expected the second connection served once the first closed, got %d (%v)", code, err)
+	}
+
+	// With closeExcess, a connection over the limit is closed by the server.
+	s.params.Store(&params{MaxConnections: 1, CloseExcessConnections: true, rng: newLockedRand(1)})
+	s.limitChanged()
+	if _, err := get(first, "/", time.Second); err == nil || isTimeout(err) {
+		t.Errorf("expected the excess connection to be closed, got %v", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
@@ -32,16 +32,119 @@ const (
 
 type params struct {
 	Duration shared.Duration `json:"duration"`
-	Response struct {
-		HeaderLatency struct {
-			Min shared.Duration `json:"min"`
-			Max shared.Duration `json:"max"`
-		} `json:"headerLatency"`
-		Duration struct {
-			Min shared.Duration `json:"min"`
-			Max shared.Duration `json:"max"`
-		} `json:"duration"`
-	} `json:"response"`
+	// Seed makes the sampled delays reproducible. A random seed is picked
+	// when unset.
+	Seed     *uint64  `json:"seed"`
+	Response response `json:"response"`
+	// ErrorBursts override the response status during windows of the run.
+	ErrorBursts []errorBurst `json:"errorBursts"`
+	// MaxConnections caps the connections served at once; excess ones wait
+	// to be accepted, or are closed with CloseExcessConnections.
+	MaxConnections         int  `json:"maxConnections"`
+	CloseExcessConnections bool `json:"closeExcessConnections"`
+
+	rng *lockedRand
+	// startedAt and runningUntil span the run the params were loaded for.
+	startedAt    time.Time
+	runningUntil time.Time
+}
+
+// ramp holds the latencies reached at the end of the mock's duration. The
+// response latencies move from the static values towards them over the run.
+type ramp struct {
+	HeaderLatency latency `json:"headerLatency"`
+	Duration      latency `json:"duration"`
+	Curve         curve   `json:"curve"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type latency struct {
+	Min shared.Duration `json:"min"`
+	Max shared.Duration `json:"max"`
+}
+
+func (l latency) valid() bool {
+	return l.Min >= 0 && l.Min <= l.Max
+}
+
+// sample returns a random duration in [Min, Max) drawn from rng.
+func (l latency) sample(rng *lockedRand) time.Duration {
+	d := time.Duration(l.Min)
+	if n := int64(l.Max - l.Min); n > 0 {
+		d += time.Duration(rng.Int64N(n))
+	}
+	return d
+}
+
+// lerp interpolates between l and to, with f in [0, 1].
+func (l latency) lerp(to latency, f float64) latency {
+	return latency{
+		Min: l.Min + shared.Duration(f*float64(to.Min-l.Min)),
+		Max: l.Max + shared.Duration(f*float64(to.Max-l.Max)),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// lockedRand is a rand.Rand safe for use by concurrent handlers.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed uint64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewPCG(seed, 0))}
+}
+
+func (l *lockedRand) Int64N(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int64N(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type curve string
+
+func (c curve) MarshalJSON() ([]byte, error) {
+	switch c {
+	case "linear", "quadratic":
+		return []byte(`"` + string(c) + `"`), nil
+	default:
+		return nil, fmt.Errorf("invalid curve value: must be 'linear' or 'quadratic'")
+	}
+}
+
+func (c *curve) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid JSON string: %v", err)
+	}
+
+	switch s {
+	case "linear", "quadratic":
+		*c = curve(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid curve value: must be 'linear' or 'quadratic'")
+	}
+}
+
+// apply maps the run progress f in [0, 1] onto the curve.
+func (c curve) apply(f float64) float64 {
+	switch c {
+	case "quadratic":
+		return f * f
+	default:
+		return f
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -50,18 +153,28 @@ type service struct {
 	server       *http.Server
 	status       *atomic.Uint32
 	terminated   chan struct{}
+	listening    chan struct{}
+	addr         net.Addr
 	shutdownOnce sync.Once
-	params       params
-	startedAt    time.Time
-	runningUntil time.Time
+	shuttingDown atomic.Bool
+	// params is swapped as a whole, so that handlers see a consistent
+	// config while the mock is reconfigured.
+	params atomic.Pointer[params]
+	// burstTimers log the activation and deactivation of error bursts.
+	burstMu     sync.Mutex
+	burstTimers []*time.Timer
+	// conns applies the connection limit of the current run.
+	conns *limitListener
 }
 
 func NewService() *service {
 	s := &service{
 		status:     &atomic.Uint32{},
 		terminated: make(chan struct{}),
+		listening:  make(chan struct{}),
 	}
 	s.status.Store(statusReady)
+	s.params.Store(&params{rng: newLockedRand(rand.Uint64())})
 	return s
 }
 
@@ -94,22 +207,35 @@ func (s *service) Start() {
 	if err != nil {
 		log.Fatal("binding error", err, slog.Int("port", int(config.Mocker.Port)))
 	}
+	s.conns = newLimitListener(l, s.connLimit)
+	l = s.conns
+	s.addr = l.Addr()
+	close(s.listening)
 
 	tlsEnabled := config.Mocker.Cert != "" && config.Mocker.Key != ""
 
+	// HTTP/2 is negotiated via ALPN and is therefore only available over TLS.
+	http2Enabled := tlsEnabled && config.Mocker.HTTP2
+
 	tlsStatus := "disabled"
 	if tlsEnabled {
 		tlsStatus = "enabled"
 	}
+	http2Status := "disabled"
+	if http2Enabled {
+		http2Status = "enabled"
+	}
 	log.Info(
 		"mock server is listening",
-		slog.Int("port", int(config.Mocker.Port)),
+		slog.Int("port", l.Addr().(*net.TCPAddr).Port),
 		slog.String("tls", tlsStatus),
+		slog.String("http2", http2Status),
 	)
 
 	s.server = &http.Server{
 		Handler:           mux,
 		ReadHeaderTimeout: time.Minute,
+		ConnContext:       connContext,
 	}
 
 	go func() {
@@ -123,6 +249,11 @@ func (s *service) Start() {
 				log.Fatal("error loading key pair", err)
 			}
 			s.server.TLSConfig.Certificates = []tls.Certificate{cert}
+			if http2Enabled {
+				s.server.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+			} else {
+				s.server.TLSConfig.NextProtos = []string{"http/1.1"}
+			}
 			if config.Mocker.CAs != "" {
 				s.server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
 				if pool, err := shared.CACertPool(config.Mocker.CAs); err != nil {
@@ -139,16 +270,28 @@ func (s *service) Start() {
 		}
 	}()
 
-	<-s.terminated
+	shared.AwaitTermination(s.terminated, s.shutdown)
+}
+
+// Addr returns the address the mock listens on, once bound.
+func (s *service) Addr() net.Addr {
+	<-s.listening
+	return s.addr
+}
+
+// healthy reports whether the service is up and not shutting down.
+func (s *service) healthy() bool {
+	return !s.shuttingDown.Load()
 }
 
 func (s *service) shutdown() {
 	s.shutdownOnce.Do(
 		func() {
+			s.shuttingDown.Store(true)
 			log.Info("shutting down mock server; hrtester process will terminate")
 			go func() {
 				defer close(s.terminated)
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 				defer cancel()
 				if err := s.server.Shutdown(ctx); err != nil {
 					log.Warn("server forced to shut down", slog.Any("err", err))
@@ -165,53 +308,68 @@ func (s *service) handleDefault(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Service has not started.", http.StatusServiceUnavailable)
 		return
 	}
-
-	var respDelay, headDelay time.Duration
-
-	d := int64(s.params.Response.Duration.Max - s.params.Response.Duration.Min)
-	respDelay = time.Duration(s.params.Response.Duration.Min)
-	if d > 0 {
-		respDelay += time.Duration(rand.Int64N(d))
+	if !s.admit(r) {
+		// Closes the connection without a response.
+		panic(http.ErrAbortHandler)
 	}
 
-	d = int64(s.params.Response.HeaderLatency.Max - s.params.Response.HeaderLatency.Min)
-	headDelay = time.Duration(s.params.Response.HeaderLatency.Min)
-	if d > 0 {
-		headDelay += time.Duration(rand.Int64N(d))
-	}
+	p := s.params.Load()
+	headLatency, respLatency := p.latencies()
+	headDelay, bodyDelay := p.Response.delays(headLatency, respLatency, p.rng)
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	p.Response.writeHeaders(w, r)
+	size := p.Response.bodySize(p.rng)
 
 	if headDelay > 0 {
-		log.Debug(
-			"applying header delay",
-			slog.Any("duration", shared.Duration(headDelay)),
-			slog.Group("request",
-				slog.String("remoteAddr", r.RemoteAddr),
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-			),
-		)
+		if log.Enabled(slog.LevelDebug) {
+			log.Debug(
+				"applying header delay",
+				slog.Any("duration", shared.Duration(headDelay)),
+				slog.Group("request",
+					slog.String("remoteAddr", r.RemoteAddr),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+				),
+			)
+		}
 		time.Sleep(headDelay)
 	}
-	w.WriteHeader(http.StatusOK)
-
-	respDelay -= headDelay
-	if respDelay <= 0 {
-		return
+	status := p.responseStatus()
+	setContentLength(w.Header(), size, status)
+	w.WriteHeader(status)
+
+	if bodyDelay > 0 {
+		if p.Response.splitsHeaders(headDelay) {
+			// Send the headers now rather than along with the body.
+			http.NewResponseController(w).Flush()
+		}
+		if log.Enabled(slog.LevelDebug) {
+			log.Debug(
+				"applying body delay",
+				slog.Any("duration", shared.Duration(bodyDelay)),
+				slog.Group("request",
+					slog.String("remoteAddr", r.RemoteAddr),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+				),
+			)
+		}
+		time.Sleep(bodyDelay)
 	}
+	writeBody(w, size)
+}
 
-	log.Debug(
-		"applying response delay",
-		slog.Any("duration", shared.Duration(respDelay)),
-		slog.Group("request",
-			slog.String("remoteAddr", r.RemoteAddr),
-			slog.String("method", r.Method),
-			slog.String("path", r.URL.Path),
-		),
-	)
-	time.Sleep(respDelay)
-	w.Write([]byte("\n"))
+// latencies returns the header latency and response duration ranges of p for
+// the current point of the run.
+func (p *params) latencies() (latency, latency) {
+	head, resp := p.Response.HeaderLatency, p.Response.Duration
+	rp := p.Response.Ramp
+	if rp == nil || p.Duration <= 0 {
+		return head, resp
+	}
+	f := float64(time.Since(p.startedAt)) / float64(p.Duration)
+	f = rp.Curve.apply(max(0, min(f, 1)))
+	return head.lerp(rp.HeaderLatency, f), resp.lerp(rp.Duration, f)
 }
 
 func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
@@ -232,7 +390,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 				body.Status = "ready"
 			case statusRunning:
 				body.Status = "running"
-				body.Duration = shared.Duration(time.Until(s.runningUntil))
+				body.Duration = shared.Duration(time.Until(s.params.Load().runningUntil))
 			case statusStopping:
 				body.Status = "stopping"
 			}
@@ -240,7 +398,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			b, err := json.Marshal(body)
 			if err != nil {
 				log.Debug("failed to marshal response body", slog.Any("err", err))
-				http.Error(
+				shared.HTTPError(
 					w,
 					http.StatusText(http.StatusInternalServerError),
 					http.StatusInternalServerError,
@@ -250,13 +408,15 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			w.Write(b)
 		default:
 			w.Header().Set("Allow", http.MethodGet)
-			http.Error(
+			shared.HTTPError(
 				w,
 				http.StatusText(http.StatusMethodNotAllowed),
 				http.StatusMethodNotAllowed,
 			)
 			return
 		}
+	case "/__service/health", "/__service/health/":
+		shared.HandleHealth(w, r, s.healthy())
 	case "/__service/terminate", "/__service/terminate/":
 		switch r.Method {
 		case http.MethodPost:
@@ -264,7 +424,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			s.shutdown()
 		default:
 			w.Header().Set("Allow", http.MethodPost)
-			http.Error(
+			shared.HTTPError(
 				w,
 				http.StatusText(http.StatusMethodNotAllowed),
 				http.StatusMethodNotAllowed,
@@ -272,7 +432,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	default:
-		http.Error(
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusNotFound),
 			http.StatusNotFound,
@@ -284,91 +444,65 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 func (s *service) handleMock(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		if b, err := io.ReadAll(r.Body); err == nil {
-			if err = json.Unmarshal(b, &s.params); err != nil {
-				http.Error(
-					w,
-					fmt.Sprintf("Malformed JSON: %v", err),
-					http.StatusBadRequest,
-				)
-				return
-			}
-		} else {
-			http.Error(
-				w,
-				"Failed to read request body",
-				http.StatusBadRequest,
-			)
-			log.Debug("failed to read request body", slog.Any("err", err))
-			return
-		}
-		log.Info(
-			"loaded mock service config",
-			slog.Any("duration", s.params.Duration),
-			slog.Group(
-				"headerLatency",
-				slog.Any("min", s.params.Response.HeaderLatency.Min),
-				slog.Any("max", s.params.Response.HeaderLatency.Max),
-			),
-			slog.Group(
-				"responseDuration",
-				slog.Any("min", s.params.Response.Duration.Min),
-				slog.Any("max", s.params.Response.Duration.Max),
-			),
-		)
-		if s.params.Duration < 0 {
-			http.Error(
-				w,
-				"Invalid service duration: must be >= 0",
-				http.StatusBadRequest,
-			)
-			return
-		}
-		if s.params.Response.HeaderLatency.Min < 0 ||
-			s.params.Response.HeaderLatency.Min > s.params.Response.HeaderLatency.Max {
-			http.Error(
-				w,
-				"Invalid header latency: min must be >= 0 and <= max",
-				http.StatusBadRequest,
-			)
-			return
-		}
-		if s.params.Response.Duration.Min < 0 ||
-			s.params.Response.Duration.Min > s.params.Response.Duration.Max {
-			http.Error(
-				w,
-				"Invalid response duration: min must be >= 0 and <= max",
-				http.StatusBadRequest,
-			)
+		p, ok := readParams(w, r)
+		if !ok {
 			return
 		}
+		logParams("loaded mock service config", p)
 
 		if !s.status.CompareAndSwap(statusReady, statusRunning) {
-			http.Error(
+			shared.HTTPError(
 				w,
 				"Mock service is already running.",
 				http.StatusServiceUnavailable,
 			)
 			return
 		}
-		s.startedAt = time.Now()
-		s.runningUntil = s.startedAt.Add(time.Duration(s.params.Duration))
+		p.startedAt = time.Now()
+		p.runningUntil = p.startedAt.Add(time.Duration(p.Duration))
+		s.params.Store(p)
+		s.scheduleBursts(p)
+		s.limitChanged()
 		go func() {
-			time.Sleep(time.Duration(s.params.Duration))
+			time.Sleep(time.Duration(p.Duration))
+			s.stopBursts()
 			s.status.Store(statusReady)
+			s.limitChanged()
 			log.Info(
 				"mock service has stopped",
-				slog.Time("startedAt", s.startedAt),
+				slog.Time("startedAt", p.startedAt),
 			)
 		}()
 		w.WriteHeader(http.StatusOK)
 		log.Info(
 			"mock service has started",
-			slog.Time("finishesAt", s.runningUntil),
+			slog.Time("finishesAt", p.runningUntil),
 		)
+	case http.MethodPut:
+		// Reconfigures a running mock. The run keeps its duration, so the
+		// duration of the new config is ignored.
+		p, ok := readParams(w, r)
+		if !ok {
+			return
+		}
+		if s.status.Load() != statusRunning {
+			shared.HTTPError(
+				w,
+				"Mock service is not running.",
+				http.StatusConflict,
+			)
+			return
+		}
+		cur := s.params.Load()
+		p.Duration, p.startedAt, p.runningUntil = cur.Duration, cur.startedAt, cur.runningUntil
+		s.params.Store(p)
+		s.scheduleBursts(p)
+		s.limitChanged()
+		w.WriteHeader(http.StatusOK)
+		logParams("reconfigured running mock service", p)
 	default:
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(
+		w.Header().Set("Allow", http.MethodPost+", "+http.MethodPut)
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusMethodNotAllowed),
 			http.StatusMethodNotAllowed,
@@ -376,4 +510,183 @@ func (s *service) handleMock(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// readParams parses and validates the params in the request body. On failure
+// it writes the error response and returns false.
+func readParams(w http.ResponseWriter, r *http.Request) (*params, bool) {
+	p := &params{}
+	if b, err := io.ReadAll(r.Body); err == nil {
+		if shared.IsYAML(r.Header.Get("Content-Type")) {
+			if b, err = shared.YAMLToJSON(b); err != nil {
+				shared.HTTPError(
+					w,
+					fmt.Sprintf("Malformed YAML: %v", err),
+					http.StatusBadRequest,
+				)
+				return nil, false
+			}
+		}
+		if err = json.Unmarshal(b, p); err != nil {
+			shared.HTTPError(
+				w,
+				fmt.Sprintf("Malformed JSON: %v", err),
+				http.StatusBadRequest,
+			)
+			return nil, false
+		}
+	} else {
+		shared.HTTPError(
+			w,
+			"Failed to read request body",
+			http.StatusBadRequest,
+		)
+		log.Debug("failed to read request body", slog.Any("err", err))
+		return nil, false
+	}
+	if p.Duration < 0 {
+		shared.HTTPError(
+			w,
+			"Invalid service duration: must be >= 0",
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if !p.Response.HeaderLatency.valid() {
+		shared.HTTPError(
+			w,
+			"Invalid header latency: min must be >= 0 and <= max",
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if !p.Response.Duration.valid() {
+		shared.HTTPError(
+			w,
+			"Invalid response duration: min must be >= 0 and <= max",
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if err := p.Response.validate(); err != nil {
+		shared.HTTPError(
+			w,
+			fmt.Sprintf("Invalid response: %v", err),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if err := validateStatuses(p.Response.Statuses); err != nil {
+		shared.HTTPError(
+			w,
+			fmt.Sprintf("Invalid response statuses: %v", err),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if p.MaxConnections < 0 {
+		shared.HTTPError(
+			w,
+			"Invalid maxConnections: must be >= 0",
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if err := validateBursts(p.ErrorBursts); err != nil {
+		shared.HTTPError(
+			w,
+			fmt.Sprintf("Invalid errorBursts: %v", err),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	if rp := p.Response.Ramp; rp != nil {
+		if !rp.HeaderLatency.valid() || !rp.Duration.valid() {
+			shared.HTTPError(
+				w,
+				"Invalid ramp: min must be >= 0 and <= max",
+				http.StatusBadRequest,
+			)
+			return nil, false
+		}
+		if rp.Curve == "" {
+			rp.Curve = "linear"
+		}
+	}
+	if p.Seed == nil {
+		seed := rand.Uint64()
+		p.Seed = &seed
+	}
+	p.rng = newLockedRand(*p.Seed)
+	return p, true
+}
+
+func logParams(msg string, p *params) {
+	log.Info(
+		msg,
+		slog.Any("duration", p.Duration),
+		slog.Uint64("seed", *p.Seed),
+		slog.Group(
+			"headerLatency",
+			slog.Any("min", p.Response.HeaderLatency.Min),
+			slog.Any("max", p.Response.HeaderLatency.Max),
+		),
+		slog.Group(
+			"responseDuration",
+			slog.Any("min", p.Response.Duration.Min),
+			slog.Any("max", p.Response.Duration.Max),
+		),
+	)
+	if f := p.Response.TTFB; f != nil {
+		log.Info(
+			"mock header delay set as a fraction of the response duration",
+			slog.Float64("ttfbMin", f.Min),
+			slog.Float64("ttfbMax", f.Max),
+		)
+	}
+	if bl := p.Response.BodyLatency; bl != nil {
+		log.Info(
+			"mock body delay set independently of the header delay",
+			slog.Group(
+				"bodyLatency",
+				slog.Any("min", bl.Min),
+				slog.Any("max", bl.Max),
+			),
+		)
+	}
+	if len(p.Response.Statuses) > 0 {
+		log.Info(
+			"mock response statuses weighted",
+			slog.Any("statuses", p.Response.Statuses),
+		)
+	}
+	if len(p.ErrorBursts) > 0 {
+		log.Info(
+			"mock error bursts scheduled",
+			slog.Int("count", len(p.ErrorBursts)),
+		)
+	}
+	if p.MaxConnections > 0 {
+		log.Info(
+			"mock connections limited",
+			slog.Int("maxConnections", p.MaxConnections),
+			slog.Bool("closeExcess", p.CloseExcessConnections),
+		)
+	}
+	if rp := p.Response.Ramp; rp != nil {
+		log.Info(
+			"mock latency ramp configured",
+			slog.Group(
+				"headerLatency",
+				slog.Any("min", rp.HeaderLatency.Min),
+				slog.Any("max", rp.HeaderLatency.Max),
+			),
+			slog.Group(
+				"responseDuration",
+				slog.Any("min", rp.Duration.Min),
+				slog.Any("max", rp.Duration.Max),
+			),
+			slog.String("curve", string(rp.Curve)),
+		)
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,91 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+)
+
+func TestReconfigure(t *testing.T) {
+	s := NewService()
+	mock := func(method, body string) int {
+		w := httptest.NewRecorder()
+		s.handleMock(w, httptest.NewRequest(method, "/__service/mock", strings.NewReader(body)))
+		return w.Code
+	}
+	if code := mock(http.MethodPut, `{"duration": "1m"}`); code != http.StatusConflict {
+		t.Errorf("expected a reconfiguration without a run to fail, got %d", code)
+	}
+	if code := mock(http.MethodPost, `{"duration": "1m"}`); code != http.StatusOK {
+		t.Fatalf("expected the mock started, got %d", code)
+	}
+	started := s.params.Load()
+
+	// Requests served while the mock is reconfigured see either config.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				w := httptest.NewRecorder()
+				s.handleDefault(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if w.Code != http.StatusOK && w.Code != http.StatusServiceUnavailable {
+					t.Errorf("unexpected status %d", w.Code)
+				}
+			}
+		}()
+	}
+	body := `{"duration": "1s", "response": {"statuses": [{"status": 503, "weight": 1}]}}`
+	if code := mock(http.MethodPut, body); code != http.StatusOK {
+		t.Fatalf("expected the mock reconfigured, got %d", code)
+	}
+	wg.Wait()
+
+	p := s.params.Load()
+	if p.Duration != started.Duration || !p.startedAt.Equal(started.startedAt) || !p.runningUntil.Equal(started.runningUntil) {
+		t.Errorf("expected the run to keep its span, got %v from %v until %v", p.Duration, p.startedAt, p.runningUntil)
+	}
+	if d := time.Until(p.runningUntil); d < 50*time.Second {
+		t.Errorf("expected the run to keep its duration, %v left", d)
+	}
+	w := httptest.NewRecorder()
+	s.handleDefault(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the status of the new config, got %d", w.Code)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer func(d time.Duration) { config.ShutdownTimeout = d }(config.ShutdownTimeout)
+	config.ShutdownTimeout = 100 * time.Millisecond
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	s := NewService()
+	s.server = srv.Config
+	go http.Get(srv.URL)
+	<-entered
+
+	// The open request is given up on once the timeout is over.
+	start := time.Now()
+	s.shutdown()
+	select {
+	case <-s.terminated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the mock to shut down")
+	}
+	if d := time.Since(start); d < config.ShutdownTimeout {
+		t.Errorf("expected the mock to wait %v for the open request, shut down after %v", config.ShutdownTimeout, d)
+	}
+}
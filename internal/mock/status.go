@@ -0,0 +1,141 @@
+package mock
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// weightedStatus is a response status picked with a probability proportional
+// to its weight.
+type weightedStatus struct {
+	Status int  `json:"status"`
+	Weight uint `json:"weight"`
+}
+
+func (s weightedStatus) String() string {
+	return fmt.Sprintf("%d:%d", s.Status, s.Weight)
+}
+
+func validStatus(code int) bool {
+	return code >= 100 && code <= 599
+}
+
+func validateStatuses(ws []weightedStatus) error {
+	for i, s := range ws {
+		if !validStatus(s.Status) {
+			return fmt.Errorf("status at index %d: must be between 100 and 599", i)
+		}
+		if s.Weight == 0 {
+			return fmt.Errorf("status at index %d: weight must be > 0", i)
+		}
+	}
+	return nil
+}
+
+// pickStatus returns a status of ws drawn by weight, or 200 if ws is empty.
+func pickStatus(ws []weightedStatus, rng *lockedRand) int {
+	var total int64
+	for _, s := range ws {
+		total += int64(s.Weight)
+	}
+	if total == 0 {
+		return http.StatusOK
+	}
+	n := rng.Int64N(total)
+	for _, s := range ws {
+		if n -= int64(s.Weight); n < 0 {
+			return s.Status
+		}
+	}
+	return ws[len(ws)-1].Status
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// errorBurst overrides the response status from StartOffset after the start
+// of the run, for Duration.
+type errorBurst struct {
+	StartOffset shared.Duration `json:"startOffset"`
+	Duration    shared.Duration `json:"duration"`
+	Status      int             `json:"status"`
+}
+
+func (b errorBurst) active(elapsed time.Duration) bool {
+	return elapsed >= time.Duration(b.StartOffset) &&
+		elapsed < time.Duration(b.StartOffset+b.Duration)
+}
+
+func validateBursts(bs []errorBurst) error {
+	for i, b := range bs {
+		if b.StartOffset < 0 || b.Duration <= 0 {
+			return fmt.Errorf("burst at index %d: startOffset must be >= 0 and duration > 0", i)
+		}
+		if !validStatus(b.Status) {
+			return fmt.Errorf("burst at index %d: status must be between 100 and 599", i)
+		}
+	}
+	return nil
+}
+
+// responseStatus returns the status of a response of p at the current point
+// of the run: the status of the first active error burst, if any, or one of
+// the weighted statuses.
+func (p *params) responseStatus() int {
+	elapsed := time.Since(p.startedAt)
+	for _, b := range p.ErrorBursts {
+		if b.active(elapsed) {
+			return b.Status
+		}
+	}
+	return pickStatus(p.Response.Statuses, p.rng)
+}
+
+// scheduleBursts logs the activation and deactivation of the error bursts of
+// p, replacing the schedule of the previous params. Events already past are
+// skipped.
+func (s *service) scheduleBursts(p *params) {
+	s.burstMu.Lock()
+	defer s.burstMu.Unlock()
+	for _, t := range s.burstTimers {
+		t.Stop()
+	}
+	s.burstTimers = nil
+
+	elapsed := time.Since(p.startedAt)
+	for i, b := range p.ErrorBursts {
+		attrs := []slog.Attr{
+			slog.Int("burst", i),
+			slog.Int("status", b.Status),
+			slog.Any("duration", b.Duration),
+		}
+		if d := time.Duration(b.StartOffset) - elapsed; d >= 0 {
+			s.burstTimers = append(s.burstTimers, time.AfterFunc(d, func() {
+				log.Info("mock error burst activated", attrs...)
+			}))
+		}
+		if d := time.Duration(b.StartOffset+b.Duration) - elapsed; d >= 0 {
+			s.burstTimers = append(s.burstTimers, time.AfterFunc(d, func() {
+				log.Info("mock error burst deactivated", attrs...)
+			}))
+		}
+	}
+}
+
+// stopBursts cancels the pending error burst logs, at the end of the run.
+func (s *service) stopBursts() {
+	s.burstMu.Lock()
+	defer s.burstMu.Unlock()
+	for _, t := range s.burstTimers {
+		t.Stop()
+	}
+	s.burstTimers = nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
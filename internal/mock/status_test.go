@@ -0,0 +1,52 @@
+package mock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestPickStatus(t *testing.T) {
+	rng := newLockedRand(1)
+	if got := pickStatus(nil, rng); got != 200 {
+		t.Errorf("expected 200 without statuses, got %d", got)
+	}
+
+	ws := []weightedStatus{{Status: 200, Weight: 9}, {Status: 503, Weight: 1}}
+	counts := map[int]int{}
+	for range 10000 {
+		counts[pickStatus(ws, rng)]++
+	}
+	if len(counts) != 2 || counts[503] < 800 || counts[503] > 1200 {
+		t.Errorf("unexpected status counts: %v", counts)
+	}
+
+	for _, ws := range [][]weightedStatus{{{Status: 99, Weight: 1}}, {{Status: 200}}} {
+		if err := validateStatuses(ws); err == nil {
+			t.Errorf("expected error for %+v", ws)
+		}
+	}
+}
+
+func TestErrorBursts(t *testing.T) {
+	p := &params{
+		ErrorBursts: []errorBurst{
+			{StartOffset: shared.Duration(10 * time.Second), Duration: shared.Duration(10 * time.Second), Status: 500},
+			{StartOffset: shared.Duration(30 * time.Second), Duration: shared.Duration(time.Second), Status: 502},
+		},
+		rng:       newLockedRand(1),
+		startedAt: time.Now().Add(-15 * time.Second),
+	}
+	if got := p.responseStatus(); got != 500 {
+		t.Errorf("expected the active burst status, got %d", got)
+	}
+	p.startedAt = time.Now().Add(-25 * time.Second)
+	if got := p.responseStatus(); got != 200 {
+		t.Errorf("expected 200 between bursts, got %d", got)
+	}
+
+	if err := validateBursts([]errorBurst{{Status: 500}}); err == nil {
+		t.Error("expected error for a burst without duration")
+	}
+}
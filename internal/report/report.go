@@ -0,0 +1,89 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Report holds the stats of collector CSV files, overall and per test name
+// and per path.
+type Report struct {
+	Stats *shared.Stats
+	// Skipped counts the malformed records left out of the report.
+	Skipped int
+	// Delimiter separates the fields of the files read, a comma if unset.
+	Delimiter rune
+}
+
+func New() *Report {
+	return &Report{Stats: shared.NewStats()}
+}
+
+// Read adds the records of a collector CSV file to the report. Files written
+// with a column selection are read by their header row. Malformed records are
+// counted in Skipped; only a failure to read the file is an error.
+func (rp *Report) Read(r io.Reader) error {
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = -1
+	if rp.Delimiter != 0 {
+		rd.Comma = rp.Delimiter
+	}
+	var index []int
+	for first := true; ; first = false {
+		record, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			rp.Skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			var ok bool
+			if index, ok = shared.ParseHeader(record); ok {
+				continue
+			}
+		}
+		res, err := shared.ParseTestResultColumns(record, index)
+		if err != nil {
+			rp.Skipped++
+			continue
+		}
+		if err := rp.Stats.Add(res); err != nil {
+			rp.Skipped++
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Write prints the report as tables, overall and per test name and per path.
+func (rp *Report) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, rp.Stats.String()); err != nil {
+		return err
+	}
+	if rp.Skipped > 0 {
+		_, err := fmt.Fprintf(w, "\n%d malformed records skipped\n", rp.Skipped)
+		return err
+	}
+	return nil
+}
+
+// WriteJSON writes the stats of the report as JSON. The malformed records are
+// left out of the stats.
+func (rp *Report) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(rp.Stats)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,82 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	raw := `2025-01-02T10:00:00.000Z,a,id1,1,GET,/x,200,10ms,false
+2025-01-02T10:00:00.100Z,a,id2,2,GET,/x,200,30ms,false
+2025-01-02T10:00:00.200Z,b,id3,3,GET,/y,,200ms,true,,,,timeout
+2025-01-02T10:00:00.300Z,b,id4,4,GET,/y,,1ms,false,,,,other
+2025-01-02T10:00:00.400Z,b,id5,5,GET,/y,200,oops,false
+not,a,record
+`
+	rp := New()
+	if err := rp.Read(strings.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if rp.Skipped != 2 {
+		t.Errorf("expected 2 skipped records, got %d", rp.Skipped)
+	}
+	if st := rp.Stats.Overall(); st.Count != 4 || st.Errors != 1 || st.Timeouts != 1 || st.Latency().Count != 2 {
+		t.Errorf("unexpected overall stats: %+v", st)
+	}
+	if st := rp.Stats.ByPath()["/y"]; st.Count != 2 || st.Latency().Count != 0 {
+		t.Errorf("unexpected stats of /y: %+v", st)
+	}
+
+	var buf bytes.Buffer
+	if err := rp.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"all      4      25.00%  25.00%    -       10ms  30ms  30ms  30ms  30ms",
+		"b          2      50.00%  50.00%    -",
+		"2 malformed records skipped",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in report:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := rp.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"overall":{"count":4,"errors":1,"timeouts":1,"passed":0,"judged":0,"statusCodes":{"200":2},"latency":{"count":2,"min":"10ms","mean":"20ms","p50":"10ms"`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected %s in JSON report:\n%s", want, buf.String())
+	}
+}
+
+func TestReportColumns(t *testing.T) {
+	raw := `RoundDuration,ReqPath,RespCode,TestName
+10ms,/x,200,a
+30ms,/x,500,a
+10ms,/x
+`
+	rp := New()
+	if err := rp.Read(strings.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if rp.Skipped != 1 {
+		t.Errorf("expected 1 skipped record, got %d", rp.Skipped)
+	}
+	if st := rp.Stats.ByPath()["/x"]; st.Count != 2 || st.StatusCodes[500] != 1 || st.Latency().Count != 2 {
+		t.Errorf("unexpected stats of /x: %+v", st)
+	}
+}
+
+func TestReportDelimiter(t *testing.T) {
+	raw := "2025-01-02T10:00:00.000Z\ta\tid1\t1\tGET\t/x\t200\t10ms\tfalse\n"
+	rp := New()
+	rp.Delimiter = '\t'
+	if err := rp.Read(strings.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if st := rp.Stats.Overall(); rp.Skipped != 0 || st.Count != 1 {
+		t.Errorf("unexpected stats: %+v, %d skipped", st, rp.Skipped)
+	}
+}
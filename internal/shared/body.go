@@ -0,0 +1,16 @@
+package shared
+
+////////////////////////////////////////////////////////////////////////////////
+
+// FillPattern is the filler of sized bodies, sent by the testers and served by
+// the mock alike.
+var FillPattern = func() []byte {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 32*1024)
+	for i := range b {
+		b[i] = alphabet[i%len(alphabet)]
+	}
+	return b
+}()
+
+////////////////////////////////////////////////////////////////////////////////
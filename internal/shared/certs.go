@@ -2,21 +2,33 @@ package shared
 
 import (
 	"crypto/x509"
-	"errors"
+	"fmt"
 	"os"
+	"strings"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
-func CACertPool(caCertFn string) (*x509.CertPool, error) {
-	caCert, err := os.ReadFile(caCertFn)
-	if err != nil {
-		return nil, err
+// CACertPool builds a pool from one or more PEM files, separated by commas or
+// the OS path list separator.
+func CACertPool(caCertFns string) (*x509.CertPool, error) {
+	fns := strings.FieldsFunc(caCertFns, func(r rune) bool {
+		return r == ',' || r == os.PathListSeparator
+	})
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("no CA certificate file given")
 	}
 
 	certPool := x509.NewCertPool()
-	if ok := certPool.AppendCertsFromPEM(caCert); !ok {
-		return nil, errors.New("failed to add certificate to pool")
+	for _, fn := range fns {
+		fn = strings.TrimSpace(fn)
+		caCert, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if ok := certPool.AppendCertsFromPEM(caCert); !ok {
+			return nil, fmt.Errorf("failed to add certificate to pool: no valid certificates in %s", fn)
+		}
 	}
 
 	return certPool, nil
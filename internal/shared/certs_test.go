@@ -0,0 +1,25 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCACertPoolNamesOffendingFile(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(bad, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CACertPool(bad + "," + filepath.Join(dir, "missing.pem"))
+	if err == nil || !strings.Contains(err.Error(), "bad.pem") {
+		t.Errorf("expected error naming bad.pem, got %v", err)
+	}
+	_, err = CACertPool(filepath.Join(dir, "missing.pem"))
+	if err == nil || !strings.Contains(err.Error(), "missing.pem") {
+		t.Errorf("expected error naming missing.pem, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package shared
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type errorBody struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// HTTPError replies to the request with the specified error message and HTTP
+// code, like http.Error, but with a JSON body:
+//
+//	{"error": "...", "code": 400}
+func HTTPError(w http.ResponseWriter, msg string, code int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorBody{Error: msg, Code: code})
+}
+
+////////////////////////////////////////////////////////////////////////////////
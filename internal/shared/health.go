@@ -0,0 +1,32 @@
+package shared
+
+import (
+	"net/http"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// HandleHealth answers a health probe with 200 and {"ok":true}, or 503 and
+// {"ok":false} if healthy is false. Only GET and HEAD are allowed.
+func HandleHealth(w http.ResponseWriter, r *http.Request, healthy bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"ok":false}`))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"ok":true}`))
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -28,6 +28,7 @@ func DebugHandler(next http.HandlerFunc) http.HandlerFunc {
 				slog.String("remoteAddr", r.RemoteAddr),
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
+				slog.String("proto", r.Proto),
 			)
 			next(w, r)
 		},
@@ -0,0 +1,31 @@
+package shared
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ozla/hrtester/internal/log"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// AwaitTermination calls shutdown on an interrupt or SIGTERM, and returns once
+// terminated is closed.
+func AwaitTermination(terminated <-chan struct{}, shutdown func()) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		select {
+		case <-sigCtx.Done():
+			log.Info("received termination signal")
+			shutdown()
+		case <-terminated:
+		}
+	}()
+
+	<-terminated
+}
+
+////////////////////////////////////////////////////////////////////////////////
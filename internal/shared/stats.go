@@ -0,0 +1,384 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Percentile returns the nearest-rank percentile p, in (0, 100], of the
+// durations, which must be sorted in ascending order. It returns 0 for no
+// durations.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(len(sorted)) * p / 100))
+	return sorted[max(0, min(rank, len(sorted))-1)]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// MaxGroups bounds the groups of each kind the stats keep, so that paths
+	// with IDs in them cannot grow the stats of a long-lived collector
+	// without bound. Results of further groups count under OtherGroup.
+	MaxGroups  = 1000
+	OtherGroup = "(other)"
+)
+
+// Stats aggregates test results, overall and per test name, per path and per
+// tester instance. The tester, the collector, the report and embedded runs all
+// summarize results with it, so they share one JSON schema and one table
+// layout. It is safe for concurrent use.
+type Stats struct {
+	mu        sync.Mutex
+	overall   GroupStats
+	names     map[string]*GroupStats
+	paths     map[string]*GroupStats
+	instances map[string]*GroupStats
+	// excluded counts the results sent outside the measurement window of
+	// their run, which are left out.
+	excluded uint64
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		names:     make(map[string]*GroupStats),
+		paths:     make(map[string]*GroupStats),
+		instances: make(map[string]*GroupStats),
+	}
+}
+
+// Add adds r to the stats. Results sent outside the measurement window of their
+// run are only counted as excluded. Results that got a response but have a
+// malformed round duration are left out with an error.
+func (st *Stats) Add(r TestResult) error {
+	if measured, ok := r.Measured(); ok && !measured {
+		st.mu.Lock()
+		st.excluded++
+		st.mu.Unlock()
+		return nil
+	}
+	var d time.Duration
+	if !r.TimedOut() && r.ErrorClass() == "" {
+		var err error
+		if d, err = r.RoundDuration(); err != nil {
+			return fmt.Errorf("invalid round duration: %v", err)
+		}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.overall.add(r, d)
+	addToGroup(st.names, r.TestName(), r, d)
+	addToGroup(st.paths, r.RequestPath(), r, d)
+	// Results of testers without an instance ID are left out of the
+	// instances.
+	if id := r.Instance(); id != "" {
+		addToGroup(st.instances, id, r, d)
+	}
+	return nil
+}
+
+// Reset drops every result added so far.
+func (st *Stats) Reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.overall = GroupStats{}
+	clear(st.names)
+	clear(st.paths)
+	clear(st.instances)
+	st.excluded = 0
+}
+
+// Excluded returns the number of results left out as they were sent outside
+// the measurement window of their run.
+func (st *Stats) Excluded() uint64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.excluded
+}
+
+// Overall returns the stats of all results.
+func (st *Stats) Overall() GroupStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.overall.clone()
+}
+
+// ByName returns the stats per test name.
+func (st *Stats) ByName() map[string]GroupStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return cloneGroups(st.names)
+}
+
+// ByPath returns the stats per request path.
+func (st *Stats) ByPath() map[string]GroupStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return cloneGroups(st.paths)
+}
+
+// ByInstance returns the stats per tester instance, of the results that
+// carry an instance ID.
+func (st *Stats) ByInstance() map[string]GroupStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return cloneGroups(st.instances)
+}
+
+func (st *Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Overall   GroupStats            `json:"overall"`
+		Names     map[string]GroupStats `json:"names"`
+		Paths     map[string]GroupStats `json:"paths"`
+		Instances map[string]GroupStats `json:"instances,omitempty"`
+		Excluded  uint64                `json:"excluded"`
+	}{st.Overall(), st.ByName(), st.ByPath(), st.ByInstance(), st.Excluded()})
+}
+
+// String prints the stats as tables, overall and per test name, per path and,
+// if any results carry one, per tester instance.
+func (st *Stats) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	header := "\tCOUNT\tERRORS\tTIMEOUTS\tPASSED"
+	for _, p := range percentiles {
+		header += fmt.Sprintf("\tP%v", p)
+	}
+	header += "\tMAX\n"
+
+	overall := st.Overall()
+	fmt.Fprint(tw, "OVERALL"+header)
+	writeRow(tw, "all", &overall)
+	for _, g := range []struct {
+		title string
+		m     map[string]GroupStats
+	}{
+		{"TEST NAME", st.ByName()},
+		{"PATH", st.ByPath()},
+		{"INSTANCE", st.ByInstance()},
+	} {
+		if g.title == "INSTANCE" && len(g.m) == 0 {
+			continue
+		}
+		fmt.Fprint(tw, "\n"+g.title+header)
+		for _, k := range slices.Sorted(maps.Keys(g.m)) {
+			gs := g.m[k]
+			writeRow(tw, k, &gs)
+		}
+	}
+	tw.Flush()
+	if n := st.Excluded(); n > 0 {
+		fmt.Fprintf(&b, "\n%d results outside the measurement window excluded\n", n)
+	}
+	return b.String()
+}
+
+// addToGroup adds r, of round duration d, to the group key of m, or to
+// OtherGroup if m holds MaxGroups groups already.
+func addToGroup(m map[string]*GroupStats, key string, r TestResult, d time.Duration) {
+	gs, ok := m[key]
+	if !ok && len(m) >= MaxGroups {
+		key = OtherGroup
+		gs, ok = m[key]
+	}
+	if !ok {
+		gs = &GroupStats{}
+		m[key] = gs
+	}
+	gs.add(r, d)
+}
+
+func cloneGroups(m map[string]*GroupStats) map[string]GroupStats {
+	c := make(map[string]GroupStats, len(m))
+	for k, gs := range m {
+		c[k] = gs.clone()
+	}
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// percentiles are the latency percentiles the tables show.
+var percentiles = []float64{50, 90, 95, 99}
+
+// GroupStats holds the stats of a group of results.
+type GroupStats struct {
+	Count    uint64 `json:"count"`
+	Errors   uint64 `json:"errors"`
+	Timeouts uint64 `json:"timeouts"`
+	// Passed counts the results that met their success criteria, out of
+	// Judged, the results that recorded whether they did.
+	Passed uint64 `json:"passed"`
+	Judged uint64 `json:"judged"`
+	// StatusCodes counts the responses by status code.
+	StatusCodes map[int]uint64 `json:"statusCodes,omitempty"`
+
+	// latencies counts the round durations of the results that got a
+	// response. The durations are recorded to the millisecond, so this stays
+	// small however long the run.
+	latencies map[time.Duration]uint64
+	responses uint64
+	sum       time.Duration
+}
+
+func (gs *GroupStats) add(r TestResult, d time.Duration) {
+	gs.Count++
+	if passed, ok := r.Passed(); ok {
+		gs.Judged++
+		if passed {
+			gs.Passed++
+		}
+	}
+	switch {
+	case r.TimedOut():
+		gs.Timeouts++
+		return
+	case r.ErrorClass() != "":
+		gs.Errors++
+		return
+	}
+	if code, err := strconv.Atoi(r.ResponseCode()); err == nil {
+		if gs.StatusCodes == nil {
+			gs.StatusCodes = make(map[int]uint64)
+		}
+		gs.StatusCodes[code]++
+	}
+	if gs.latencies == nil {
+		gs.latencies = make(map[time.Duration]uint64)
+	}
+	gs.latencies[d]++
+	gs.responses++
+	gs.sum += d
+}
+
+// PassRate returns the share of the judged results that passed, in [0, 1].
+// ok is false if no result was judged.
+func (gs GroupStats) PassRate() (rate float64, ok bool) {
+	if gs.Judged == 0 {
+		return 0, false
+	}
+	return float64(gs.Passed) / float64(gs.Judged), true
+}
+
+func (gs *GroupStats) clone() GroupStats {
+	c := *gs
+	c.StatusCodes = maps.Clone(gs.StatusCodes)
+	c.latencies = maps.Clone(gs.latencies)
+	return c
+}
+
+// Latency summarizes the round durations of the results that got a response.
+// It is zero if none did.
+func (gs GroupStats) Latency() Latency {
+	if gs.responses == 0 {
+		return Latency{}
+	}
+	ds := slices.Sorted(maps.Keys(gs.latencies))
+	// percentile returns the nearest-rank percentile p, like Percentile.
+	percentile := func(p float64) time.Duration {
+		rank := uint64(math.Ceil(float64(gs.responses) * p / 100))
+		var n uint64
+		for _, d := range ds {
+			if n += gs.latencies[d]; n >= rank {
+				return d
+			}
+		}
+		return ds[len(ds)-1]
+	}
+	return Latency{
+		Count: gs.responses,
+		Min:   ds[0],
+		Mean:  gs.sum / time.Duration(gs.responses),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P95:   percentile(95),
+		P99:   percentile(99),
+		Max:   ds[len(ds)-1],
+	}
+}
+
+func (gs GroupStats) MarshalJSON() ([]byte, error) {
+	type alias GroupStats
+	aux := struct {
+		alias
+		PassRate *float64 `json:"passRate,omitempty"`
+		Latency  *Latency `json:"latency,omitempty"`
+	}{alias: alias(gs)}
+	if rate, ok := gs.PassRate(); ok {
+		aux.PassRate = &rate
+	}
+	if gs.responses > 0 {
+		l := gs.Latency()
+		aux.Latency = &l
+	}
+	return json.Marshal(aux)
+}
+
+func writeRow(w *tabwriter.Writer, key string, gs *GroupStats) {
+	if key == "" {
+		key = "-"
+	}
+	fmt.Fprintf(
+		w, "%s\t%d\t%s\t%s\t%s",
+		key, gs.Count, rate(gs.Errors, gs.Count), rate(gs.Timeouts, gs.Count), rate(gs.Passed, gs.Judged),
+	)
+	l := gs.Latency()
+	for _, d := range []time.Duration{l.P50, l.P90, l.P95, l.P99, l.Max} {
+		if l.Count == 0 {
+			fmt.Fprint(w, "\t-")
+			continue
+		}
+		fmt.Fprintf(w, "\t%v", Duration(d))
+	}
+	fmt.Fprintln(w)
+}
+
+func rate(n, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", float64(n)*100/float64(total))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Latency summarizes round durations. It marshals to JSON with the durations
+// formatted like the CSV files.
+type Latency struct {
+	// Count is the number of durations summarized.
+	Count uint64
+	Min   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func (l Latency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count uint64   `json:"count"`
+		Min   Duration `json:"min"`
+		Mean  Duration `json:"mean"`
+		P50   Duration `json:"p50"`
+		P90   Duration `json:"p90"`
+		P95   Duration `json:"p95"`
+		P99   Duration `json:"p99"`
+		Max   Duration `json:"max"`
+	}{l.Count, Duration(l.Min), Duration(l.Mean), Duration(l.P50), Duration(l.P90), Duration(l.P95), Duration(l.P99), Duration(l.Max)})
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,155 @@
+package shared
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	st := NewStats()
+	var ds []time.Duration
+	for i := range 100 {
+		var r TestResult
+		r.SetTestName("a")
+		r.SetRequestPath("/x")
+		r.SetResponseCode(200 + i%2)
+		d := time.Duration(100-i) * time.Millisecond
+		r.SetRoundDuration(Duration(d))
+		r.SetPassed(i%4 != 0)
+		ds = append([]time.Duration{d}, ds...)
+		if err := st.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var r TestResult
+	r.SetTestName("b")
+	r.SetTimedOut(true)
+	r.SetErrorClass("timeout")
+	st.Add(r)
+	r[trRoundDuration] = "oops"
+	r.SetTimedOut(false)
+	r.SetErrorClass("")
+	if err := st.Add(r); err == nil {
+		t.Error("expected a malformed duration to be rejected")
+	}
+
+	r.SetMeasured(false)
+	if err := st.Add(r); err != nil || st.Excluded() != 1 {
+		t.Errorf("expected a result outside the measurement window to be excluded, got %v", err)
+	}
+
+	o := st.Overall()
+	if o.Count != 101 || o.Timeouts != 1 || o.StatusCodes[200] != 50 || o.StatusCodes[201] != 50 {
+		t.Errorf("unexpected overall stats: %+v", o)
+	}
+	if rate, ok := o.PassRate(); o.Passed != 75 || o.Judged != 100 || !ok || rate != 0.75 {
+		t.Errorf("unexpected pass rate: %+v", o)
+	}
+	l := o.Latency()
+	for _, c := range []struct {
+		p   float64
+		got time.Duration
+	}{{50, l.P50}, {90, l.P90}, {99, l.P99}, {100, l.Max}} {
+		if want := Percentile(ds, c.p); c.got != want {
+			t.Errorf("expected P%v %v, got %v", c.p, want, c.got)
+		}
+	}
+	if l.Min != time.Millisecond || l.Mean != 50500*time.Microsecond {
+		t.Errorf("unexpected latency: %+v", l)
+	}
+	if b := st.ByName()["b"]; b.Count != 1 || b.Latency().Count != 0 {
+		t.Errorf("unexpected stats of b: %+v", b)
+	}
+
+	raw, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Overall struct {
+			Count   uint64 `json:"count"`
+			Latency struct {
+				P99 Duration `json:"p99"`
+			} `json:"latency"`
+		} `json:"overall"`
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Overall.Count != 101 || time.Duration(got.Overall.Latency.P99) != l.P99 || got.Paths["/x"] == nil {
+		t.Errorf("unexpected JSON: %s", raw)
+	}
+	if s := st.String(); !strings.Contains(s, "TEST NAME") || !strings.Contains(s, "a          100    0.00%   0.00%     75.00%") ||
+		!strings.Contains(s, "b          1      0.00%   100.00%   -") {
+		t.Errorf("unexpected table:\n%s", s)
+	}
+}
+
+func TestStatsByInstance(t *testing.T) {
+	st := NewStats()
+	for i, id := range []string{"t1", "t2", "t1", ""} {
+		var r TestResult
+		r.SetTestName("a")
+		r.SetResponseCode(200)
+		r.SetRoundDuration(Duration(time.Duration(i) * time.Millisecond))
+		r.SetInstance(id)
+		if err := st.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	byInstance := st.ByInstance()
+	if len(byInstance) != 2 || byInstance["t1"].Count != 2 || byInstance["t2"].Count != 1 {
+		t.Errorf("unexpected stats per instance: %+v", byInstance)
+	}
+	if st.Overall().Count != 4 || st.ByName()["a"].Count != 4 {
+		t.Errorf("expected every result overall and per name, got %+v", st.Overall())
+	}
+	if s := st.String(); !strings.Contains(s, "INSTANCE") || !strings.Contains(s, "t2") {
+		t.Errorf("expected an instance table, got\n%s", s)
+	}
+
+	raw, err := json.Marshal(NewStats())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "instances") || strings.Contains(NewStats().String(), "INSTANCE") {
+		t.Errorf("expected no instances without instance IDs, got %s", raw)
+	}
+}
+
+func TestStatsGroupCap(t *testing.T) {
+	st := NewStats()
+	for i := range MaxGroups + 10 {
+		var r TestResult
+		r.SetRequestPath("/items/" + strconv.Itoa(i))
+		r.SetResponseCode(200)
+		r.SetRoundDuration(Duration(time.Millisecond))
+		if err := st.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := st.ByPath()
+	if len(paths) != MaxGroups+1 {
+		t.Errorf("expected %d path groups, got %d", MaxGroups+1, len(paths))
+	}
+	if n := paths[OtherGroup].Count; n != 10 {
+		t.Errorf("expected 10 results under %s, got %d", OtherGroup, n)
+	}
+	// Known groups still count on their own.
+	var r TestResult
+	r.SetRequestPath("/items/0")
+	r.SetRoundDuration(Duration(time.Millisecond))
+	st.Add(r)
+	if n := st.ByPath()["/items/0"].Count; n != 2 {
+		t.Errorf("expected 2 results of /items/0, got %d", n)
+	}
+
+	st.Reset()
+	if n := st.Overall().Count; n != 0 || len(st.ByPath()) != 0 {
+		t.Errorf("expected no results after reset, got %d in %d paths", n, len(st.ByPath()))
+	}
+}
@@ -7,8 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/google/uuid"
+	"unicode/utf8"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -56,6 +55,13 @@ func (d Duration) String() string {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+const (
+	// RequestTimeLayout is RFC 3339 with millisecond precision.
+	RequestTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+	legacyRequestTimeLayout = "2006-01-02T15:04:05.999"
+)
+
 var attrNames = [...]string{
 	"ReqTime",
 	"TestName",
@@ -66,6 +72,27 @@ var attrNames = [...]string{
 	"RespCode",
 	"RoundDuration",
 	"TimedOut",
+	"RetryAfter",
+	"RespHeaders",
+	"SLAMet",
+	"Error",
+	"TLSVersion",
+	"Success",
+	"BodyBytes",
+	"ConnReused",
+	"DNSDuration",
+	"ConnectDuration",
+	"Retried",
+	"ReqScheme",
+	"ReqHost",
+	"HandshakeDuration",
+	"Schedule",
+	"Passed",
+	"DecodedBytes",
+	"Measured",
+	"ReqHeaderBytes",
+	"RespHeaderBytes",
+	"Instance",
 }
 
 const (
@@ -78,6 +105,27 @@ const (
 	trResponseCode
 	trRoundDuration
 	trTimedOut
+	trRetryAfter
+	trResponseHeaders
+	trSLAMet
+	trErrorClass
+	trTLSVersion
+	trSuccess
+	trBodyBytes
+	trConnReused
+	trDNSDuration
+	trConnectDuration
+	trRetried
+	trRequestScheme
+	trRequestHost
+	trHandshakeDuration
+	trSchedule
+	trPassed
+	trDecodedBytes
+	trMeasured
+	trRequestHeaderBytes
+	trResponseHeaderBytes
+	trInstance
 )
 
 type TestResult [len(attrNames)]string
@@ -90,16 +138,29 @@ func NewTestResult(vs url.Values) TestResult {
 	return r
 }
 
+func ParseTestResult(record []string) (TestResult, error) {
+	var r TestResult
+	// Records written before newer fields were added are shorter.
+	if len(record) < trTimedOut+1 || len(record) > len(r) {
+		return r, fmt.Errorf(
+			"invalid record: expected %d to %d fields, got %d",
+			trTimedOut+1, len(r), len(record),
+		)
+	}
+	copy(r[:], record)
+	return r, nil
+}
+
 func (r *TestResult) SetRequestTime(t time.Time) {
-	r[trRequestTime] = t.Format("2006-01-02T15:04:05.999")
+	r[trRequestTime] = t.Format(RequestTimeLayout)
 }
 
 func (r *TestResult) SetTestName(name string) {
 	r[trTestName] = name
 }
 
-func (r *TestResult) SetRequestID(id uuid.UUID) {
-	r[trRequestID] = id.String()
+func (r *TestResult) SetRequestID(id string) {
+	r[trRequestID] = id
 }
 
 func (r *TestResult) SetRequestNum(num uint64) {
@@ -130,6 +191,264 @@ func (r *TestResult) SetTimedOut(v bool) {
 	}
 }
 
+func (r TestResult) TimedOut() bool {
+	return r[trTimedOut] == "true"
+}
+
+// RequestTime parses the request time. Results written before the time zone
+// was recorded are interpreted as local time.
+func (r TestResult) RequestTime() (time.Time, error) {
+	t, err := time.Parse(RequestTimeLayout, r[trRequestTime])
+	if err != nil {
+		if lt, lerr := time.ParseInLocation(legacyRequestTimeLayout, r[trRequestTime], time.Local); lerr == nil {
+			return lt, nil
+		}
+	}
+	return t, err
+}
+
+func (r TestResult) TestName() string {
+	return r[trTestName]
+}
+
+func (r TestResult) RequestMethod() string {
+	return r[trRequestMethod]
+}
+
+func (r TestResult) RequestPath() string {
+	return r[trRequestPath]
+}
+
+func (r TestResult) ResponseCode() string {
+	return r[trResponseCode]
+}
+
+func (r TestResult) RoundDuration() (time.Duration, error) {
+	return time.ParseDuration(r[trRoundDuration])
+}
+
+func (r *TestResult) SetRetryAfter(d Duration) {
+	r[trRetryAfter] = d.String()
+}
+
+// RetryAfter returns the backoff the target requested, or 0 if none.
+func (r TestResult) RetryAfter() time.Duration {
+	d, _ := time.ParseDuration(r[trRetryAfter])
+	return d
+}
+
+// SetResponseHeaders records captured response headers, URL-encoded into a
+// single field.
+func (r *TestResult) SetResponseHeaders(h url.Values) {
+	r[trResponseHeaders] = h.Encode()
+}
+
+// ResponseHeaders returns the captured response headers.
+func (r TestResult) ResponseHeaders() url.Values {
+	h, _ := url.ParseQuery(r[trResponseHeaders])
+	return h
+}
+
+// SetSLAMet records whether the request completed within its latency budget.
+func (r *TestResult) SetSLAMet(v bool) {
+	r[trSLAMet] = strconv.FormatBool(v)
+}
+
+// SLAMet reports whether the request completed within its latency budget. ok
+// is false if no budget was set.
+func (r TestResult) SLAMet() (met, ok bool) {
+	met, err := strconv.ParseBool(r[trSLAMet])
+	return met, err == nil
+}
+
+// SetErrorClass records why the request failed, e.g. "timeout" or "tls".
+func (r *TestResult) SetErrorClass(class string) {
+	r[trErrorClass] = class
+}
+
+// ErrorClass returns why the request failed, or "" if it did not.
+func (r TestResult) ErrorClass() string {
+	return r[trErrorClass]
+}
+
+// SetTLSVersion records the negotiated TLS version, e.g. "TLS 1.3".
+func (r *TestResult) SetTLSVersion(v string) {
+	r[trTLSVersion] = v
+}
+
+func (r TestResult) TLSVersion() string {
+	return r[trTLSVersion]
+}
+
+// SetSuccess records whether the request got one of the success statuses.
+func (r *TestResult) SetSuccess(v bool) {
+	r[trSuccess] = strconv.FormatBool(v)
+}
+
+// Success reports whether the request got one of the success statuses. ok is
+// false for results written before success was recorded.
+func (r TestResult) Success() (success, ok bool) {
+	success, err := strconv.ParseBool(r[trSuccess])
+	return success, err == nil
+}
+
+// SetBodyBytes records how many bytes of the response body the tester read.
+func (r *TestResult) SetBodyBytes(n int64) {
+	r[trBodyBytes] = strconv.FormatInt(n, 10)
+}
+
+func (r TestResult) BodyBytes() (int64, error) {
+	return strconv.ParseInt(r[trBodyBytes], 10, 64)
+}
+
+// SetDecodedBytes records how many bytes the tester decoded from a compressed
+// response body, when BodyBytes counts the bytes on the wire.
+func (r *TestResult) SetDecodedBytes(n int64) {
+	r[trDecodedBytes] = strconv.FormatInt(n, 10)
+}
+
+func (r TestResult) DecodedBytes() (int64, error) {
+	return strconv.ParseInt(r[trDecodedBytes], 10, 64)
+}
+
+// SetConnReused records whether the request reused a pooled connection.
+func (r *TestResult) SetConnReused(v bool) {
+	r[trConnReused] = strconv.FormatBool(v)
+}
+
+// ConnReused reports whether the request reused a pooled connection. ok is
+// false when the request got no connection, or for results written before
+// connections were recorded.
+func (r TestResult) ConnReused() (reused, ok bool) {
+	reused, err := strconv.ParseBool(r[trConnReused])
+	return reused, err == nil
+}
+
+// SetDNSDuration records the DNS lookup time of a new connection.
+func (r *TestResult) SetDNSDuration(d Duration) {
+	r[trDNSDuration] = d.String()
+}
+
+func (r TestResult) DNSDuration() (time.Duration, error) {
+	return time.ParseDuration(r[trDNSDuration])
+}
+
+// SetConnectDuration records the TCP connect time of a new connection.
+func (r *TestResult) SetConnectDuration(d Duration) {
+	r[trConnectDuration] = d.String()
+}
+
+func (r TestResult) ConnectDuration() (time.Duration, error) {
+	return time.ParseDuration(r[trConnectDuration])
+}
+
+// SetHandshakeDuration records the TLS handshake time of a new connection.
+func (r *TestResult) SetHandshakeDuration(d Duration) {
+	r[trHandshakeDuration] = d.String()
+}
+
+func (r TestResult) HandshakeDuration() (time.Duration, error) {
+	return time.ParseDuration(r[trHandshakeDuration])
+}
+
+// SetSchedule records what paced the request: the pace of the run, a pace of
+// its own or a replay.
+func (r *TestResult) SetSchedule(schedule string) {
+	r[trSchedule] = schedule
+}
+
+func (r TestResult) Schedule() string {
+	return r[trSchedule]
+}
+
+// SetPassed records whether the request met all of its success criteria:
+// status, latency and body.
+func (r *TestResult) SetPassed(v bool) {
+	r[trPassed] = strconv.FormatBool(v)
+}
+
+// Passed reports whether the request met all of its success criteria. ok is
+// false for results written before criteria were recorded.
+func (r TestResult) Passed() (passed, ok bool) {
+	passed, err := strconv.ParseBool(r[trPassed])
+	return passed, err == nil
+}
+
+// SetMeasured records whether the request was sent within the measurement
+// window of its run.
+func (r *TestResult) SetMeasured(v bool) {
+	r[trMeasured] = strconv.FormatBool(v)
+}
+
+// Measured reports whether the request was sent within the measurement window
+// of its run. ok is false for results of runs without a window.
+func (r TestResult) Measured() (measured, ok bool) {
+	measured, err := strconv.ParseBool(r[trMeasured])
+	return measured, err == nil
+}
+
+// SetHeaderBytes records the sizes of the request and the response headers as
+// sent and received, each field counted as "Key: value\r\n".
+func (r *TestResult) SetHeaderBytes(req, resp int64) {
+	r[trRequestHeaderBytes] = strconv.FormatInt(req, 10)
+	r[trResponseHeaderBytes] = strconv.FormatInt(resp, 10)
+}
+
+func (r TestResult) RequestHeaderBytes() (int64, error) {
+	return strconv.ParseInt(r[trRequestHeaderBytes], 10, 64)
+}
+
+func (r TestResult) ResponseHeaderBytes() (int64, error) {
+	return strconv.ParseInt(r[trResponseHeaderBytes], 10, 64)
+}
+
+// SetInstance records the tester instance that sent the request, to tell the
+// results of several testers sharing a collector apart.
+func (r *TestResult) SetInstance(id string) {
+	r[trInstance] = id
+}
+
+func (r TestResult) Instance() string {
+	return r[trInstance]
+}
+
+// SetRetried records that the request was retried once after its reused
+// connection turned out to be closed by the target.
+func (r *TestResult) SetRetried(v bool) {
+	r[trRetried] = strconv.FormatBool(v)
+}
+
+// Retried reports whether the request was retried on a new connection. It is
+// false for results written before retries were recorded.
+func (r TestResult) Retried() bool {
+	retried, _ := strconv.ParseBool(r[trRetried])
+	return retried
+}
+
+// SetRequestTarget records the scheme and host the request was sent to.
+func (r *TestResult) SetRequestTarget(scheme, host string) {
+	r[trRequestScheme] = scheme
+	r[trRequestHost] = host
+}
+
+func (r TestResult) RequestScheme() string {
+	return r[trRequestScheme]
+}
+
+func (r TestResult) RequestHost() string {
+	return r[trRequestHost]
+}
+
+// RequestURL returns the URL of the request, made of its scheme, host and
+// path. It is the path alone for results written before the scheme and host
+// were recorded.
+func (r TestResult) RequestURL() string {
+	if r[trRequestScheme] == "" || r[trRequestHost] == "" {
+		return r[trRequestPath]
+	}
+	return r[trRequestScheme] + "://" + r[trRequestHost] + r[trRequestPath]
+}
+
 func (r TestResult) URLValues() url.Values {
 	m := make(url.Values)
 	for i, v := range attrNames {
@@ -142,4 +461,92 @@ func (r TestResult) Slice() []string {
 	return r[:]
 }
 
+// ColumnNames returns the names of the fields of a TestResult, in order.
+func ColumnNames() []string {
+	return append([]string(nil), attrNames[:]...)
+}
+
+// ColumnIndex returns the index of the field called name in a TestResult.
+func ColumnIndex(name string) (int, bool) {
+	for i, n := range attrNames {
+		if n == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ParseHeader returns the field index of each column of record, the header row
+// of a file written with a column selection. It reports false if record is no
+// header row.
+func ParseHeader(record []string) ([]int, bool) {
+	if len(record) == 0 {
+		return nil, false
+	}
+	index := make([]int, len(record))
+	for i, n := range record {
+		idx, ok := ColumnIndex(n)
+		if !ok {
+			return nil, false
+		}
+		index[i] = idx
+	}
+	return index, true
+}
+
+// ParseTestResultColumns parses a record of a file with a column selection,
+// whose header row has the field indexes index. Fields left out of the
+// selection are empty. A nil index parses record as ParseTestResult does.
+func ParseTestResultColumns(record []string, index []int) (TestResult, error) {
+	if index == nil {
+		return ParseTestResult(record)
+	}
+	var r TestResult
+	if len(record) != len(index) {
+		return r, fmt.Errorf(
+			"invalid record: expected %d fields, got %d",
+			len(index), len(record),
+		)
+	}
+	for i, idx := range index {
+		r[idx] = record[i]
+	}
+	return r, nil
+}
+
+// ParseDelimiter returns the delimiter rune of v, which must be a single
+// character that can separate CSV fields. "tab" and "\t" stand for a tab.
+func ParseDelimiter(v string) (rune, error) {
+	if v == "tab" || v == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(v)
+	if size == 0 || size != len(v) || r == utf8.RuneError {
+		return 0, fmt.Errorf("must be a single character")
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("must not be a quote or a line break")
+	}
+	return r, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// RunEvent marks the start or the end of a test run. The tester sends it to
+// the collector, which records it next to the results.
+type RunEvent struct {
+	Event      string          `json:"event"`
+	RunID      string          `json:"runID"`
+	Name       string          `json:"name"`
+	Time       time.Time       `json:"time"`
+	ParamsHash string          `json:"paramsHash,omitempty"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Requests   uint64          `json:"requests,omitempty"`
+}
+
+const (
+	RunEventStart = "start"
+	RunEventEnd   = "end"
+)
+
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestTime(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	want := time.Date(2025, 1, 2, 10, 0, 1, 234_000_000, loc)
+
+	var r TestResult
+	r.SetRequestTime(want)
+	if s := r[trRequestTime]; s != "2025-01-02T10:00:01.234+02:00" {
+		t.Errorf("unexpected format: %s", s)
+	}
+	got, err := r.RequestTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	r[trRequestTime] = "2025-01-02T10:00:01.5"
+	if got, err := r.RequestTime(); err != nil || got.Nanosecond() != 500_000_000 {
+		t.Errorf("failed to parse legacy format: %v, %v", got, err)
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	var r TestResult
+	r.SetRequestPath("/api/items?page=2")
+	if u := r.RequestURL(); u != "/api/items?page=2" {
+		t.Errorf("expected the path alone without a target, got %s", u)
+	}
+	r.SetRequestTarget("https", "target:8443")
+	if u := r.RequestURL(); u != "https://target:8443/api/items?page=2" {
+		t.Errorf("unexpected URL %s", u)
+	}
+	if got := NewTestResult(r.URLValues()); got != r {
+		t.Errorf("expected the target to survive the round trip, got %q", got.Slice())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var ds []time.Duration
+	for i := 1; i <= 20; i++ {
+		ds = append(ds, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{
+		50:  10 * time.Millisecond,
+		95:  19 * time.Millisecond,
+		99:  20 * time.Millisecond,
+		100: 20 * time.Millisecond,
+		1:   time.Millisecond,
+	} {
+		if got := Percentile(ds, p); got != want {
+			t.Errorf("p%v: expected %v, got %v", p, want, got)
+		}
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("expected 0 for no durations, got %v", got)
+	}
+}
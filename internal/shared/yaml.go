@@ -0,0 +1,46 @@
+package shared
+
+import (
+	"encoding/json"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// IsYAML reports whether a Content-Type header value denotes YAML.
+func IsYAML(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch mt {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsYAMLFile reports whether a file name has a YAML extension.
+func IsYAMLFile(fn string) bool {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// YAMLToJSON converts a YAML document to JSON, so that it can be decoded with
+// the JSON unmarshalers of the config types. YAML 1.2 rules apply, so that
+// e.g. an unquoted y or no stays a string.
+func YAMLToJSON(b []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+////////////////////////////////////////////////////////////////////////////////
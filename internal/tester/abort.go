@@ -0,0 +1,97 @@
+package tester
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	defaultAbortMinRequests = 100
+	defaultAbortWindow      = 30 * time.Second
+
+	// abortWindowBuckets is the number of buckets the rolling window is split
+	// into; the window moves on by one bucket at a time.
+	abortWindowBuckets = 10
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// errorWindow counts the requests and failures of a rolling time window.
+type errorWindow struct {
+	mu     sync.Mutex
+	start  time.Time
+	bucket time.Duration
+	counts [abortWindowBuckets]windowCount
+}
+
+type windowCount struct {
+	n      int64 // bucket number, since start
+	total  uint64
+	failed uint64
+}
+
+func newErrorWindow(start time.Time, window time.Duration) *errorWindow {
+	return &errorWindow{
+		start:  start,
+		bucket: max(window/abortWindowBuckets, time.Millisecond),
+	}
+}
+
+// observe records the outcome of a request at now and returns the counts of
+// the window ending at now.
+func (w *errorWindow) observe(now time.Time, ok bool) (total, failed uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := int64(now.Sub(w.start) / w.bucket)
+	c := &w.counts[n%abortWindowBuckets]
+	if c.n != n {
+		*c = windowCount{n: n}
+	}
+	c.total++
+	if !ok {
+		c.failed++
+	}
+	for _, c := range w.counts {
+		if c.n > n-abortWindowBuckets && c.n <= n {
+			total += c.total
+			failed += c.failed
+		}
+	}
+	return total, failed
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// checkErrorRate records the outcome of a request and aborts the run once the
+// share of failures in the rolling window exceeds the configured rate.
+func (s *service) checkErrorRate(ok bool) {
+	if s.errWindow == nil {
+		return
+	}
+	total, failed := s.errWindow.observe(time.Now(), ok)
+	if total < uint64(s.params.AbortMinRequests) {
+		return
+	}
+	if rate := float64(failed) / float64(total); rate > s.params.AbortOnErrorRate {
+		s.abort(fmt.Sprintf(
+			"error rate %.1f%% exceeded %.1f%% over the last %v (%d of %d requests failed)",
+			rate*100, s.params.AbortOnErrorRate*100, s.params.AbortWindow, failed, total,
+		))
+	}
+}
+
+// abort ends the run early, keeping the first reason given.
+func (s *service) abort(reason string) {
+	if !s.abortReason.CompareAndSwap(nil, &reason) {
+		return
+	}
+	s.logger.Warn("aborting test run", slog.String("reason", reason))
+	s.testCancel()
+}
+
+////////////////////////////////////////////////////////////////////////////////
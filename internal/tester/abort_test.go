@@ -0,0 +1,26 @@
+package tester
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorWindow(t *testing.T) {
+	start := time.Now()
+	w := newErrorWindow(start, 10*time.Second)
+
+	for i := range 10 {
+		w.observe(start.Add(time.Duration(i)*100*time.Millisecond), i%2 == 0)
+	}
+	if total, failed := w.observe(start.Add(time.Second), false); total != 11 || failed != 6 {
+		t.Errorf("unexpected counts: %d total, %d failed", total, failed)
+	}
+
+	// The early outcomes fall out of the window as it moves on.
+	if total, failed := w.observe(start.Add(10500*time.Millisecond), true); total != 2 || failed != 1 {
+		t.Errorf("unexpected counts after moving on: %d total, %d failed", total, failed)
+	}
+	if total, _ := w.observe(start.Add(time.Minute), true); total != 1 {
+		t.Errorf("expected a fresh window, got %d total", total)
+	}
+}
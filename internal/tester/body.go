@@ -0,0 +1,207 @@
+package tester
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ozla/hrtester/internal/shared"
+	"golang.org/x/time/rate"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fillReader yields n bytes from a repeating pattern without allocating them.
+type fillReader struct {
+	n   int64
+	off int
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	read := 0
+	for read < len(p) {
+		c := copy(p[read:], shared.FillPattern[r.off:])
+		read += c
+		r.off = (r.off + c) % len(shared.FillPattern)
+	}
+	r.n -= int64(read)
+	return read, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// throttledReader reads from r no faster than its limiter allows.
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *rate.Limiter
+}
+
+// newBandwidthLimiter returns a limiter for bytesPerSec, with a burst small
+// enough to keep the transfer smooth.
+func newBandwidthLimiter(bytesPerSec int64) *rate.Limiter {
+	burst := int(min(bytesPerSec, bandwidthBurst))
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.l.Burst() {
+		p = p[:t.l.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.l.WaitN(t.ctx, n); werr != nil {
+			if cerr := t.ctx.Err(); cerr != nil {
+				return n, cerr
+			}
+			// WaitN fails early if the wait would exceed the deadline.
+			return n, context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// readBody sets how much of a response body the tester reads within the round
+// duration: all of it, none or the first n bytes. The zero value reads the
+// whole body as "full" does, but after the round duration is taken, unless a
+// bandwidth limit is set.
+type readBody struct {
+	mode string
+	n    int64
+}
+
+const (
+	readBodyFull  = "full"
+	readBodyNone  = "none"
+	readBodyFirst = "first"
+)
+
+func (rb readBody) MarshalJSON() ([]byte, error) {
+	switch rb.mode {
+	case "":
+		return []byte(`""`), nil
+	case readBodyFirst:
+		return json.Marshal(fmt.Sprintf("%s:%d", readBodyFirst, rb.n))
+	default:
+		return json.Marshal(rb.mode)
+	}
+}
+
+func (rb *readBody) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid JSON string: %v", err)
+	}
+
+	switch s {
+	case "", readBodyFull, readBodyNone:
+		*rb = readBody{mode: s}
+		return nil
+	}
+	if v, ok := strings.CutPrefix(s, readBodyFirst+":"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			*rb = readBody{mode: readBodyFirst, n: n}
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid readBody value: must be 'full', 'none' or 'first:<bytes>'")
+}
+
+// timed reports whether the body read counts towards the round duration, which
+// sets "full" apart from the zero value.
+func (rb readBody) timed() bool {
+	return rb.mode != ""
+}
+
+// read consumes the part of r that rb asks for.
+func (rb readBody) read(r io.Reader) error {
+	var err error
+	switch rb.mode {
+	case readBodyNone:
+	case readBodyFirst:
+		if _, err = io.CopyN(io.Discard, r, rb.n); err == io.EOF {
+			err = nil
+		}
+	default:
+		_, err = io.Copy(io.Discard, r)
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// countingBody counts the bytes read from a response body.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// decodingBody decodes a response body compressed with gzip or deflate. The
+// decoder is set up on the first read, as it reads the header of the body.
+type decodingBody struct {
+	wire     io.Reader
+	encoding string
+	dec      io.Reader
+	err      error
+	io.Closer
+}
+
+// newDecodingBody returns body decoded as encoding, the Content-Encoding of
+// its response, reading the compressed bytes from wire. It returns nil for
+// encodings it does not decode.
+func newDecodingBody(body io.ReadCloser, wire io.Reader, encoding string) io.ReadCloser {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding != "gzip" && encoding != "deflate" {
+		return nil
+	}
+	return &decodingBody{wire: wire, encoding: encoding, Closer: body}
+}
+
+func (b *decodingBody) Read(p []byte) (int, error) {
+	if b.dec == nil && b.err == nil {
+		var err error
+		switch b.encoding {
+		case "gzip":
+			b.dec, err = gzip.NewReader(b.wire)
+		default:
+			// Deflate bodies are zlib streams.
+			b.dec, err = zlib.NewReader(b.wire)
+		}
+		if err != nil {
+			b.err = fmt.Errorf("invalid %s body: %v", b.encoding, err)
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.dec.Read(p)
+}
+
+// drainBody reads what is left of a body, up to maxBodyDrain bytes, and
+// closes it. Fully read bodies let the connection be reused; larger ones are
+// closed with their connection rather than read.
+func drainBody(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxBodyDrain)
+	body.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
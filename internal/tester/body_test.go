@@ -0,0 +1,162 @@
+package tester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestFillReader(t *testing.T) {
+	const n = 100_000
+	b, err := io.ReadAll(&fillReader{n: n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != n {
+		t.Fatalf("expected %d bytes, got %d", n, len(b))
+	}
+	for i := range b {
+		if b[i] != shared.FillPattern[i%len(shared.FillPattern)] {
+			t.Fatalf("unexpected byte at offset %d", i)
+		}
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	l := newBandwidthLimiter(64 * 1024)
+	r := &throttledReader{ctx: context.Background(), r: &fillReader{n: 32 * 1024}, l: l}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil || n != 32*1024 {
+		t.Fatalf("unexpected copy result: %d, %v", n, err)
+	}
+	// The first burst is free, the remaining 16 KiB take 250ms.
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("read too fast: %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r = &throttledReader{ctx: ctx, r: &fillReader{n: 64 * 1024}, l: newBandwidthLimiter(1024)}
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	for raw, want := range map[string]int64{
+		`""`:           100_000,
+		`"full"`:       100_000,
+		`"none"`:       0,
+		`"first:1024"`: 1024,
+		`"first:1e9"`:  -1,
+		`"first:0"`:    -1,
+		`"some"`:       -1,
+	} {
+		var rb readBody
+		if err := json.Unmarshal([]byte(raw), &rb); err != nil {
+			if want >= 0 {
+				t.Errorf("%s: unexpected error: %v", raw, err)
+			}
+			continue
+		} else if want < 0 {
+			t.Errorf("%s: expected error", raw)
+			continue
+		}
+		b := &countingBody{ReadCloser: io.NopCloser(&fillReader{n: 100_000})}
+		if err := rb.read(b); err != nil {
+			t.Fatal(err)
+		}
+		if b.n != want {
+			t.Errorf("%s: expected %d bytes read, got %d", raw, want, b.n)
+		}
+		if out, err := json.Marshal(rb); err != nil || string(out) != raw {
+			t.Errorf("%s: unexpected marshaled value %s, %v", raw, out, err)
+		}
+		// Only the default reads the body outside the round duration.
+		if rb.timed() != (raw != `""`) {
+			t.Errorf("%s: unexpected timed read %v", raw, rb.timed())
+		}
+	}
+}
+
+func TestCountWireBytes(t *testing.T) {
+	plain := strings.Repeat("compressible ", 1000)
+	var gz, zl bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(plain))
+	gw.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(plain))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip, deflate" {
+			t.Errorf("unexpected Accept-Encoding %q", r.Header.Get("Accept-Encoding"))
+		}
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gz.Bytes())
+		case "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Write(zl.Bytes())
+		case "/broken":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte(plain))
+		default:
+			w.Write([]byte(plain))
+		}
+	}))
+	defer srv.Close()
+
+	s := &service{
+		params: params{
+			Timeout:        shared.Duration(time.Second),
+			ReqSchema:      "http",
+			ReqIDHeader:    "X-Request-ID",
+			CountWireBytes: true,
+		},
+		target: strings.TrimPrefix(srv.URL, "http://"),
+		ids:    make(chan string, 1),
+		logger: log.With(),
+	}
+	client := s.newClient(&s.params, nil)
+	for _, c := range []struct {
+		path    string
+		wire    int
+		decoded int
+	}{
+		{"/gzip", gz.Len(), len(plain)},
+		{"/deflate", zl.Len(), len(plain)},
+		{"/broken", -1, 0},
+		{"/plain", len(plain), -1},
+	} {
+		s.ids <- "id"
+		tRes, _, err := s.roundTrip(client, 0, 1, request{Method: "GET", Path: c.path}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wire, _ := tRes.BodyBytes()
+		decoded, err := tRes.DecodedBytes()
+		if err != nil {
+			decoded = -1
+		}
+		if c.wire >= 0 && wire != int64(c.wire) || decoded != int64(c.decoded) {
+			t.Errorf("%s: expected %d wire and %d decoded bytes, got %d and %d", c.path, c.wire, c.decoded, wire, decoded)
+		}
+	}
+}
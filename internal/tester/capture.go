@@ -0,0 +1,219 @@
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// captureBodyLimit bounds the response body read for JSON captures.
+	captureBodyLimit = 1 << 20
+)
+
+var captureNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// capture extracts a value from a response for later requests of the same
+// sequence iteration. Selector is a header or cookie name, or a dot-separated
+// path into a JSON body, where numbers index arrays.
+type capture struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Selector string `json:"selector"`
+}
+
+func (c capture) validate() error {
+	if !captureNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid capture name '%s'", c.Name)
+	}
+	switch c.Source {
+	case "json", "header", "cookie":
+	default:
+		return fmt.Errorf("invalid capture source '%s': must be 'json', 'header' or 'cookie'", c.Source)
+	}
+	if c.Selector == "" {
+		return fmt.Errorf("capture '%s' has no selector", c.Name)
+	}
+	return nil
+}
+
+// captureValues stores the values selected by cs from resp in vars. Values
+// that cannot be found are removed, so stale ones are not reused.
+func captureValues(resp *http.Response, cs []capture, vars map[string]string) error {
+	var (
+		body    any
+		bodyErr error
+		decoded bool
+	)
+	var errs []string
+	for _, c := range cs {
+		var (
+			v  string
+			ok bool
+		)
+		switch c.Source {
+		case "header":
+			v = resp.Header.Get(c.Selector)
+			ok = v != ""
+		case "cookie":
+			for _, ck := range resp.Cookies() {
+				if ck.Name == c.Selector {
+					v, ok = ck.Value, true
+					break
+				}
+			}
+		case "json":
+			if !decoded {
+				bodyErr = json.NewDecoder(io.LimitReader(resp.Body, captureBodyLimit)).Decode(&body)
+				decoded = true
+			}
+			if bodyErr == nil {
+				v, ok = jsonPath(body, c.Selector)
+			}
+		}
+		if ok {
+			vars[c.Name] = v
+		} else {
+			delete(vars, c.Name)
+			errs = append(errs, c.Name)
+		}
+	}
+	if len(errs) > 0 {
+		if bodyErr != nil {
+			return fmt.Errorf("failed to capture %s: %v", strings.Join(errs, ", "), bodyErr)
+		}
+		return fmt.Errorf("failed to capture %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// jsonPath looks up a dot-separated path in a decoded JSON value. Strings are
+// returned as is, other values JSON-encoded.
+func jsonPath(v any, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = t[key]; !ok {
+				return "", false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return "", false
+			}
+			v = t[i]
+		default:
+			return "", false
+		}
+	}
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case nil:
+		return "", false
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// templateData is what request templates can reference: the captured values,
+// e.g. {{.Captured.token}}, and the ID and number of the request, e.g.
+// {{.RequestNum}}.
+type templateData struct {
+	Captured   map[string]string
+	RequestID  string
+	RequestNum uint64
+}
+
+// compileTemplates parses the path, query values, header values and body of r
+// that contain templates, except for secret references.
+func compileTemplates(r request) (map[string]*template.Template, error) {
+	ss := []string{r.Path, r.Body}
+	for _, vs := range r.Header {
+		ss = append(ss, vs...)
+	}
+	for _, vs := range r.Query {
+		ss = append(ss, vs...)
+	}
+
+	var ts map[string]*template.Template
+	for _, s := range ss {
+		if !strings.Contains(s, "{{") || isSecretRef(s) {
+			continue
+		}
+		t, err := template.New("").Option("missingkey=zero").Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if ts == nil {
+			ts = make(map[string]*template.Template)
+		}
+		ts[s] = t
+	}
+	return ts, nil
+}
+
+// render returns a copy of r with the templates filled in from data.
+func (r request) render(data templateData) (request, error) {
+	exec := func(s string) (string, error) {
+		t, ok := r.templates[s]
+		if !ok {
+			return s, nil
+		}
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
+
+	var err error
+	if r.Path, err = exec(r.Path); err != nil {
+		return r, err
+	}
+	if r.Body, err = exec(r.Body); err != nil {
+		return r, err
+	}
+	h := make(http.Header, len(r.Header))
+	for k, vs := range r.Header {
+		h[k] = make([]string, len(vs))
+		for i, v := range vs {
+			if h[k][i], err = exec(v); err != nil {
+				return r, err
+			}
+		}
+	}
+	r.Header = h
+	if r.Query != nil {
+		q := make(url.Values, len(r.Query))
+		for k, vs := range r.Query {
+			q[k] = make([]string, len(vs))
+			for i, v := range vs {
+				if q[k][i], err = exec(v); err != nil {
+					return r, err
+				}
+			}
+		}
+		r.Query = q
+	}
+	return r, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,76 @@
+package tester
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCaptureValues(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{
+			"Location":   {"/items/7"},
+			"Set-Cookie": {"session=abc; Path=/"},
+		},
+		Body: io.NopCloser(strings.NewReader(`{"auth": {"token": "t0k"}, "items": [{"id": 7}]}`)),
+	}
+	vars := map[string]string{"stale": "x"}
+	err := captureValues(resp, []capture{
+		{Name: "token", Source: "json", Selector: "auth.token"},
+		{Name: "id", Source: "json", Selector: "items.0.id"},
+		{Name: "loc", Source: "header", Selector: "Location"},
+		{Name: "sid", Source: "cookie", Selector: "session"},
+		{Name: "stale", Source: "json", Selector: "missing"},
+	}, vars)
+	if err == nil || !strings.Contains(err.Error(), "stale") {
+		t.Errorf("expected error for missing value, got %v", err)
+	}
+	want := map[string]string{"token": "t0k", "id": "7", "loc": "/items/7", "sid": "abc"}
+	if len(vars) != len(want) {
+		t.Errorf("unexpected values: %v", vars)
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, vars[k])
+		}
+	}
+}
+
+func TestRequestTemplates(t *testing.T) {
+	raw := []byte(`{
+  "method": "POST",
+  "path": "/items/{{.Captured.id}}",
+  "header": {"Authorization": "Bearer {{.Captured.token}}", "X-Static": "a"},
+  "body": "{\"missing\": \"{{.Captured.none}}\"}",
+  "capture": [{"name": "next", "source": "header", "selector": "Location"}]
+}`)
+	var r request
+	if err := json.Unmarshal(raw, &r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.render(templateData{Captured: map[string]string{"id": "7", "token": "t0k"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "/items/7" ||
+		got.Header.Get("Authorization") != "Bearer t0k" ||
+		got.Header.Get("X-Static") != "a" ||
+		got.Body != `{"missing": ""}` {
+		t.Errorf("unexpected rendered request: %+v", got)
+	}
+	if r.Path != "/items/{{.Captured.id}}" {
+		t.Errorf("render modified the original request")
+	}
+
+	for _, raw := range []string{
+		`{"method": "GET", "path": "/{{.Captured.id"}`,
+		`{"method": "GET", "path": "/", "capture": [{"name": "a-b", "source": "header", "selector": "X"}]}`,
+		`{"method": "GET", "path": "/", "capture": [{"name": "a", "source": "body", "selector": "X"}]}`,
+	} {
+		if err := json.Unmarshal([]byte(raw), &request{}); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
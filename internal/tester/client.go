@@ -0,0 +1,327 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	warmupConnectionsTimeout = 5 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// clients holds one HTTP client per client certificate, so pooled connections
+// are never shared between requests presenting different certificates. The
+// nil key holds the client for the global certificate.
+type clients map[*tls.Certificate]*http.Client
+
+func (s *service) newClients(p *params) clients {
+	cs := clients{nil: s.newClient(p, nil)}
+	if p.ReqSchema != "https" {
+		return cs
+	}
+	for _, r := range p.Requests {
+		if r.certificate != nil && cs[r.certificate] == nil {
+			cs[r.certificate] = s.newClient(p, r.certificate)
+		}
+	}
+	return cs
+}
+
+// newTesterClients returns the clients of each tester of the run, which close
+// their idle connections to make room for one another within the connection
+// cap.
+func (s *service) newTesterClients() []clients {
+	tcs := make([]clients, s.params.ParallelTesters)
+	for i := range tcs {
+		tcs[i] = s.newClients(&s.params)
+	}
+	if s.params.conns != nil {
+		s.params.conns.closeIdle = func() {
+			for _, cs := range tcs {
+				for _, c := range cs {
+					c.CloseIdleConnections()
+				}
+			}
+		}
+	}
+	return tcs
+}
+
+func (cs clients) get(r request) *http.Client {
+	if c, ok := cs[r.certificate]; ok {
+		return c
+	}
+	return cs[nil]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newClient returns an HTTP client for the params p presenting cert, or the
+// global client certificate when cert is nil.
+func (s *service) newClient(p *params, cert *tls.Certificate) *http.Client {
+	transport := &http.Transport{
+		IdleConnTimeout:     time.Duration(p.IdleConnTimeout),
+		MaxIdleConns:        p.MaxIdleConns,
+		MaxIdleConnsPerHost: p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     p.MaxConnsPerHost,
+		// A custom TLS config disables HTTP/2 unless explicitly requested.
+		ForceAttemptHTTP2: p.ReqVersion[0] == 2,
+		// HTTP/1.0 connections serve a single request.
+		DisableKeepAlives: p.ReqVersion.http10(),
+		// The testers decode bodies themselves, to count them on the wire.
+		DisableCompression: p.CountWireBytes,
+	}
+	if p.TCPNoDelay != nil || p.TCPKeepAlive != 0 || p.conns != nil {
+		transport.DialContext = p.dialContext
+	}
+
+	if p.ReqSchema == "https" {
+		c := tls.Config{
+			MinVersion:   uint16(p.TLSMinVersion),
+			MaxVersion:   uint16(p.TLSMaxVersion),
+			CipherSuites: p.CipherSuites,
+		}
+		if p.Host != "" {
+			// The certificate is checked against the host sent, not the
+			// target connected to.
+			c.ServerName = hostname(p.Host)
+		}
+		if config.Tester.Insecure {
+			c.InsecureSkipVerify = true
+		} else if config.Tester.SkipNameCheck {
+			c.InsecureSkipVerify = true
+			c.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+				opts := x509.VerifyOptions{
+					Roots: s.rootCAs,
+				}
+				var (
+					cert *x509.Certificate
+					err  error
+				)
+				switch n := len(rawCerts); n {
+				case 0:
+					return fmt.Errorf("no server certificate received")
+				case 1:
+					if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
+						return fmt.Errorf("failed to parse certificate: %w", err)
+					}
+				default:
+					if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
+						return fmt.Errorf("failed to parse certificate: %w", err)
+					}
+					opts.Intermediates = x509.NewCertPool()
+					for _, rc := range rawCerts[1:] {
+						c, err := x509.ParseCertificate(rc)
+						if err != nil {
+							return fmt.Errorf("failed to parse certificate: %w", err)
+						}
+						opts.Intermediates.AddCert(c)
+					}
+				}
+				_, err = cert.Verify(opts)
+				if err != nil {
+					return fmt.Errorf("certificate verification failed: %w", err)
+				}
+				return nil
+			}
+		}
+		if s.rootCAs != nil {
+			c.RootCAs = s.rootCAs
+		}
+		if cert == nil {
+			cert = s.clientCert
+		}
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert == nil {
+				// An empty certificate tells the server none is available.
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		}
+		transport.TLSClientConfig = &c
+	}
+	if p.ReqVersion.http10() {
+		transport.DialContext = http10Dialer(p.dialContext)
+		if transport.TLSClientConfig != nil {
+			transport.DialTLSContext = http10TLSDialer(p.dialContext, transport.TLSClientConfig)
+		}
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// newConnClient returns a client sending requests as c does, but each on a new
+// connection closed after its response.
+func newConnClient(c *http.Client) *http.Client {
+	t, ok := c.Transport.(*http.Transport)
+	if !ok {
+		c.CloseIdleConnections()
+		return c
+	}
+	t = t.Clone()
+	t.DisableKeepAlives = true
+	return &http.Client{Transport: t}
+}
+
+// dialContext dials the target with the TCP options of p, within its
+// connection cap.
+func (p *params) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return p.dialCapped(ctx, network, addr, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return p.dialTCP(ctx, net.Dialer{}, network, addr)
+	})
+}
+
+// dialCapped dials with d within the connection cap of p, if any.
+func (p *params) dialCapped(ctx context.Context, network, addr string, d func(context.Context, string, string) (net.Conn, error)) (net.Conn, error) {
+	if p.conns != nil {
+		return p.conns.dial(ctx, network, addr, d)
+	}
+	return d(ctx, network, addr)
+}
+
+// dialTCP dials the target with d and the TCP options of p.
+func (p *params) dialTCP(ctx context.Context, d net.Dialer, network, addr string) (net.Conn, error) {
+	d.KeepAlive = time.Duration(p.TCPKeepAlive)
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil || p.TCPNoDelay == nil {
+		return conn, err
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		if err := tc.SetNoDelay(*p.TCPNoDelay); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// hostname returns host without its port, if any.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return strings.Trim(h, "[]")
+	}
+	return strings.Trim(host, "[]")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newCollectorTransport returns the transport for the connections to the
+// collector. Over https it trusts the tester's CAs and presents its client
+// certificate.
+func (s *service) newCollectorTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Tester.CollectorScheme == "https" {
+		c := &tls.Config{RootCAs: s.rootCAs}
+		if s.clientCert != nil {
+			c.Certificates = []tls.Certificate{*s.clientCert}
+		}
+		t.TLSClientConfig = c
+	}
+	return t
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// warmupConnections opens one connection per tester client to the target with a
+// HEAD request to the first request's path, so the connection pools are warm
+// when the timed run starts. The requests carry the headers and Host of the
+// first request, and are given up on once ctx is done.
+func (s *service) warmupConnections(ctx context.Context) {
+	r := request{Path: "/"}
+	if len(s.params.Requests) > 0 {
+		r = s.params.Requests[0]
+	}
+	timeout := s.params.requestTimeout(r)
+	if timeout <= 0 {
+		timeout = warmupConnectionsTimeout
+	}
+	u := r.targetURL(s.params.ReqSchema, s.target).String()
+
+	var (
+		start  = time.Now()
+		wg     sync.WaitGroup
+		failed atomic.Int64
+		total  int
+	)
+	for _, cs := range s.testerClients {
+		for _, c := range cs {
+			total++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+				if err != nil {
+					failed.Add(1)
+					return
+				}
+				s.params.setRequest(req, r)
+				resp, err := c.Do(req)
+				if err != nil {
+					s.logger.Debug("connection warmup failed", slog.Any("err", err))
+					failed.Add(1)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+
+	s.logger.Info(
+		"connection warmup completed",
+		slog.Int("connections", total),
+		slog.Int64("failed", failed.Load()),
+		slog.Any("duration", shared.Duration(time.Since(start))),
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// loadRequestCerts loads the client certificates of requests specifying their
+// own cert/key pair. Requests sharing a pair share the certificate.
+func loadRequestCerts(rs []request) error {
+	loaded := make(map[[2]string]*tls.Certificate)
+	for i := range rs {
+		r := &rs[i]
+		if r.Cert == "" && r.Key == "" {
+			continue
+		}
+		if r.Cert == "" || r.Key == "" {
+			return fmt.Errorf("request at index %d: both cert and key must be set", i)
+		}
+		k := [2]string{r.Cert, r.Key}
+		if cert, ok := loaded[k]; ok {
+			r.certificate = cert
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(r.Cert, r.Key)
+		if err != nil {
+			return fmt.Errorf("request at index %d: %v", i, err)
+		}
+		loaded[k] = &cert
+		r.certificate = &cert
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
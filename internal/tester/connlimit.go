@@ -0,0 +1,81 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// connLimitRetry is how often a dial waiting for a free connection has the
+// testers close their idle connections again.
+const connLimitRetry = 10 * time.Millisecond
+
+// connLimiter caps the connections open to the target by all the testers of a
+// run, from their dial to their close.
+type connLimiter struct {
+	slots chan struct{}
+	// closeIdle closes the idle connections of the testers. Idle connections
+	// hold their slots, which a dial waiting for one frees this way.
+	closeIdle func()
+}
+
+func newConnLimiter(n int) *connLimiter {
+	return &connLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free slot until ctx is done.
+func (l *connLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	t := time.NewTicker(connLimitRetry)
+	defer t.Stop()
+	for {
+		if l.closeIdle != nil {
+			l.closeIdle()
+		}
+		select {
+		case l.slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (l *connLimiter) release() {
+	<-l.slots
+}
+
+// limitedConn frees its slot of the limiter once closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
+
+// dial dials with d within the limit of l.
+func (l *connLimiter) dial(ctx context.Context, network, addr string, d func(context.Context, string, string) (net.Conn, error)) (net.Conn, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := d(ctx, network, addr)
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: sync.OnceFunc(l.release)}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,224 @@
+package tester
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// connTrace records how a request got its connection. The dial callbacks may
+// run on another goroutine than the request, even after it has returned.
+type connTrace struct {
+	mu           sync.Mutex
+	gotConn      bool
+	reused       bool
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	handshake    time.Duration
+	// tlsVersion is the version of the handshake, for connections the
+	// response does not report.
+	tlsVersion uint16
+	// countHeaders has the trace sum up headerBytes, the size of the
+	// request header fields as written.
+	countHeaders bool
+	headerBytes  int64
+	// getConn is when the request asked the pool for a connection, and
+	// connWait how long it took to get one.
+	getConn  time.Time
+	connWait time.Duration
+}
+
+func (t *connTrace) clientTrace() *httptrace.ClientTrace {
+	ct := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.getConn = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.gotConn, t.reused = true, info.Reused
+			if !t.getConn.IsZero() {
+				t.connWait = time.Since(t.getConn)
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if info.Err == nil && !t.dnsStart.IsZero() {
+				t.dns = time.Since(t.dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// Dialing several addresses of a host counts from the first.
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && t.connect == 0 {
+				t.connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && !t.tlsStart.IsZero() {
+				t.handshake = time.Since(t.tlsStart)
+				t.tlsVersion = state.Version
+			}
+		},
+	}
+	if t.countHeaders {
+		ct.WroteHeaderField = func(key string, values []string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.headerBytes += headerFieldBytes(key, values)
+		}
+	}
+	return ct
+}
+
+// requestHeaderBytes returns the size of the request header fields written.
+func (t *connTrace) requestHeaderBytes() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.headerBytes
+}
+
+// headerSize returns the size of h serialized as HTTP/1.1 header fields.
+func headerSize(h http.Header) int64 {
+	var n int64
+	for k, vs := range h {
+		n += headerFieldBytes(k, vs)
+	}
+	return n
+}
+
+// headerFieldBytes returns the size of a header field serialized as
+// "Key: value\r\n" per value.
+func headerFieldBytes(key string, values []string) int64 {
+	var n int64
+	for _, v := range values {
+		n += int64(len(key) + len(": ") + len(v) + len("\r\n"))
+	}
+	return n
+}
+
+// queued returns how long the request waited for a free connection: the time
+// to get its connection less that spent setting up a new one. Requests that
+// got their connection within connQueueThreshold count as not waiting.
+func (t *connTrace) queued() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.gotConn {
+		return 0
+	}
+	d := t.connWait
+	if !t.reused {
+		d -= t.dns + t.connect + t.handshake
+	}
+	if d < connQueueThreshold {
+		return 0
+	}
+	return d
+}
+
+// handshakeVersion returns the TLS version of the handshake of the request, or
+// 0 if it made none.
+func (t *connTrace) handshakeVersion() uint16 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tlsVersion
+}
+
+// reusedConn reports whether the request got a pooled connection.
+func (t *connTrace) reusedConn() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.gotConn && t.reused
+}
+
+// record sets the connection columns of tRes. The DNS, connect and handshake
+// times are left empty for reused connections, and when the request did not wait for
+// the lookup or dial.
+func (t *connTrace) record(tRes *shared.TestResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.gotConn {
+		return
+	}
+	tRes.SetConnReused(t.reused)
+	if t.reused {
+		return
+	}
+	if t.dns > 0 {
+		tRes.SetDNSDuration(shared.Duration(t.dns))
+	}
+	if t.connect > 0 {
+		tRes.SetConnectDuration(shared.Duration(t.connect))
+	}
+	if t.handshake > 0 {
+		tRes.SetHandshakeDuration(shared.Duration(t.handshake))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// connQueueThreshold is the wait for a connection above which a request counts
+// as having queued for a free one, rather than just being handed one.
+const connQueueThreshold = 10 * time.Millisecond
+
+// connWaitGauge counts the requests of a run that waited for a free
+// connection, and keeps the longest wait.
+type connWaitGauge struct {
+	count   atomic.Uint64
+	longest atomic.Int64
+}
+
+func (g *connWaitGauge) reset() {
+	g.count.Store(0)
+	g.longest.Store(0)
+}
+
+// observe records a wait of d and reports whether it is the first of the run.
+func (g *connWaitGauge) observe(d time.Duration) bool {
+	for {
+		longest := g.longest.Load()
+		if int64(d) <= longest || g.longest.CompareAndSwap(longest, int64(d)) {
+			break
+		}
+	}
+	return g.count.Add(1) == 1
+}
+
+func (g *connWaitGauge) load() (uint64, time.Duration) {
+	return g.count.Load(), time.Duration(g.longest.Load())
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,190 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestConnTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	client := srv.Client()
+
+	get := func() shared.TestResult {
+		trace := &connTrace{}
+		req, err := http.NewRequestWithContext(
+			httptrace.WithClientTrace(context.Background(), trace.clientTrace()),
+			http.MethodGet, srv.URL, nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		var tRes shared.TestResult
+		trace.record(&tRes)
+		return tRes
+	}
+
+	first := get()
+	if reused, ok := first.ConnReused(); !ok || reused {
+		t.Errorf("expected a new connection, got %q", first.Slice())
+	}
+	if _, err := first.ConnectDuration(); err != nil {
+		t.Errorf("expected a connect time: %v", err)
+	}
+
+	second := get()
+	if reused, ok := second.ConnReused(); !ok || !reused {
+		t.Errorf("expected a reused connection, got %q", second.Slice())
+	}
+	if _, err := second.ConnectDuration(); err == nil {
+		t.Error("expected no connect time for a reused connection")
+	}
+}
+
+func TestHeaderBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Pad", "1234567890")
+	}))
+	defer srv.Close()
+
+	s := &service{
+		params: params{
+			Timeout:          shared.Duration(time.Second),
+			ReqSchema:        "http",
+			ReqIDHeader:      "X-Request-ID",
+			UserAgent:        "ua",
+			CountHeaderBytes: true,
+		},
+		target: strings.TrimPrefix(srv.URL, "http://"),
+		ids:    make(chan string, 1),
+		logger: log.With(),
+	}
+	s.ids <- "id"
+	cookie := strings.Repeat("c", 100)
+	r := request{Method: "GET", Path: "/", Header: http.Header{"Cookie": {cookie}}}
+	tRes, _, err := s.roundTrip(s.newClient(&s.params, nil), 0, 1, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Host, User-Agent, Cookie, X-Request-ID and Accept-Encoding, as written
+	// by the transport.
+	host := len("Host: ") + len(s.target) + 2
+	want := int64(host + len("User-Agent: ua\r\n") + len("Cookie: \r\n") + len(cookie) +
+		len("X-Request-ID: id\r\n") + len("Accept-Encoding: gzip\r\n"))
+	if n, err := tRes.RequestHeaderBytes(); err != nil || n != want {
+		t.Errorf("expected %d request header bytes, got %d (%v)", want, n, err)
+	}
+	// Date, Content-Length and X-Pad.
+	want = int64(len("Date: Mon, 02 Jan 2006 15:04:05 GMT\r\n") + len("Content-Length: 0\r\n") + len("X-Pad: 1234567890\r\n"))
+	if n, err := tRes.ResponseHeaderBytes(); err != nil || n != want {
+		t.Errorf("expected %d response header bytes, got %d (%v)", want, n, err)
+	}
+
+	s.params.CountHeaderBytes = false
+	s.ids <- "id"
+	if tRes, _, _ = s.roundTrip(s.newClient(&s.params, nil), 0, 2, r, nil); tRes.Slice()[len(tRes)-1] != "" {
+		t.Error("expected no header sizes unless asked for")
+	}
+}
+
+func TestConnQueue(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		conns, peak int
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch state {
+		case http.StateNew:
+			conns++
+			peak = max(peak, conns)
+		case http.StateClosed, http.StateHijacked:
+			conns--
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	var p params
+	if err := json.Unmarshal([]byte(`{"inFlightPerTester": 3, "requests": [{"path": "/"}]}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxConnsPerHost != 3 {
+		t.Errorf("expected maxConnsPerHost to default to inFlightPerTester, got %d", p.MaxConnsPerHost)
+	}
+	p.MaxConnsPerHost = 1
+	client := (&service{}).newClient(&p, nil)
+
+	queued := make([]time.Duration, 3)
+	var wg sync.WaitGroup
+	for i := range queued {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trace := &connTrace{}
+			req, err := http.NewRequestWithContext(
+				httptrace.WithClientTrace(context.Background(), trace.clientTrace()),
+				http.MethodGet, srv.URL, nil,
+			)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			queued[i] = trace.queued()
+		}()
+	}
+	wg.Wait()
+
+	if peak != 1 {
+		t.Errorf("expected at most 1 connection, got %d", peak)
+	}
+	var waited int
+	for _, d := range queued {
+		if d >= 50*time.Millisecond {
+			waited++
+		}
+	}
+	if waited != 2 {
+		t.Errorf("expected 2 requests to wait for the connection, got waits %v", queued)
+	}
+
+	var g connWaitGauge
+	if !g.observe(20*time.Millisecond) || g.observe(30*time.Millisecond) || g.observe(time.Millisecond) {
+		t.Error("expected only the first wait reported as first")
+	}
+	if n, longest := g.load(); n != 3 || longest != 30*time.Millisecond {
+		t.Errorf("expected 3 waits of at most 30ms, got %d of at most %v", n, longest)
+	}
+}
@@ -0,0 +1,112 @@
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// maxCriteriaBody is the most bytes of a response body the body criteria see.
+const maxCriteriaBody = 1 << 20
+
+////////////////////////////////////////////////////////////////////////////////
+
+// criteria are the conditions a response must all meet to pass: a status, a
+// latency and a body. Unset conditions fall back to the success statuses and
+// the latency budget; the body is only checked if asked for.
+type criteria struct {
+	Statuses   successStatuses `json:"statuses"`
+	MaxLatency shared.Duration `json:"maxLatency"`
+	// BodyContains and BodyMatches check the first maxCriteriaBody bytes
+	// of the body for a substring and a regular expression.
+	BodyContains string `json:"bodyContains"`
+	BodyMatches  string `json:"bodyMatches"`
+
+	bodyRegexp *regexp.Regexp
+}
+
+func (c *criteria) UnmarshalJSON(data []byte) error {
+	type alias criteria
+
+	var aux alias
+	if err := unmarshalStrict(data, &aux); err != nil {
+		return err
+	}
+
+	*c = criteria(aux)
+	if c.MaxLatency < 0 {
+		return fmt.Errorf("invalid maxLatency: must be >= 0")
+	}
+	if c.BodyMatches != "" {
+		re, err := regexp.Compile(c.BodyMatches)
+		if err != nil {
+			return fmt.Errorf("invalid bodyMatches: %v", err)
+		}
+		c.bodyRegexp = re
+	}
+
+	return nil
+}
+
+// checksBody reports whether c needs the response body.
+func (c *criteria) checksBody() bool {
+	return c != nil && (c.BodyContains != "" || c.bodyRegexp != nil)
+}
+
+// criteria returns the criteria of r: its own, else those of the run, if any.
+func (s *service) criteria(r request) *criteria {
+	if r.Criteria != nil {
+		return r.Criteria
+	}
+	return s.params.Criteria
+}
+
+// passed reports whether tRes, the result of r with the given start of its
+// body, meets the criteria of r. Failed and timed out requests never pass.
+func (s *service) passed(tRes shared.TestResult, r request, body []byte) bool {
+	if tRes.ErrorClass() != "" {
+		return false
+	}
+	c := s.criteria(r)
+	if c == nil {
+		c = &criteria{}
+	}
+
+	// Dial-only rounds get no status to check.
+	if !s.params.DialOnly {
+		statuses := c.Statuses
+		if statuses == nil {
+			statuses = s.params.SuccessStatuses
+		}
+		code, err := strconv.Atoi(tRes.ResponseCode())
+		if err != nil || !statuses.match(code) {
+			return false
+		}
+	}
+
+	maxLatency := time.Duration(c.MaxLatency)
+	if maxLatency == 0 {
+		maxLatency = s.params.latencyBudget(r)
+	}
+	if maxLatency > 0 {
+		if d, err := tRes.RoundDuration(); err != nil || d > maxLatency {
+			return false
+		}
+	}
+
+	if c.BodyContains != "" && !bytes.Contains(body, []byte(c.BodyContains)) {
+		return false
+	}
+	if c.bodyRegexp != nil && !c.bodyRegexp.Match(body) {
+		return false
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
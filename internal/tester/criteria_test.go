@@ -0,0 +1,97 @@
+package tester
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestCriteria(t *testing.T) {
+	var p params
+	if err := json.Unmarshal([]byte(`{
+		"latencyBudget": "50ms",
+		"criteria": {"statuses": ["2xx", 404], "bodyContains": "ok"},
+		"requests": [
+			{"path": "/a"},
+			{"path": "/b", "criteria": {"maxLatency": "10ms", "bodyMatches": "^id-[0-9]+$"}}
+		]
+	}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	s := &service{params: p}
+	result := func(code int, d time.Duration, errClass string) shared.TestResult {
+		var r shared.TestResult
+		r.SetResponseCode(code)
+		r.SetRoundDuration(shared.Duration(d))
+		r.SetErrorClass(errClass)
+		return r
+	}
+	a, b := p.Requests[0], p.Requests[1]
+	for _, c := range []struct {
+		name string
+		tRes shared.TestResult
+		r    request
+		body string
+		want bool
+	}{
+		{"run criteria", result(200, 20*time.Millisecond, ""), a, "all ok", true},
+		{"listed status", result(404, 20*time.Millisecond, ""), a, "ok", true},
+		{"other status", result(500, 20*time.Millisecond, ""), a, "ok", false},
+		{"over budget", result(200, 60*time.Millisecond, ""), a, "ok", false},
+		{"missing substring", result(200, 20*time.Millisecond, ""), a, "nope", false},
+		{"failed", result(200, 20*time.Millisecond, errClassOther), a, "ok", false},
+		{"request criteria", result(201, 5*time.Millisecond, ""), b, "id-42", true},
+		{"default statuses", result(404, 5*time.Millisecond, ""), b, "id-42", false},
+		{"over max latency", result(200, 20*time.Millisecond, ""), b, "id-42", false},
+		{"no match", result(200, 5*time.Millisecond, ""), b, "id-x", false},
+	} {
+		if got := s.passed(c.tRes, c.r, []byte(c.body)); got != c.want {
+			t.Errorf("%s: expected passed %v, got %v", c.name, c.want, got)
+		}
+	}
+
+	for _, raw := range []string{
+		`{"maxLatency": "-1s"}`,
+		`{"bodyMatches": "("}`,
+		`{"body": "ok"}`,
+	} {
+		var c criteria
+		if err := json.Unmarshal([]byte(raw), &c); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestCriteriaBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 10) + "needle"))
+	}))
+	defer srv.Close()
+
+	s := &service{
+		params: params{
+			Timeout:     shared.Duration(time.Second),
+			ReqSchema:   "http",
+			ReqIDHeader: "X-Request-ID",
+			Criteria:    &criteria{BodyContains: "needle"},
+		},
+		target: strings.TrimPrefix(srv.URL, "http://"),
+		ids:    make(chan string, 1),
+		logger: log.With(),
+	}
+	s.ids <- "id"
+	r := request{Method: "GET", Path: "/"}
+	tRes, body, err := s.roundTrip(s.newClient(&s.params, nil), 0, 1, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "xxxxxxxxxxneedle" || !s.passed(tRes, r, body) {
+		t.Errorf("expected the body to pass, got %q", body)
+	}
+}
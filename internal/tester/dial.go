@@ -0,0 +1,124 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// dialMethod is recorded as the method of dial-only rounds.
+const dialMethod = "DIAL"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// dial opens a connection to the target with the TCP options and within the
+// connection cap of the params, completes the TLS handshake of client over
+// https, and closes it again. The round duration covers the wait for the cap,
+// the DNS lookup, the TCP connect and the handshake, the last three of which
+// are also recorded apart.
+func (s *service) dial(client *http.Client, globalN uint64) shared.TestResult {
+	var tRes shared.TestResult
+
+	id := <-s.ids
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		s.params.requestTimeout(request{}),
+	)
+	defer cancel()
+
+	var (
+		// The dialer calls control before connecting to each address of
+		// the host; the first call ends the lookup.
+		connectOnce  sync.Once
+		dialStart    time.Time
+		connectStart time.Time
+		dialer       = net.Dialer{
+			ControlContext: func(context.Context, string, string, syscall.RawConn) error {
+				connectOnce.Do(func() { connectStart = time.Now() })
+				return nil
+			},
+		}
+	)
+
+	if log.Enabled(slog.LevelDebug) {
+		s.logger.Debug("dial", slog.Int("num", int(globalN)))
+	}
+	start := time.Now()
+	tRes.SetRequestTime(start.Truncate(time.Millisecond))
+	conn, err := s.params.dialCapped(ctx, "tcp", s.target, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialStart = time.Now()
+		return s.params.dialTCP(ctx, dialer, network, addr)
+	})
+	if err == nil {
+		connected := time.Now()
+		host, _, _ := net.SplitHostPort(s.target)
+		if net.ParseIP(host) == nil && host != "" {
+			tRes.SetDNSDuration(shared.Duration(connectStart.Sub(dialStart)))
+		}
+		tRes.SetConnectDuration(shared.Duration(connected.Sub(connectStart)))
+
+		if s.params.ReqSchema == "https" {
+			var c tls.Config
+			if t, ok := client.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+				c = *t.TLSClientConfig.Clone()
+			}
+			if c.ServerName == "" {
+				c.ServerName = host
+			}
+			tlsConn := tls.Client(conn, &c)
+			if err = tlsConn.HandshakeContext(ctx); err == nil {
+				tRes.SetHandshakeDuration(shared.Duration(time.Since(connected)))
+				tRes.SetTLSVersion(tls.VersionName(tlsConn.ConnectionState().Version))
+			}
+			conn = tlsConn
+		}
+		conn.Close()
+	}
+	elapsed := time.Since(start).Truncate(time.Millisecond)
+
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			tRes.SetTimedOut(true)
+			tRes.SetErrorClass(errClassTimeout)
+		} else if isTLS, attrs := classifyTLSError(err); isTLS {
+			tRes.SetTimedOut(false)
+			tRes.SetErrorClass(errClassTLS)
+			s.logger.Error(
+				"TLS handshake failed",
+				err,
+				append([]slog.Attr{slog.String("target", s.target)}, attrs...)...,
+			)
+		} else {
+			tRes.SetTimedOut(false)
+			tRes.SetErrorClass(errClassOther)
+			s.logger.Error("dial failed", err, slog.String("target", s.target))
+		}
+	} else {
+		tRes.SetTimedOut(false)
+	}
+	tRes.SetTestName(s.params.Name)
+	tRes.SetInstance(config.Tester.Instance)
+	tRes.SetRequestID(id)
+	tRes.SetRequestNum(globalN)
+	tRes.SetRequesMethod(dialMethod)
+	tRes.SetRequestTarget(string(s.params.ReqSchema), s.target)
+	tRes.SetRoundDuration(shared.Duration(elapsed))
+	if budget := s.params.LatencyBudget; budget > 0 {
+		tRes.SetSLAMet(tRes.ErrorClass() == "" && elapsed <= time.Duration(budget))
+	}
+	return tRes
+}
+
+////////////////////////////////////////////////////////////////////////////////
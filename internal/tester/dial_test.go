@@ -0,0 +1,112 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestDial(t *testing.T) {
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+	defer func(insecure bool) { config.Tester.Insecure = insecure }(config.Tester.Insecure)
+	config.Tester.Insecure = true
+
+	dial := func(schema schema, target string) shared.TestResult {
+		s := &service{
+			params: params{
+				Name:      "dial",
+				Timeout:   shared.Duration(time.Second),
+				ReqSchema: schema,
+				DialOnly:  true,
+			},
+			target: target,
+			ids:    make(chan string, 1),
+			logger: log.With(),
+		}
+		s.ids <- "id"
+		return s.dial(s.newClient(&s.params, nil), 1)
+	}
+
+	tRes := dial("https", srv.Listener.Addr().String())
+	if tRes.ErrorClass() != "" || tRes.RequestMethod() != dialMethod {
+		t.Fatalf("unexpected result %q", tRes.Slice())
+	}
+	if _, err := tRes.ConnectDuration(); err != nil {
+		t.Errorf("expected a connect duration, got %q", tRes.Slice())
+	}
+	if _, err := tRes.HandshakeDuration(); err != nil || tRes.TLSVersion() == "" {
+		t.Errorf("expected a TLS handshake, got %q", tRes.Slice())
+	}
+	if requests != 0 {
+		t.Errorf("expected no request, got %d", requests)
+	}
+
+	// A closed port fails the round.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	if tRes := dial("http", addr); tRes.ErrorClass() != errClassOther {
+		t.Errorf("expected a failed dial, got %q", tRes.Slice())
+	}
+}
+
+func TestDialMaxConns(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	s := &service{
+		params: params{
+			Timeout:   shared.Duration(100 * time.Millisecond),
+			ReqSchema: "http",
+			DialOnly:  true,
+			conns:     newConnLimiter(1),
+		},
+		target: l.Addr().String(),
+		ids:    make(chan string, 2),
+		logger: log.With(),
+	}
+	client := s.newClient(&s.params, nil)
+
+	// A dial waits for a free connection like a request does.
+	if err := s.params.conns.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.ids <- "id"
+	if tRes := s.dial(client, 1); tRes.ErrorClass() != errClassTimeout {
+		t.Errorf("expected the dial to time out at the cap, got %q", tRes.Slice())
+	}
+	s.params.conns.release()
+	s.ids <- "id"
+	if tRes := s.dial(client, 2); tRes.ErrorClass() != "" {
+		t.Errorf("expected the dial to succeed, got %q", tRes.Slice())
+	}
+	if n := len(s.params.conns.slots); n != 0 {
+		t.Errorf("expected the dial to free its slot, got %d held", n)
+	}
+}
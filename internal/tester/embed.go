@@ -0,0 +1,118 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Summary holds the aggregated results of a run started with Run.
+type Summary struct {
+	RunID     string
+	Name      string
+	StartedAt time.Time
+	Elapsed   time.Duration
+	// Requests counts the requests sent, warmup requests excluded.
+	Requests uint64
+	// Failures counts the requests that did not succeed, Errors and
+	// Timeouts those that got no response.
+	Failures uint64
+	Errors   uint64
+	Timeouts uint64
+	// StatusCodes counts the responses by status code.
+	StatusCodes map[int]uint64
+	// Passed counts the requests that passed their criteria, and PassRate
+	// is their share of the requests, in [0, 1].
+	Passed      uint64
+	PassRate    float64
+	AchievedRPS float64
+	// Latency summarizes the round durations of the requests that got a
+	// response.
+	Latency LatencySummary
+	// AbortReason is set when the run was aborted by abortOnErrorRate.
+	AbortReason string
+	// Stats holds the stats of the run per test name and per path, as the
+	// tester's stats endpoint reports them.
+	Stats *shared.Stats
+}
+
+// LatencySummary summarizes the round durations of a run.
+type LatencySummary = shared.Latency
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Run runs the test described by the JSON params in-process against target,
+// a host:port, and returns the aggregated results once the run is over. The
+// results are not sent to a collector. Cancelling ctx ends the run early; the
+// summary then covers the requests sent so far and the error is ctx.Err().
+func Run(ctx context.Context, target string, rawParams []byte) (Summary, error) {
+	var p params
+	if err := json.Unmarshal(rawParams, &p); err != nil {
+		return Summary{}, fmt.Errorf("malformed params: %v", err)
+	}
+	schedule, err := p.prepare()
+	if err != nil {
+		return Summary{}, fmt.Errorf("invalid %v", err)
+	}
+
+	s := NewService()
+	s.target = target
+	s.embedded = true
+	s.status.Store(statusTesting)
+	runID := newRunID()
+	logger := log.With(slog.String("runID", runID))
+	logger.Info(
+		"loaded embedded test config",
+		slog.String("name", p.Name),
+		slog.String("target", target),
+		slog.Any("duration", p.Duration),
+		slog.Any("pace", p.Pace),
+		slog.Uint64("seed", *p.Seed),
+	)
+	if p.WaitForTarget > 0 {
+		if err := s.waitForTarget(ctx, time.Duration(p.WaitForTarget), logger); err != nil {
+			return Summary{}, fmt.Errorf("target did not come up: %v", err)
+		}
+	}
+	if pf := p.preflight(); pf != nil {
+		if err := s.runPreflight(ctx, &p, pf, logger); err != nil {
+			return Summary{}, fmt.Errorf("preflight failed: %v", err)
+		}
+	}
+	s.startRun(ctx, p, schedule, runID, logger)
+	<-s.run.Load().done
+
+	ri := s.run.Load()
+	overall := s.stats.Overall()
+	sum := Summary{
+		RunID:       runID,
+		Name:        s.params.Name,
+		StartedAt:   ri.startedAt,
+		Elapsed:     ri.stoppedAt.Sub(ri.startedAt),
+		Requests:    s.requests.Load() - s.warmups.Load(),
+		Failures:    s.failures.Load(),
+		Errors:      s.errored.Load(),
+		Timeouts:    s.timeouts.Load(),
+		StatusCodes: overall.StatusCodes,
+		Passed:      overall.Passed,
+		Latency:     overall.Latency(),
+		Stats:       s.stats,
+	}
+	sum.PassRate, _ = overall.PassRate()
+	if sum.Elapsed > 0 {
+		sum.AchievedRPS = float64(sum.Requests) / sum.Elapsed.Seconds()
+	}
+	if reason := s.abortReason.Load(); reason != nil {
+		sum.AbortReason = *reason
+	}
+	return sum, ctx.Err()
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,24 @@
+package tester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunWarmup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	params := `{"reqSchema": "http", "duration": "500ms", "pace": "40rps", "parallelTesters": 1, "timeout": "1s", "warmupRequests": 5, "requests": [{"path": "/"}]}`
+	sum, err := Run(context.Background(), strings.TrimPrefix(srv.URL, "http://"), []byte(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The warmup requests are neither judged nor counted.
+	if sum.Requests == 0 || sum.StatusCodes[200] != sum.Requests {
+		t.Errorf("expected the requests to exclude the warmups, got %d requests and %v", sum.Requests, sum.StatusCodes)
+	}
+}
@@ -0,0 +1,86 @@
+package tester
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Classes of failed requests, recorded in the Error column of the results.
+const (
+	errClassTimeout = "timeout"
+	errClassTLS     = "tls"
+	errClassOther   = "other"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// staleConnError reports whether err is a reset or broken pipe, as when the
+// target closed an idle connection the request was sent on.
+func staleConnError(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// retryable reports whether a request with method may be sent again after its
+// connection failed, that is whether the method is idempotent.
+func retryable(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// classifyTLSError reports whether err is a TLS handshake or certificate
+// verification failure and returns attributes describing the certificate
+// involved, if any.
+func classifyTLSError(err error) (bool, []slog.Attr) {
+	var (
+		verErr     *tls.CertificateVerificationError
+		authErr    x509.UnknownAuthorityError
+		invalidErr x509.CertificateInvalidError
+		hostErr    x509.HostnameError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		cert       *x509.Certificate
+		isTLS      = true
+	)
+	switch {
+	case errors.As(err, &verErr):
+		if len(verErr.UnverifiedCertificates) > 0 {
+			cert = verErr.UnverifiedCertificates[0]
+		}
+	case errors.As(err, &authErr):
+		cert = authErr.Cert
+	case errors.As(err, &invalidErr):
+		cert = invalidErr.Cert
+	case errors.As(err, &hostErr):
+		cert = hostErr.Certificate
+	case errors.As(err, &recordErr), errors.As(err, &alertErr):
+	default:
+		// Other handshake failures are plain errors of the tls package.
+		isTLS = strings.Contains(err.Error(), "tls: ")
+	}
+
+	if cert == nil {
+		return isTLS, nil
+	}
+	return isTLS, []slog.Attr{
+		slog.Group(
+			"certificate",
+			slog.String("subject", cert.Subject.String()),
+			slog.String("issuer", cert.Issuer.String()),
+			slog.Time("notBefore", cert.NotBefore),
+			slog.Time("notAfter", cert.NotAfter),
+		),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
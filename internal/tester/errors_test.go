@@ -0,0 +1,56 @@
+package tester
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyTLSError(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "target"},
+		Issuer:  pkix.Name{CommonName: "old-ca"},
+	}
+	for _, tc := range []struct {
+		err       error
+		isTLS     bool
+		certAttrs bool
+	}{
+		{&tls.CertificateVerificationError{UnverifiedCertificates: []*x509.Certificate{cert}, Err: errors.New("expired")}, true, true},
+		{fmt.Errorf("certificate verification failed: %w", x509.UnknownAuthorityError{Cert: cert}), true, true},
+		{x509.HostnameError{Certificate: cert, Host: "other"}, true, true},
+		{tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, true, false},
+		{errors.New("remote error: tls: handshake failure"), true, false},
+		{errors.New("connection refused"), false, false},
+	} {
+		err := &url.Error{Op: "Get", URL: "https://target/", Err: tc.err}
+		isTLS, attrs := classifyTLSError(err)
+		if isTLS != tc.isTLS || (len(attrs) > 0) != tc.certAttrs {
+			t.Errorf("%v: got isTLS=%v, attrs=%v", tc.err, isTLS, attrs)
+		}
+	}
+}
+
+func TestStaleConnError(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		stale bool
+	}{
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, false},
+		{errors.New("connection reset by peer"), false},
+	} {
+		err := &url.Error{Op: "Get", URL: "http://target/", Err: tc.err}
+		if got := staleConnError(err); got != tc.stale {
+			t.Errorf("%v: got %v, expected %v", tc.err, got, tc.stale)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// http10Conn sends the one request of an HTTP/1.0 connection with an
+// HTTP/1.0 request line. Go's HTTP client writes HTTP/1.1 whatever the
+// protocol of the request, so the line is rewritten on its way out.
+type http10Conn struct {
+	net.Conn
+	// line holds the start of the request line until its end is written.
+	line    []byte
+	written bool
+}
+
+func (c *http10Conn) Write(b []byte) (int, error) {
+	if c.written {
+		return c.Conn.Write(b)
+	}
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		c.line = append(c.line, b...)
+		return len(b), nil
+	}
+	c.written = true
+	line := append(c.line, b[:i+1]...)
+	c.line = nil
+	if rest, ok := bytes.CutSuffix(line, []byte(" HTTP/1.1\r\n")); ok {
+		line = append(rest, " HTTP/1.0\r\n"...)
+	}
+	if _, err := c.Conn.Write(append(line, b[i+1:]...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// http10Dialer returns a dial function for the transport of HTTP/1.0
+// requests, connecting with dial.
+func http10Dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &http10Conn{Conn: conn}, nil
+	}
+}
+
+// http10TLSDialer is http10Dialer over TLS with the config c. The request line
+// is rewritten under TLS, so the dialer completes the handshake itself and
+// reports it to the client trace as the transport would.
+func http10TLSDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), c *tls.Config) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := c.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = hostname(addr)
+		}
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		err = tlsConn.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &http10Conn{Conn: tlsConn}, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,90 @@
+package tester
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// scheduleRun and scheduleReplay are recorded as the schedule of the
+	// requests paced by the run and by a replay file. Requests with a pace of
+	// their own record "request:<index>".
+	scheduleRun    = "run"
+	scheduleReplay = "replay"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// pacer paces a set of requests on a limiter of its own. All testers draw
+// from the same pacers, so the aggregate pace of each holds even when some
+// testers are slowed down by the target.
+type pacer struct {
+	name     string
+	interval time.Duration
+	limiter  *rate.Limiter
+	requests []request
+	// picked counts the requests picked so far, for round-robin.
+	picked atomic.Uint64
+}
+
+func newPacer(name string, p pace, requests []request) *pacer {
+	return &pacer{
+		name:     name,
+		interval: time.Minute / time.Duration(p),
+		limiter:  rate.NewLimiter(rate.Limit(float64(p)/60), 1),
+		requests: requests,
+	}
+}
+
+// newPacers returns the pacers of the run: one for the requests without a
+// pace of their own, at the pace of the run, and one for each request with
+// its own pace. The pacer of the run comes first, if any.
+func (s *service) newPacers() []*pacer {
+	if s.params.DialOnly {
+		return []*pacer{newPacer(scheduleRun, s.params.Pace, nil)}
+	}
+	var (
+		pacers []*pacer
+		shared []request
+	)
+	for i, r := range s.params.Requests {
+		if r.Pace == 0 {
+			shared = append(shared, r)
+			continue
+		}
+		pacers = append(pacers, newPacer(fmt.Sprintf("request:%d", i), r.Pace, []request{r}))
+	}
+	if len(shared) > 0 || len(pacers) == 0 {
+		pacers = append([]*pacer{newPacer(scheduleRun, s.params.Pace, shared)}, pacers...)
+	}
+	return pacers
+}
+
+// pick returns the next request of pc to send, the localN-th of its tester.
+// Round-robin follows the requests across all testers, while a sequence runs
+// through them within each tester.
+func (pc *pacer) pick(c choice, localN int, rnd *rand.Rand) request {
+	n := pc.picked.Add(1)
+	switch len(pc.requests) {
+	case 0:
+		return request{}
+	case 1:
+		return pc.requests[0]
+	}
+	switch c {
+	case "random":
+		return pc.requests[rnd.IntN(len(pc.requests))]
+	case "sequence":
+		return pc.requests[(localN-1)%len(pc.requests)]
+	default:
+		return pc.requests[(n-1)%uint64(len(pc.requests))]
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
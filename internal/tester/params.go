@@ -1,14 +1,26 @@
 package tester
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/ozla/hrtester/internal/config"
 	"github.com/ozla/hrtester/internal/log"
 	"github.com/ozla/hrtester/internal/shared"
 )
@@ -16,16 +28,118 @@ import (
 ////////////////////////////////////////////////////////////////////////////////
 
 type params struct {
-	Name            string          `json:"name"`
-	Duration        shared.Duration `json:"duration"`
-	Pace            pace            `json:"pace"`
-	ParallelTesters uint8           `json:"parallelTesters"`
-	Timeout         shared.Duration `json:"timeout"`
-	Choice          choice          `json:"choice"`
-	ReqSchema       schema          `json:"reqSchema"`
-	ReqVersion      version         `json:"reqVersion"`
-	ReqIDHeader     string          `json:"reqIDHeader"`
-	Requests        []request       `json:"requests"`
+	Name              string          `json:"name"`
+	Duration          shared.Duration `json:"duration"`
+	Pace              pace            `json:"pace"`
+	ParallelTesters   uint8           `json:"parallelTesters"`
+	InFlightPerTester uint8           `json:"inFlightPerTester"`
+	Timeout           shared.Duration `json:"timeout"`
+	LatencyBudget     shared.Duration `json:"latencyBudget"`
+	Choice            choice          `json:"choice"`
+	// Seed makes the random request choice reproducible. A random seed is
+	// picked when unset.
+	Seed              *uint64     `json:"seed"`
+	ReqSchema         schema      `json:"reqSchema"`
+	ReqVersion        version     `json:"reqVersion"`
+	ReqIDHeader       string      `json:"reqIDHeader"`
+	ReqIDFormat       idFormat    `json:"reqIDFormat"`
+	UserAgent         string      `json:"userAgent"`
+	Headers           http.Header `json:"headers"`
+	WarmupRequests    uint32      `json:"warmupRequests"`
+	WarmupConnections bool        `json:"warmupConnections"`
+
+	Spikes            []spike         `json:"spikes"`
+	RespectRetryAfter bool            `json:"respectRetryAfter"`
+	SuccessStatuses   successStatuses `json:"successStatuses"`
+	// Criteria decide whether each response passed, on its status, latency
+	// and body. Requests may have criteria of their own.
+	Criteria *criteria `json:"criteria"`
+	// AbortOnErrorRate ends the run early once the share of unsuccessful
+	// requests in the last AbortWindow exceeds it, after at least
+	// AbortMinRequests requests in the window. 0 disables it.
+	AbortOnErrorRate float64         `json:"abortOnErrorRate"`
+	AbortMinRequests uint32          `json:"abortMinRequests"`
+	AbortWindow      shared.Duration `json:"abortWindow"`
+	// BandwidthLimit caps the bytes per second each tester reads from
+	// response bodies, and writes as request bodies if ThrottleUploads is set.
+	BandwidthLimit  int64     `json:"bandwidthLimit"`
+	ThrottleUploads bool      `json:"throttleUploads"`
+	ReadBody        readBody  `json:"readBody"`
+	CaptureHeaders  []string  `json:"captureHeaders"`
+	Requests        []request `json:"requests"`
+	RequestsFile    string    `json:"requestsFile"`
+	ReplayFile      string    `json:"replayFile"`
+	ReplaySpeed     float64   `json:"replaySpeed"`
+	// ReplayFailures replays only the failed requests of ReplayFile, a
+	// collector output file, once each and right away.
+	ReplayFailures bool `json:"replayFailures"`
+	// ReplayDelimiter separates the fields of ReplayFile, as the
+	// collector's --delimiter flag; a comma if unset.
+	ReplayDelimiter string `json:"replayDelimiter"`
+
+	TLSMinVersion tlsVersion   `json:"tlsMinVersion"`
+	TLSMaxVersion tlsVersion   `json:"tlsMaxVersion"`
+	CipherSuites  cipherSuites `json:"cipherSuites"`
+
+	MaxIdleConns        int             `json:"maxIdleConns"`
+	MaxIdleConnsPerHost int             `json:"maxIdleConnsPerHost"`
+	IdleConnTimeout     shared.Duration `json:"idleConnTimeout"`
+	// MaxConnsPerHost caps the connections each tester opens to a host,
+	// dialing or in use; requests beyond it wait for a free connection.
+	MaxConnsPerHost int `json:"maxConnsPerHost"`
+	// MaxConns caps the connections all the testers open to the target,
+	// closing idle ones of other testers to make room. 0 sets no cap.
+	MaxConns int `json:"maxConns"`
+
+	// TCPNoDelay disables Nagle's algorithm on the connections to the target
+	// if true, Go's default, and enables it if false. TCPKeepAlive is the
+	// keep-alive period of the connections; 0 keeps Go's default of 15s and
+	// a negative period disables keep-alives.
+	TCPNoDelay   *bool           `json:"tcpNoDelay"`
+	TCPKeepAlive shared.Duration `json:"tcpKeepAlive"`
+
+	// ResultsBufferSize is the results buffer size per in-flight request,
+	// IDsBufferSize the number of request IDs generated ahead.
+	ResultsBufferSize int `json:"resultsBufferSize"`
+	IDsBufferSize     int `json:"idsBufferSize"`
+
+	// BodySamples keeps some response bodies for debugging.
+	BodySamples bodySamples `json:"bodySamples"`
+
+	// MeasurementWindow leaves the start and the end of the run out of its
+	// stats.
+	MeasurementWindow *measurementWindow `json:"measurementWindow"`
+
+	// CountWireBytes has the testers, rather than the transport, decode gzip
+	// and deflate bodies, so BodyBytes counts the compressed bytes on the
+	// wire and DecodedBytes the decoded ones.
+	CountWireBytes bool `json:"countWireBytes"`
+
+	// Host is sent as the Host header, and the server name over https, in
+	// place of the target. Requests may send a Host of their own.
+	Host string `json:"host"`
+
+	// CountHeaderBytes records the sizes of the request and the response
+	// headers in the ReqHeaderBytes and RespHeaderBytes columns.
+	CountHeaderBytes bool `json:"countHeaderBytes"`
+
+	// DialOnly opens a connection to the target each round, completing the
+	// TLS handshake over https, and closes it without sending a request.
+	DialOnly bool `json:"dialOnly"`
+
+	// WaitForTarget has the tester retry connecting to the target for up to
+	// this long before the run starts, for targets started along with it.
+	WaitForTarget shared.Duration `json:"waitForTarget"`
+
+	// Preflight sends each request once before the run starts, which fails
+	// to start if any gets a rejected status.
+	Preflight *preflight `json:"preflight"`
+
+	// headerRefs holds the secret references of Headers, resolved by
+	// prepare.
+	headerRefs http.Header
+	// conns enforces MaxConns, shared by the clients of the run.
+	conns *connLimiter
 }
 
 func (p *params) UnmarshalJSON(data []byte) error {
@@ -33,13 +147,25 @@ func (p *params) UnmarshalJSON(data []byte) error {
 
 	aux := struct {
 		alias
-		Requests []json.RawMessage `json:"requests"`
+		Headers  map[string]json.RawMessage `json:"headers"`
+		Requests []json.RawMessage          `json:"requests"`
 	}{}
-	if err := json.Unmarshal(data, &aux); err != nil {
+	if err := unmarshalStrict(data, &aux); err != nil {
 		return err
 	}
 
 	*p = params(aux.alias)
+	h, err := parseHeader(aux.Headers)
+	if err != nil {
+		return fmt.Errorf("invalid headers: %v", err)
+	}
+	p.Headers = h
+	if err := p.normalizeCaptureHeaders(); err != nil {
+		return fmt.Errorf("invalid captureHeaders: %v", err)
+	}
+	if err := validateHost(p.Host); err != nil {
+		return fmt.Errorf("invalid host: %v", err)
+	}
 	p.Requests = make([]request, len(aux.Requests))
 	for i, raw := range aux.Requests {
 		if err := json.Unmarshal(raw, &p.Requests[i]); err != nil {
@@ -55,13 +181,371 @@ func (p *params) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// decodeParams decodes the JSON params from r into p. Unknown fields are
+// errors, so that misspelled params surface instead of being ignored.
+func decodeParams(r io.Reader, p *params) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return describeJSONError(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the params object")
+	}
+	return nil
+}
+
+// unmarshalStrict is json.Unmarshal rejecting unknown fields. The decoder of
+// decodeParams cannot do it for the types unmarshaling themselves.
+func unmarshalStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return describeJSONError(dec.Decode(v))
+}
+
+// describeJSONError names the offending field in err, if any.
+func describeJSONError(err error) error {
+	var (
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Errorf("invalid %s: unexpected JSON %s", typeErr.Field, typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%v at offset %d", err, syntaxErr.Offset)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("unknown field %s", field)
+	}
+	return err
+}
+
+// indefinite reports whether the run lasts until it is stopped, as it has no
+// duration.
+func (p *params) indefinite() bool {
+	return p.Duration == 0
+}
+
+// capDuration holds p to max, unless 0: runs longer than max are invalid, and
+// runs without a duration get max as theirs.
+func (p *params) capDuration(max time.Duration) error {
+	switch {
+	case max <= 0:
+	case p.indefinite():
+		p.Duration = shared.Duration(max)
+	case time.Duration(p.Duration) > max:
+		return fmt.Errorf(
+			"duration: %v exceeds the maximum of %v",
+			time.Duration(p.Duration), max,
+		)
+	}
+	return nil
+}
+
+// prepare validates p, fills in the defaults and loads the files it refers
+// to. It returns the replay schedule, if p sets a replay file.
+func (p *params) prepare() ([]replayEntry, error) {
+	if p.Duration < 0 {
+		return nil, errors.New("service duration: must be >= 0")
+	}
+	if p.LatencyBudget < 0 {
+		return nil, errors.New("latency budget: must be >= 0")
+	}
+	if p.BandwidthLimit < 0 {
+		return nil, errors.New("bandwidth limit: must be >= 0")
+	}
+	if p.TLSMinVersion != 0 && p.TLSMaxVersion != 0 && p.TLSMinVersion > p.TLSMaxVersion {
+		return nil, errors.New("TLS versions: tlsMinVersion must be <= tlsMaxVersion")
+	}
+	if err := validateSpikes(p.Spikes); err != nil {
+		return nil, fmt.Errorf("spikes: %v", err)
+	}
+	if p.AbortOnErrorRate < 0 || p.AbortOnErrorRate >= 1 || p.AbortWindow < 0 {
+		return nil, errors.New("abort settings: abortOnErrorRate must be >= 0 and < 1, abortWindow >= 0")
+	}
+	if p.AbortOnErrorRate > 0 {
+		if p.AbortMinRequests == 0 {
+			p.AbortMinRequests = defaultAbortMinRequests
+		}
+		if p.AbortWindow == 0 {
+			p.AbortWindow = shared.Duration(defaultAbortWindow)
+		}
+	}
+	if p.Choice == "" {
+		p.Choice = "roundrobin"
+	}
+	if sc := schema(config.Tester.TargetScheme); sc != "" {
+		if p.ReqSchema != "" && p.ReqSchema != sc {
+			return nil, fmt.Errorf("reqSchema: '%s' conflicts with the scheme of the target, '%s'", p.ReqSchema, sc)
+		}
+		p.ReqSchema = sc
+	}
+	if p.ReqSchema == "" {
+		p.ReqSchema = "http"
+	}
+	if p.ReqVersion == [...]uint8{0, 0} {
+		p.ReqVersion = [...]uint8{1, 1}
+	}
+	if p.ReqIDHeader == "" {
+		p.ReqIDHeader = "X-Request-ID"
+	}
+	if p.ReqIDFormat == "" {
+		p.ReqIDFormat = "uuid"
+	}
+	if p.MaxIdleConns < 0 ||
+		p.MaxIdleConnsPerHost < 0 ||
+		p.MaxConnsPerHost < 0 ||
+		p.MaxConns < 0 ||
+		p.IdleConnTimeout < 0 {
+		return nil, errors.New("connection pool: maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost, maxConns and idleConnTimeout must be >= 0")
+	}
+	p.conns = nil
+	if p.MaxConns > 0 {
+		p.conns = newConnLimiter(p.MaxConns)
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = defaultMaxIdleConns
+	}
+	if p.InFlightPerTester == 0 {
+		p.InFlightPerTester = 1
+	}
+	if p.MaxIdleConnsPerHost == 0 {
+		p.MaxIdleConnsPerHost = int(p.ParallelTesters) * int(p.InFlightPerTester)
+	}
+	if p.IdleConnTimeout == 0 {
+		p.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if p.MaxConnsPerHost == 0 {
+		// A tester has up to inFlightPerTester requests in flight for the
+		// pace of the run and for each request paced on its own.
+		pacers := 1
+		for _, r := range p.Requests {
+			if r.Pace > 0 {
+				pacers++
+			}
+		}
+		p.MaxConnsPerHost = int(p.InFlightPerTester) * pacers
+	}
+	if err := p.BodySamples.prepare(); err != nil {
+		return nil, fmt.Errorf("body samples: %v", err)
+	}
+	if p.ResultsBufferSize < 0 || p.IDsBufferSize < 0 {
+		return nil, errors.New("buffers: resultsBufferSize and idsBufferSize must be >= 0")
+	}
+	// The results buffer holds resultsBufferSize results per tester and
+	// in-flight request.
+	inFlight := max(1, int(p.ParallelTesters)) * int(p.InFlightPerTester)
+	if p.ResultsBufferSize == 0 {
+		p.ResultsBufferSize = max(1, min(defaultResultsBufferSize, maxResultsBuffer/inFlight))
+	}
+	if p.ResultsBufferSize > maxResultsBuffer/inFlight {
+		return nil, fmt.Errorf(
+			"buffers: resultsBufferSize must be <= %d for %d testers with %d requests in flight",
+			maxResultsBuffer/inFlight, max(1, int(p.ParallelTesters)), p.InFlightPerTester,
+		)
+	}
+	if p.IDsBufferSize == 0 {
+		p.IDsBufferSize = defaultIDsBufferSize
+	}
+	if p.IDsBufferSize > maxIDsBuffer {
+		return nil, fmt.Errorf("buffers: idsBufferSize must be <= %d", maxIDsBuffer)
+	}
+	if p.RequestsFile != "" {
+		rs, err := loadRequests(p.RequestsFile)
+		if err != nil {
+			return nil, fmt.Errorf("requests file: %v", err)
+		}
+		// Inline requests come first, followed by those from the file.
+		p.Requests = append(p.Requests, rs...)
+	}
+	// Requests without a method send GET, which the params then show.
+	for i := range p.Requests {
+		if p.Requests[i].Method == "" {
+			p.Requests[i].Method = http.MethodGet
+		}
+	}
+	if err := p.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("secrets: %v", err)
+	}
+	if err := loadRequestCerts(p.Requests); err != nil {
+		return nil, fmt.Errorf("request certificate: %v", err)
+	}
+	if p.DialOnly && (p.ReplayFile != "" || p.WarmupConnections) {
+		return nil, errors.New("dialOnly: does not go with replayFile or warmupConnections")
+	}
+	if p.WaitForTarget < 0 {
+		return nil, errors.New("waitForTarget: must be >= 0")
+	}
+	if p.DialOnly && p.Preflight != nil {
+		return nil, errors.New("preflight: dial-only runs send no requests")
+	}
+	if p.DialOnly && p.Criteria.checksBody() {
+		return nil, errors.New("criteria: dial-only runs have no body to check")
+	}
+	// Connections are opened without requests in dial-only runs.
+	if len(p.Requests) == 0 && p.ReplayFile == "" && !p.DialOnly {
+		return nil, errors.New("requests: none defined, set requests, requestsFile or replayFile")
+	}
+	if p.Choice == "sequence" && p.InFlightPerTester > 1 {
+		return nil, errors.New("choice: 'sequence' requires inFlightPerTester 1")
+	}
+	for _, r := range p.Requests {
+		if r.Pace > 0 && (p.Choice == "sequence" || p.ReplayFile != "") {
+			return nil, errors.New("requests: a pace of their own does not go with choice 'sequence' or replayFile")
+		}
+		// The server name over https follows the host of the params for
+		// all requests.
+		if r.URL != "" && p.Host != "" {
+			return nil, errors.New("host: does not go with requests of an absolute url, set the host of the requests instead")
+		}
+	}
+	if p.Choice != "sequence" {
+		for _, r := range p.Requests {
+			if len(r.Capture) > 0 {
+				return nil, errors.New("requests: capture requires choice 'sequence'")
+			}
+		}
+	}
+	var schedule []replayEntry
+	if p.ReplayFile != "" {
+		if p.ReplaySpeed == 0 {
+			p.ReplaySpeed = 1
+		}
+		if p.ReplaySpeed < 0 {
+			return nil, errors.New("replay speed: must be > 0")
+		}
+		comma := ','
+		if p.ReplayDelimiter != "" {
+			var err error
+			if comma, err = shared.ParseDelimiter(p.ReplayDelimiter); err != nil {
+				return nil, fmt.Errorf("replay delimiter: %v", err)
+			}
+		}
+		var err error
+		if schedule, err = loadSchedule(p.ReplayFile, p.ReplaySpeed, p.ReplayFailures, comma); err != nil {
+			return nil, fmt.Errorf("replay file: %v", err)
+		}
+		// Replayed failures are all due at once; the run ends with the
+		// last of them.
+		if p.Duration == 0 && !p.ReplayFailures {
+			p.Duration = shared.Duration(schedule[len(schedule)-1].At) + p.Timeout
+		}
+	} else if p.ReplayFailures {
+		return nil, errors.New("replayFailures: requires replayFile")
+	} else if p.ReplayDelimiter != "" {
+		return nil, errors.New("replayDelimiter: requires replayFile")
+	}
+	if w := p.MeasurementWindow; w != nil {
+		if err := w.validate(time.Duration(p.Duration)); err != nil {
+			return nil, fmt.Errorf("measurementWindow: %v", err)
+		}
+	}
+	if p.Seed == nil {
+		seed := rand.Uint64()
+		p.Seed = &seed
+	}
+	return schedule, nil
+}
+
+// normalizeCaptureHeaders canonicalizes the captured response header names and
+// rejects duplicates and lists longer than maxCaptureHeaders.
+func (p *params) normalizeCaptureHeaders() error {
+	if len(p.CaptureHeaders) > maxCaptureHeaders {
+		return fmt.Errorf("at most %d headers can be captured", maxCaptureHeaders)
+	}
+	seen := make(map[string]bool, len(p.CaptureHeaders))
+	for i, n := range p.CaptureHeaders {
+		if n == "" {
+			return fmt.Errorf("empty header name at index %d", i)
+		}
+		n = http.CanonicalHeaderKey(n)
+		if seen[n] {
+			return fmt.Errorf("duplicate header '%s'", n)
+		}
+		seen[n] = true
+		p.CaptureHeaders[i] = n
+	}
+	return nil
+}
+
+// loadRequests reads a JSON file containing an array of request objects, or
+// a YAML file if its name ends in .yaml or .yml.
+func loadRequests(fn string) ([]request, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	if shared.IsYAMLFile(fn) {
+		if b, err = shared.YAMLToJSON(b); err != nil {
+			return nil, err
+		}
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return nil, err
+	}
+
+	rs := make([]request, len(raws))
+	for i, raw := range raws {
+		if err := json.Unmarshal(raw, &rs[i]); err != nil {
+			return nil, fmt.Errorf("invalid request at index %d: %v", i, err)
+		}
+	}
+
+	return rs, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 type request struct {
 	Method method      `json:"method"`
 	Path   string      `json:"path"`
 	Header http.Header `json:"header"`
-	Body   string      `json:"body"`
+	// Query is merged into the query string of Path, if any.
+	Query url.Values `json:"query"`
+	Body  string     `json:"body"`
+	Cert  string     `json:"cert"`
+	Key   string     `json:"key"`
+
+	// LatencyBudget overrides the default latency budget of the params.
+	LatencyBudget shared.Duration `json:"latencyBudget"`
+	// Timeout overrides the timeout of the params, unless 0.
+	Timeout shared.Duration `json:"timeout"`
+	// Pace sends the request at a pace of its own, apart from the requests
+	// sharing the pace of the run.
+	Pace pace `json:"pace"`
+	// Criteria override the criteria of the params.
+	Criteria *criteria `json:"criteria"`
+
+	// Capture extracts values from the response, which later requests of the
+	// same sequence iteration reference as {{.Captured.name}}.
+	Capture []capture `json:"capture"`
+
+	// Host overrides the Host header of the params. The server name over
+	// https stays that of the params.
+	Host string `json:"host"`
+
+	// BodySize streams a generated body of that many bytes instead of Body,
+	// with Transfer-Encoding: chunked if Chunked is set.
+	BodySize int64 `json:"bodySize"`
+	Chunked  bool  `json:"chunked"`
+
+	// URL sends the request to an absolute http or https URL instead of Path
+	// on the target, with the scheme of the URL over that of the params.
+	URL string `json:"url"`
+
+	certificate *tls.Certificate
+	templates   map[string]*template.Template
+	// headerRefs and bodyRef hold the secret references of Header and Body,
+	// resolved by prepare.
+	headerRefs http.Header
+	bodyRef    string
+	// url is URL parsed.
+	url *url.URL
 }
 
 func (r *request) UnmarshalJSON(data []byte) error {
@@ -70,33 +554,202 @@ func (r *request) UnmarshalJSON(data []byte) error {
 	aux := struct {
 		alias
 		Header map[string]json.RawMessage `json:"header"`
+		Query  map[string]json.RawMessage `json:"query"`
 	}{}
-	if err := json.Unmarshal(data, &aux); err != nil {
+	if err := unmarshalStrict(data, &aux); err != nil {
 		return err
 	}
 
 	*r = request(aux.alias)
-	r.Header = make(http.Header, len(aux.Header))
-	for k, raw := range aux.Header {
+	if r.BodySize < 0 {
+		return fmt.Errorf("invalid bodySize: must be >= 0")
+	}
+	if r.LatencyBudget < 0 {
+		return fmt.Errorf("invalid latencyBudget: must be >= 0")
+	}
+	if r.Timeout < 0 {
+		return fmt.Errorf("invalid timeout: must be >= 0")
+	}
+	if r.BodySize > 0 && r.Body != "" {
+		return fmt.Errorf("bodySize and body are mutually exclusive")
+	}
+	if err := validateHost(r.Host); err != nil {
+		return fmt.Errorf("invalid host: %v", err)
+	}
+	if r.URL != "" {
+		if r.Path != "" {
+			return fmt.Errorf("url and path are mutually exclusive")
+		}
+		u, err := parseRequestURL(r.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %v", err)
+		}
+		r.url = u
+	}
+	h, err := parseHeader(aux.Header)
+	if err != nil {
+		return err
+	}
+	r.Header = h
+	if r.Query, err = parseQuery(aux.Query); err != nil {
+		return err
+	}
+	for _, c := range r.Capture {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	if r.templates, err = compileTemplates(*r); err != nil {
+		return fmt.Errorf("invalid template: %v", err)
+	}
+
+	return nil
+}
+
+// validateHost checks that h, if set, is a host with an optional port, as sent
+// in the Host header.
+func validateHost(h string) error {
+	if h == "" {
+		return nil
+	}
+	if strings.ContainsAny(h, "/?#@ \t") {
+		return fmt.Errorf("'%s' must be a host with an optional port, without a scheme or path", h)
+	}
+	if _, err := url.Parse("http://" + h); err != nil {
+		return fmt.Errorf("'%s' is not a valid host", h)
+	}
+	return nil
+}
+
+// parseRequestURL parses the absolute URL of a request, which has an http or
+// https scheme and a host, and no credentials, fragment or templates.
+func parseRequestURL(raw string) (*url.URL, error) {
+	if strings.Contains(raw, "{{") {
+		return nil, fmt.Errorf("'%s' must not be a template", raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return nil, fmt.Errorf("'%s' must be an http or https URL", raw)
+	case u.Host == "":
+		return nil, fmt.Errorf("'%s' has no host", raw)
+	case u.User != nil:
+		return nil, fmt.Errorf("'%s' must not carry credentials, set an Authorization header instead", raw)
+	case u.Fragment != "":
+		return nil, fmt.Errorf("'%s' must not have a fragment", raw)
+	}
+	return u, nil
+}
+
+// parseHeader builds a header from JSON values that are either a string or an
+// array of strings.
+func parseHeader(raws map[string]json.RawMessage) (http.Header, error) {
+	h := make(http.Header, len(raws))
+
+	keys := make([]string, 0, len(raws))
+	for k := range raws {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	seen := make(map[string]string, len(keys))
+	for _, k := range keys {
+		ck := http.CanonicalHeaderKey(k)
+		if prev, ok := seen[ck]; ok {
+			return nil, fmt.Errorf("conflicting header keys '%s' and '%s'", prev, k)
+		}
+		seen[ck] = k
+	}
+
+	for k, raw := range raws {
 		var parsed any
 		if err := json.Unmarshal(raw, &parsed); err != nil {
-			return fmt.Errorf("invalid header %s value: %v", k, err)
+			return nil, fmt.Errorf("invalid header %s value: %v", k, err)
 		}
 		switch v := parsed.(type) {
 		case string:
-			r.Header.Set(k, v)
+			h.Set(k, v)
 		case []any:
 			for _, v := range v {
 				if s, ok := v.(string); ok {
-					r.Header.Add(k, s)
+					h.Add(k, s)
 				} else {
-					return fmt.Errorf("invalid header %s value", k)
+					return nil, fmt.Errorf("invalid header %s value", k)
 				}
 			}
 		}
 	}
 
-	return nil
+	return h, nil
+}
+
+// parseQuery builds query parameters from JSON values that are either a
+// string or an array of strings. Keys and values must not be empty.
+func parseQuery(raws map[string]json.RawMessage) (url.Values, error) {
+	if len(raws) == 0 {
+		return nil, nil
+	}
+	q := make(url.Values, len(raws))
+	for k, raw := range raws {
+		if k == "" {
+			return nil, fmt.Errorf("invalid query: empty key")
+		}
+		var vs []string
+		if err := json.Unmarshal(raw, &vs); err != nil {
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("invalid query %s value: must be a string or an array of strings", k)
+			}
+			vs = []string{v}
+		}
+		if len(vs) == 0 {
+			return nil, fmt.Errorf("invalid query %s value: empty array", k)
+		}
+		for _, v := range vs {
+			if v == "" {
+				return nil, fmt.Errorf("invalid query %s value: empty string", k)
+			}
+		}
+		q[k] = vs
+	}
+	return q, nil
+}
+
+// targetURL returns the URL of r on host, with Query merged into the query
+// string of Path. Requests with an absolute URL go there instead.
+func (r request) targetURL(scheme schema, host string) *url.URL {
+	var u *url.URL
+	if r.url != nil {
+		c := *r.url
+		u = &c
+	} else {
+		path, rawQuery, _ := strings.Cut(r.Path, "?")
+		u = &url.URL{
+			Scheme:   string(scheme),
+			Host:     host,
+			Path:     path,
+			RawQuery: rawQuery,
+		}
+	}
+	if len(r.Query) > 0 {
+		q, _ := url.ParseQuery(u.RawQuery)
+		for k, vs := range r.Query {
+			q[k] = append(q[k], vs...)
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u
+}
+
+// path returns the path r is recorded and logged under: Path, or the path and
+// query of its absolute URL.
+func (r request) path() string {
+	if r.url != nil {
+		return r.url.RequestURI()
+	}
+	return r.Path
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -133,10 +786,10 @@ type choice string
 
 func (c choice) MarshalJSON() ([]byte, error) {
 	switch c {
-	case "roundrobin", "random":
+	case "roundrobin", "random", "sequence":
 		return []byte(`"` + string(c) + `"`), nil
 	default:
-		return nil, fmt.Errorf("invalid choice value: must be 'roundrobin' or 'random'")
+		return nil, fmt.Errorf("invalid choice value: must be 'roundrobin', 'random' or 'sequence'")
 	}
 }
 
@@ -147,11 +800,39 @@ func (c *choice) UnmarshalJSON(data []byte) error {
 	}
 
 	switch s {
-	case "roundrobin", "random":
+	case "roundrobin", "random", "sequence":
 		*c = choice(s)
 		return nil
 	default:
-		return fmt.Errorf("invalid choice value: must be 'roundrobin' or 'random'")
+		return fmt.Errorf("invalid choice value: must be 'roundrobin', 'random' or 'sequence'")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type idFormat string
+
+func (f idFormat) MarshalJSON() ([]byte, error) {
+	switch f {
+	case "uuid", "sequential", "traceparent":
+		return []byte(`"` + string(f) + `"`), nil
+	default:
+		return nil, fmt.Errorf("invalid reqIDFormat value: must be 'uuid', 'sequential' or 'traceparent'")
+	}
+}
+
+func (f *idFormat) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid JSON string: %v", err)
+	}
+
+	switch s {
+	case "uuid", "sequential", "traceparent":
+		*f = idFormat(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid reqIDFormat value: must be 'uuid', 'sequential' or 'traceparent'")
 	}
 }
 
@@ -226,6 +907,100 @@ func (v *version) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// http10 reports whether v is HTTP/1.0, which has no keep-alive.
+func (v version) http10() bool {
+	return v == version{1, 0}
+}
+
+// apply sets the protocol of req to v. HTTP/1.0 requests ask the target to
+// close the connection after the response; the client of the params writes
+// their request line, see http10Conn.
+func (v version) apply(req *http.Request) {
+	if !v.http10() {
+		return
+	}
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+	req.Close = true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersion is a TLS protocol version given as "1.0" to "1.3".
+type tlsVersion uint16
+
+func (v tlsVersion) MarshalJSON() ([]byte, error) {
+	if v == 0 {
+		return []byte("null"), nil
+	}
+	for s, id := range tlsVersions {
+		if id == uint16(v) {
+			return json.Marshal(s)
+		}
+	}
+	return nil, fmt.Errorf("invalid TLS version: %#04x", uint16(v))
+}
+
+func (v *tlsVersion) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid JSON string: %v", err)
+	}
+
+	id, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("invalid TLS version '%s': must be '1.0', '1.1', '1.2' or '1.3'", s)
+	}
+	*v = tlsVersion(id)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// cipherSuites holds TLS 1.0-1.2 cipher suites given by their crypto/tls
+// names, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". TLS 1.3 suites are not
+// configurable.
+type cipherSuites []uint16
+
+func (cs cipherSuites) MarshalJSON() ([]byte, error) {
+	names := make([]string, len(cs))
+	for i, id := range cs {
+		names[i] = tls.CipherSuiteName(id)
+	}
+	return json.Marshal(names)
+}
+
+func (cs *cipherSuites) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("invalid JSON array of strings: %v", err)
+	}
+
+	known := make(map[string]*tls.CipherSuite)
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[c.Name] = c
+	}
+	ids := make(cipherSuites, len(names))
+	for i, n := range names {
+		c, ok := known[n]
+		if !ok {
+			return fmt.Errorf("unknown cipher suite '%s'", n)
+		}
+		if !slices.ContainsFunc(c.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 }) {
+			return fmt.Errorf("cipher suite '%s' is TLS 1.3 only and cannot be configured", n)
+		}
+		ids[i] = c.ID
+	}
+	*cs = ids
+	return nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 type pace uint16
@@ -281,4 +1056,16 @@ func (p pace) String() string {
 	return strconv.FormatUint(uint64(p), 10) + "rpm"
 }
 
+// rpm is a measured rate in requests per minute, shown like a pace but beyond
+// its range.
+type rpm uint64
+
+func (r rpm) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + r.String() + `"`), nil
+}
+
+func (r rpm) String() string {
+	return strconv.FormatUint(uint64(r), 10) + "rpm"
+}
+
 ////////////////////////////////////////////////////////////////////////////////
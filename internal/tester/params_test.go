@@ -1,8 +1,17 @@
 package tester
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
 )
 
 func TestParams(t *testing.T) {
@@ -41,3 +50,364 @@ func TestParams(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCapDuration(t *testing.T) {
+	for _, c := range []struct {
+		duration, max, want time.Duration
+		ok                  bool
+	}{
+		{0, 0, 0, true},
+		{time.Hour, 0, time.Hour, true},
+		{0, time.Hour, time.Hour, true},
+		{time.Minute, time.Hour, time.Minute, true},
+		{time.Hour, time.Hour, time.Hour, true},
+		{2 * time.Hour, time.Hour, 0, false},
+	} {
+		p := params{Duration: shared.Duration(c.duration)}
+		err := p.capDuration(c.max)
+		if (err == nil) != c.ok || c.ok && time.Duration(p.Duration) != c.want {
+			t.Errorf("duration %v, max %v: unexpected duration %v, error %v", c.duration, c.max, p.Duration, err)
+		}
+	}
+}
+
+func TestStrictParams(t *testing.T) {
+	for raw, want := range map[string]string{
+		`{"pase": "10rps"}`:                           `unknown field "pase"`,
+		`{"requests": [{"path": "/a", "heder": {}}]}`: `invalid request at index 0: unknown field "heder"`,
+		`{"parallelTesters": "4"}`:                    `invalid parallelTesters: unexpected JSON string`,
+		`{"bodySamples": {"rat": 0.1}}`:               `unknown field "rat"`,
+		`{"name": "a"} {"name": "b"}`:                 `unexpected data after the params object`,
+	} {
+		var p params
+		if err := decodeParams(strings.NewReader(raw), &p); err == nil || err.Error() != want {
+			t.Errorf("%s: expected %q, got %v", raw, want, err)
+		}
+	}
+}
+
+func TestLoadRequests(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "requests.json")
+	raw := []byte(`
+[
+  {"method": "GET", "path": "/a", "header": {"X-Test": ["a", "b"]}},
+  {"method": "POST", "path": "/b", "body": "{}"}
+]
+`)
+	if err := os.WriteFile(fn, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := loadRequests(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[1].Method != "POST" || rs[1].Body != "{}" {
+		t.Errorf("unexpected requests: %+v", rs)
+	}
+	if ss := rs[0].Header.Values("X-Test"); len(ss) != 2 || ss[1] != "b" {
+		t.Errorf("unexpected header values: %v", ss)
+	}
+
+	if err := os.WriteFile(fn, []byte(`[{"method": "FETCH"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRequests(fn); err == nil {
+		t.Error("expected error for invalid method")
+	}
+}
+
+func TestLoadRequestsYAML(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "requests.yaml")
+	raw := []byte(`
+# Health check first, then a write.
+- method: GET
+  path: /a
+  header:
+    X-Test: [a, b]
+- method: POST
+  path: /b
+  body: "{}"
+  latencyBudget: 200ms
+  timeout: 5s
+`)
+	if err := os.WriteFile(fn, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := loadRequests(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[1].Method != "POST" || rs[1].Body != "{}" {
+		t.Errorf("unexpected requests: %+v", rs)
+	}
+	if ss := rs[0].Header.Values("X-Test"); len(ss) != 2 || ss[1] != "b" {
+		t.Errorf("unexpected header values: %v", ss)
+	}
+	if rs[1].LatencyBudget != shared.Duration(200*time.Millisecond) {
+		t.Errorf("unexpected latency budget: %v", rs[1].LatencyBudget)
+	}
+	if rs[1].Timeout != shared.Duration(5*time.Second) {
+		t.Errorf("unexpected timeout: %v", rs[1].Timeout)
+	}
+}
+
+func TestRequestConflictingHeaders(t *testing.T) {
+	raw := []byte(`
+{
+  "method": "POST",
+  "path": "/",
+  "header": {
+    "content-type": "text/plain",
+    "Content-Type": "application/json"
+  }
+}
+`)
+	var r request
+	err := json.Unmarshal(raw, &r)
+	if err == nil {
+		t.Fatal("expected error for conflicting header keys")
+	}
+	if !strings.Contains(err.Error(), "'Content-Type' and 'content-type'") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	var p params
+	raw := []byte(`{"captureHeaders": ["x-instance-id", "X-Trace"], "requests": []}`)
+	if err := json.Unmarshal(raw, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.CaptureHeaders[0] != "X-Instance-Id" || p.CaptureHeaders[1] != "X-Trace" {
+		t.Errorf("unexpected header names: %v", p.CaptureHeaders)
+	}
+
+	for _, raw := range []string{
+		`{"captureHeaders": ["X-A", "x-a"]}`,
+		`{"captureHeaders": ["A", "B", "C", "D", "E"]}`,
+		`{"captureHeaders": [""]}`,
+	} {
+		if err := json.Unmarshal([]byte(raw), &params{}); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestTLSParams(t *testing.T) {
+	var p params
+	raw := []byte(`{
+  "tlsMinVersion": "1.2",
+  "tlsMaxVersion": "1.3",
+  "cipherSuites": ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]
+}`)
+	if err := json.Unmarshal(raw, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.TLSMinVersion != tls.VersionTLS12 || p.TLSMaxVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected versions: %v, %v", p.TLSMinVersion, p.TLSMaxVersion)
+	}
+	if len(p.CipherSuites) != 1 || p.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites: %v", p.CipherSuites)
+	}
+	b, err := json.Marshal(p.CipherSuites)
+	if err != nil || string(b) != `["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]` {
+		t.Errorf("unexpected marshaled cipher suites: %s, %v", b, err)
+	}
+
+	for _, raw := range []string{
+		`{"tlsMinVersion": "1.4"}`,
+		`{"cipherSuites": ["TLS_NOPE"]}`,
+		`{"cipherSuites": ["TLS_AES_128_GCM_SHA256"]}`,
+	} {
+		if err := json.Unmarshal([]byte(raw), &params{}); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestRequestQuery(t *testing.T) {
+	raw := []byte(`{
+  "method": "GET",
+  "path": "/search?lang=en",
+  "query": {"q": "a b&c", "tag": ["x", "y"], "n": "{{.RequestNum}}"}
+}`)
+	var r request
+	if err := json.Unmarshal(raw, &r); err != nil {
+		t.Fatal(err)
+	}
+	r, err := r.render(templateData{RequestNum: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := r.targetURL("http", "localhost")
+	if u.Path != "/search" {
+		t.Errorf("unexpected path: %s", u.Path)
+	}
+	if got := u.RawQuery; got != "lang=en&n=7&q=a+b%26c&tag=x&tag=y" {
+		t.Errorf("unexpected query: %s", got)
+	}
+
+	for _, raw := range []string{
+		`{"method": "GET", "path": "/", "query": {"": "a"}}`,
+		`{"method": "GET", "path": "/", "query": {"a": ""}}`,
+		`{"method": "GET", "path": "/", "query": {"a": []}}`,
+		`{"method": "GET", "path": "/", "query": {"a": 1}}`,
+	} {
+		if err := json.Unmarshal([]byte(raw), &request{}); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestTargetScheme(t *testing.T) {
+	defer func(sc string) { config.Tester.TargetScheme = sc }(config.Tester.TargetScheme)
+	config.Tester.TargetScheme = "https"
+	for _, tc := range []struct {
+		raw string
+		ok  bool
+	}{
+		{`{"requests": [{"path": "/"}]}`, true},
+		{`{"reqSchema": "https", "requests": [{"path": "/"}]}`, true},
+		{`{"reqSchema": "http", "requests": [{"path": "/"}]}`, false},
+	} {
+		var p params
+		if err := json.Unmarshal([]byte(tc.raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.prepare(); (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected error: %v", tc.raw, err)
+		} else if tc.ok && p.ReqSchema != "https" {
+			t.Errorf("%s: expected the scheme of the target, got %s", tc.raw, p.ReqSchema)
+		}
+	}
+}
+
+func TestBufferSizes(t *testing.T) {
+	prepare := func(raw string) (params, error) {
+		var p params
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		_, err := p.prepare()
+		return p, err
+	}
+
+	p, err := prepare(`{"requests": [{"method": "GET", "path": "/"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ResultsBufferSize != defaultResultsBufferSize || p.IDsBufferSize != defaultIDsBufferSize {
+		t.Errorf("expected default buffer sizes, got %d and %d", p.ResultsBufferSize, p.IDsBufferSize)
+	}
+
+	p, err = prepare(`{"resultsBufferSize": 200, "idsBufferSize": 1000, "requests": [{"method": "GET", "path": "/"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ResultsBufferSize != 200 || p.IDsBufferSize != 1000 {
+		t.Errorf("unexpected buffer sizes %d and %d", p.ResultsBufferSize, p.IDsBufferSize)
+	}
+
+	if _, err := prepare(`{"resultsBufferSize": -1, "requests": [{"method": "GET", "path": "/"}]}`); err == nil || !strings.Contains(err.Error(), ">= 0") {
+		t.Errorf("expected error for a negative buffer size, got %v", err)
+	}
+	for _, raw := range []string{
+		`{"resultsBufferSize": 9223372036854775807, "requests": [{"method": "GET", "path": "/"}]}`,
+		`{"parallelTesters": 255, "inFlightPerTester": 255, "resultsBufferSize": 100, "requests": [{"method": "GET", "path": "/"}]}`,
+		`{"idsBufferSize": 9223372036854775807, "requests": [{"method": "GET", "path": "/"}]}`,
+	} {
+		if _, err := prepare(raw); err == nil {
+			t.Errorf("expected error for an oversized buffer: %s", raw)
+		}
+	}
+	// The default shrinks to fit the bound.
+	p, err = prepare(`{"parallelTesters": 255, "inFlightPerTester": 255, "requests": [{"method": "GET", "path": "/"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := int(p.ParallelTesters) * int(p.InFlightPerTester) * p.ResultsBufferSize; n > maxResultsBuffer {
+		t.Errorf("expected at most %d buffered results, got %d", maxResultsBuffer, n)
+	}
+}
+
+func TestRoundRobinAcrossTesters(t *testing.T) {
+	pc := newPacer(scheduleRun, 60, []request{{Path: "/a"}, {Path: "/b"}, {Path: "/c"}})
+	var (
+		mu     sync.Mutex
+		counts = map[string]int{}
+		wg     sync.WaitGroup
+	)
+	// Testers send uneven shares, which must not skew the distribution.
+	for tester := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for localN := 1; localN <= 10*(tester+1); localN++ {
+				r := pc.pick("roundrobin", localN, nil)
+				mu.Lock()
+				counts[r.Path]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if counts["/a"] != 34 || counts["/b"] != 33 || counts["/c"] != 33 {
+		t.Errorf("expected an even distribution of 100 requests, got %v", counts)
+	}
+	pc = newPacer(scheduleRun, 60, pc.requests)
+	if r := pc.pick("roundrobin", 7, nil); r.Path != "/a" {
+		t.Errorf("expected the first request of the run to be the first defined, got %s", r.Path)
+	}
+}
+
+func TestRequestPaces(t *testing.T) {
+	var p params
+	raw := `{"pace":"60rpm","requests":[{"path":"/a"},{"path":"/health","pace":"1rps"},{"path":"/b"},{"path":"/heavy","pace":"6rpm"}]}`
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		t.Fatal(err)
+	}
+	s := &service{params: p}
+	pacers := s.newPacers()
+	if len(pacers) != 3 {
+		t.Fatalf("expected 3 pacers, got %d", len(pacers))
+	}
+	for i, want := range []struct {
+		name     string
+		interval time.Duration
+		paths    int
+	}{
+		{scheduleRun, time.Second, 2},
+		{"request:1", time.Second, 1},
+		{"request:3", 10 * time.Second, 1},
+	} {
+		if pc := pacers[i]; pc.name != want.name || pc.interval != want.interval || len(pc.requests) != want.paths {
+			t.Errorf("unexpected pacer %d: %s every %v with %d requests", i, pc.name, pc.interval, len(pc.requests))
+		}
+	}
+
+	p.Choice = "sequence"
+	if _, err := p.prepare(); err == nil {
+		t.Error("expected request paces to be rejected with choice 'sequence'")
+	}
+}
+
+func TestHighPace(t *testing.T) {
+	for _, p := range []pace{40000, 65535} {
+		pc := newPacer(scheduleRun, p, nil)
+		// Over a second the limiter lets through the pace, and not the
+		// rate of a whole number of milliseconds.
+		now := time.Now()
+		n := 0
+		for n <= int(p) && pc.limiter.ReserveN(now, 1).DelayFrom(now) < time.Second {
+			n++
+		}
+		if want := int(p) / 60; n < want || n > want+1 {
+			t.Errorf("%drpm: expected about %d requests in a second, got %d", p, want, n)
+		}
+		if pc.interval <= 0 {
+			t.Errorf("%drpm: expected a positive interval, got %v", p, pc.interval)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// preflightTimeout bounds each preflight request of requests without a
+// timeout.
+const preflightTimeout = 10 * time.Second
+
+// defaultRejectStatuses are the statuses that fail a preflight check unless
+// the params say otherwise: those of a mistyped path or method.
+var defaultRejectStatuses = successStatuses{{404, 404}, {405, 405}, {501, 501}}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// preflight sends each request once before a run starts, and fails the start
+// if any gets a rejected status or no response at all.
+type preflight struct {
+	// RejectStatuses are the statuses that fail the check, 404, 405 and 501
+	// if unset.
+	RejectStatuses successStatuses `json:"rejectStatuses"`
+}
+
+func (pf *preflight) UnmarshalJSON(data []byte) error {
+	type alias preflight
+
+	var aux alias
+	if err := unmarshalStrict(data, &aux); err != nil {
+		return err
+	}
+	*pf = preflight(aux)
+	return nil
+}
+
+func (pf *preflight) rejects(code int) bool {
+	statuses := pf.RejectStatuses
+	if len(statuses) == 0 {
+		statuses = defaultRejectStatuses
+	}
+	return statuses.match(code)
+}
+
+// preflight returns the preflight check of p, the default one if the tester
+// validates every run, or nil if there is none.
+func (p *params) preflight() *preflight {
+	switch {
+	case p.Preflight != nil:
+		return p.Preflight
+	case config.Tester.Validate && !p.DialOnly:
+		return &preflight{}
+	}
+	return nil
+}
+
+// runPreflight sends each request of p once, in order, and returns an error
+// naming every request that failed the check.
+func (s *service) runPreflight(ctx context.Context, p *params, pf *preflight, logger *log.Logger) error {
+	cs := s.newClients(p)
+	defer func() {
+		for _, c := range cs {
+			c.CloseIdleConnections()
+		}
+	}()
+
+	var errs []error
+	for i, r := range p.Requests {
+		code, err := s.preflightRequest(ctx, p, cs.get(r), i, r)
+		if err == nil && pf.rejects(code) {
+			err = fmt.Errorf("status %d", code)
+		}
+		if err != nil {
+			m := string(r.Method)
+			logger.Error(
+				"preflight request failed", err,
+				slog.Int("index", i),
+				slog.String("method", m),
+				slog.String("path", r.path()),
+			)
+			errs = append(errs, fmt.Errorf("request at index %d (%s %s): %v", i, m, r.path(), err))
+			continue
+		}
+		logger.Debug(
+			"preflight request passed",
+			slog.Int("index", i),
+			slog.Int("status", code),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// preflightRequest sends r, the request of p at index i, and returns the
+// status of the response. Templates are rendered without captured values.
+func (s *service) preflightRequest(ctx context.Context, p *params, c *http.Client, i int, r request) (int, error) {
+	id := fmt.Sprintf("preflight-%d", i)
+	if r.templates != nil {
+		var err error
+		if r, err = r.render(templateData{RequestID: id}); err != nil {
+			return 0, fmt.Errorf("rendering templates: %v", err)
+		}
+	}
+	timeout := p.requestTimeout(r)
+	if timeout <= 0 {
+		timeout = preflightTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body io.Reader = strings.NewReader(r.Body)
+	if r.BodySize > 0 {
+		body = &fillReader{n: r.BodySize}
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, string(r.Method), r.targetURL(p.ReqSchema, s.target).String(), body,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if r.BodySize > 0 {
+		req.ContentLength = r.BodySize
+	}
+	p.setRequest(req, r)
+	req.Header.Add(p.ReqIDHeader, id)
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxCriteriaBody))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,114 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/log"
+)
+
+func TestPreflight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/ro":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name     string
+		raw      string
+		wantErrs []string
+	}{
+		{
+			"defaults",
+			`{"requests": [{"path": "/ok"}, {"path": "/busy"}, {"path": "/typo"}, {"method": "POST", "path": "/ro"}]}`,
+			[]string{"index 2 (GET /typo): status 404", "index 3 (POST /ro): status 405"},
+		},
+		{
+			"reject statuses",
+			`{"preflight": {"rejectStatuses": ["5xx"]}, "requests": [{"path": "/ok"}, {"path": "/busy"}, {"path": "/typo"}]}`,
+			[]string{"index 1 (GET /busy): status 503"},
+		},
+		{
+			"passing",
+			`{"requests": [{"path": "/ok"}]}`,
+			nil,
+		},
+	} {
+		var p params
+		if err := json.Unmarshal([]byte(c.raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		pf := p.Preflight
+		if pf == nil {
+			pf = &preflight{}
+		}
+		s := &service{target: strings.TrimPrefix(srv.URL, "http://")}
+		err := s.runPreflight(context.Background(), &p, pf, log.With())
+		if len(c.wantErrs) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+			continue
+		}
+		for _, want := range c.wantErrs {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: expected %q in %q", c.name, want, err)
+			}
+		}
+		if n := strings.Count(err.Error(), "request at index"); n != len(c.wantErrs) {
+			t.Errorf("%s: expected %d failed requests, got %d", c.name, len(c.wantErrs), n)
+		}
+	}
+
+	var p params
+	if err := json.Unmarshal([]byte(`{"dialOnly": true, "preflight": {}}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.prepare(); err == nil {
+		t.Error("expected an error for preflight in a dial-only run")
+	}
+}
+
+func TestPreflightFailureKeepsParams(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	s := NewService()
+	s.target = strings.TrimPrefix(srv.URL, "http://")
+	s.embedded = true
+	w := httptest.NewRecorder()
+	s.handleTest(w, httptest.NewRequest(
+		http.MethodPost,
+		"/test",
+		strings.NewReader(`{"name": "rejected", "duration": "1s", "preflight": {}, "requests": [{"path": "/typo"}]}`),
+	))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body)
+	}
+	if s.params.Name != "" || s.run.Load() != nil {
+		t.Errorf("expected the rejected params left out of the service, got %q", s.params.Name)
+	}
+	if st := s.serviceStatus(); st.Status != "ready" {
+		t.Errorf("expected the service ready, got %q", st.Status)
+	}
+}
@@ -0,0 +1,54 @@
+package tester
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// logProgress logs the progress of the run ri to logger every interval until
+// ctx is done. The logged rate covers the last interval only, so a stall shows
+// up right away.
+func (s *service) logProgress(ctx context.Context, ri *runInfo, logger *log.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		last     = ri.startedAt
+		lastReqs uint64
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			reqs := s.requests.Load()
+			rps := float64(reqs-lastReqs) / now.Sub(last).Seconds()
+			last, lastReqs = now, reqs
+			attrs := []slog.Attr{
+				slog.Any("elapsed", shared.Duration(now.Sub(ri.startedAt).Truncate(time.Millisecond))),
+			}
+			// Runs without a duration have no time remaining.
+			if !ri.runningUntil.IsZero() {
+				attrs = append(attrs, slog.Any("remaining", shared.Duration(time.Until(ri.runningUntil).Truncate(time.Millisecond))))
+			}
+			attrs = append(
+				attrs,
+				slog.Uint64("requests", reqs),
+				slog.Float64("rps", math.Round(rps*10)/10),
+				slog.Uint64("errors", s.errored.Load()),
+				slog.Uint64("timeouts", s.timeouts.Load()),
+				slog.Uint64("failures", s.failures.Load()),
+			)
+			logger.Info("test run progress", attrs...)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
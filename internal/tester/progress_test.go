@@ -0,0 +1,78 @@
+package tester
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+)
+
+func TestLogProgress(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "progress.json")
+	defer func(name string) {
+		log.FileName = name
+		log.Init()
+	}(log.FileName)
+	log.FileName = fn
+	log.Init()
+
+	const interval = 100 * time.Millisecond
+	now := time.Now()
+	ri := &runInfo{startedAt: now, runningUntil: now.Add(10 * time.Second)}
+	s := NewService()
+	s.requests.Store(100)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*interval+interval/2)
+	defer cancel()
+	s.logProgress(ctx, ri, log.With(), interval)
+
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []map[string]any
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m["msg"] == "test run progress" {
+			lines = append(lines, m)
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected a progress line per interval, got %d", len(lines))
+	}
+	duration := func(m map[string]any, key string) time.Duration {
+		s, _ := m[key].(string)
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			t.Fatalf("expected a duration for %s, got %v", key, m[key])
+		}
+		return d
+	}
+	for i, m := range lines {
+		tick := time.Duration(i+1) * interval
+		if d := duration(m, "elapsed"); d < tick || d > tick+interval/2 {
+			t.Errorf("line %d: expected about %v elapsed, got %v", i, tick, d)
+		}
+		if d := duration(m, "remaining"); d > 10*time.Second-tick || d < 10*time.Second-tick-interval/2 {
+			t.Errorf("line %d: expected about %v remaining, got %v", i, 10*time.Second-tick, d)
+		}
+		if m["requests"] != float64(100) {
+			t.Errorf("line %d: expected 100 requests, got %v", i, m["requests"])
+		}
+	}
+	// The rate covers the last interval only.
+	if rps := lines[0]["rps"].(float64); rps < 500 || rps > 1000 {
+		t.Errorf("expected about 1000 rps over the first interval, got %v", rps)
+	}
+	if rps := lines[1]["rps"].(float64); rps != 0 {
+		t.Errorf("expected no rps over the second interval, got %v", rps)
+	}
+}
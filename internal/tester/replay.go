@@ -0,0 +1,247 @@
+package tester
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type replayEntry struct {
+	At      time.Duration
+	Request request
+}
+
+// loadSchedule reads a replay CSV file. Records are either in the collector
+// output layout or in a reduced "offset,method,path" layout, where offset is a
+// duration relative to the start of the run (e.g. "150ms"). Collector files
+// written with a column selection are read by their header row. Entries are
+// sorted by offset and scaled by 1/speed. With failuresOnly, only the failed
+// requests of a collector output file are kept, all due at the start of the
+// run. The comma rune separates the fields of each record.
+func loadSchedule(fn string, speed float64, failuresOnly bool, comma rune) ([]replayEntry, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		entries  []replayEntry
+		absolute []int
+		origin   time.Time
+		index    []int
+		rd       = csv.NewReader(f)
+	)
+	rd.FieldsPerRecord = -1
+	rd.Comma = comma
+
+	for line := 1; ; line++ {
+		record, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 {
+			var ok bool
+			if index, ok = shared.ParseHeader(record); ok {
+				if err := checkReplayColumns(record, failuresOnly); err != nil {
+					return nil, fmt.Errorf("line 1: %v", err)
+				}
+				continue
+			}
+		}
+
+		var e replayEntry
+		if len(record) == 3 && index == nil {
+			if failuresOnly {
+				return nil, fmt.Errorf("line %d: replaying failures requires a collector output file", line)
+			}
+			d, err := time.ParseDuration(record[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid offset: %v", line, err)
+			}
+			e.At = d
+			e.Request.Method = method(strings.ToUpper(record[1]))
+			e.Request.Path = record[2]
+		} else {
+			res, err := shared.ParseTestResultColumns(record, index)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			if failuresOnly && !failed(res) {
+				continue
+			}
+			t, err := res.RequestTime()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid request time: %v", line, err)
+			}
+			if origin.IsZero() || t.Before(origin) {
+				origin = t
+			}
+			absolute = append(absolute, len(entries))
+			e.At = time.Duration(t.UnixNano())
+			e.Request.Method = method(res.RequestMethod())
+			e.Request.Path = res.RequestPath()
+		}
+		if _, ok := validMethods[string(e.Request.Method)]; !ok {
+			return nil, fmt.Errorf("line %d: invalid HTTP method: '%s'", line, e.Request.Method)
+		}
+		e.Request.Header = make(http.Header)
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 && failuresOnly {
+		return nil, fmt.Errorf("replay file %s contains no failed requests", fn)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("replay file %s contains no requests", fn)
+	}
+
+	// Collector records carry wall-clock times; make them relative to the
+	// earliest one.
+	for _, i := range absolute {
+		entries[i].At -= time.Duration(origin.UnixNano())
+	}
+	slices.SortStableFunc(entries, func(a, b replayEntry) int {
+		return cmp.Compare(a.At, b.At)
+	})
+	for i := range entries {
+		if failuresOnly {
+			// Failures are replayed in their order, as fast as the testers
+			// go.
+			entries[i].At = 0
+			continue
+		}
+		entries[i].At = time.Duration(float64(entries[i].At) / speed)
+	}
+
+	return entries, nil
+}
+
+// checkReplayColumns checks that the header row of a collector file holds the
+// columns a replay needs.
+func checkReplayColumns(header []string, failuresOnly bool) error {
+	for _, n := range []string{"ReqTime", "ReqMethod", "ReqPath"} {
+		if !slices.Contains(header, n) {
+			return fmt.Errorf("replay file lacks the %s column", n)
+		}
+	}
+	if failuresOnly && !slices.Contains(header, "Success") && !slices.Contains(header, "RespCode") {
+		return fmt.Errorf("replaying failures requires the Success or RespCode column")
+	}
+	return nil
+}
+
+// failed reports whether res, a recorded result, did not succeed. Results
+// written before success was recorded count as failed if they got no 2xx
+// response.
+func failed(res shared.TestResult) bool {
+	if success, ok := res.Success(); ok {
+		return !success
+	}
+	if res.TimedOut() || res.ErrorClass() != "" {
+		return true
+	}
+	code, err := strconv.Atoi(res.ResponseCode())
+	return err != nil || code < 200 || code > 299
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func runReplay(s *service) {
+	s.logger.Debug(
+		"starting replay",
+		slog.Int("paralletTesters", int(s.params.ParallelTesters)),
+		slog.Int("requests", len(s.schedule)),
+		slog.Float64("speed", s.params.ReplaySpeed),
+	)
+
+	queue := make(chan request)
+	go func() {
+		defer close(queue)
+		start := time.Now()
+		for _, e := range s.schedule {
+			if d := time.Until(start.Add(e.At)); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-s.testCtx.Done():
+					return
+				}
+			}
+			select {
+			case queue <- e.Request:
+			case <-s.testCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// recovered counts the replayed failures that now succeed.
+	var recovered atomic.Uint64
+	wg := sync.WaitGroup{}
+	for i := range int(s.params.ParallelTesters) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.logger.Debug("starting tester", slog.Int("num", i))
+
+			clients := s.testerClients[i]
+			for r := range queue {
+				tRes, body, err := s.roundTrip(clients.get(r), i, s.requests.Add(1), r, nil)
+				if err != nil {
+					s.logger.Error("failed to create request", err)
+					continue
+				}
+				tRes.SetSchedule(scheduleReplay)
+				ok := s.judge(&tRes, r, body)
+				if s.params.ReplayFailures {
+					if ok {
+						recovered.Add(1)
+					}
+					s.logger.Info(
+						"failed request replayed",
+						slog.String("method", string(r.Method)),
+						slog.String("path", r.path()),
+						slog.String("status", tRes.ResponseCode()),
+						slog.String("error", tRes.ErrorClass()),
+						slog.Bool("succeeded", ok),
+					)
+				}
+				s.results <- tRes
+				s.backOff(tRes)
+			}
+		}()
+	}
+	wg.Wait()
+	if s.params.ReplayFailures {
+		s.logger.Info(
+			"failures replayed",
+			slog.Int("requests", len(s.schedule)),
+			slog.Uint64("succeeded", recovered.Load()),
+		)
+	}
+
+	// The schedule may finish before the test deadline.
+	s.testCancel()
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,157 @@
+package tester
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSchedule(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "replay.csv")
+	raw := `2025-01-02T10:00:01.5,run,id-2,2,POST,/b,200,12ms,false
+2025-01-02T10:00:00,run,id-1,1,GET,/a,200,10ms,false
+2025-01-02T10:00:03,run,id-3,3,GET,/c,200,11ms,false
+`
+	if err := os.WriteFile(fn, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadSchedule(fn, 2, false, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Request.Path != "/a" || entries[0].At != 0 {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Request.Method != "POST" || entries[1].At != 750*time.Millisecond {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+	if entries[2].At != 1500*time.Millisecond {
+		t.Errorf("unexpected third entry: %+v", entries[2])
+	}
+}
+
+func TestLoadScheduleOffsets(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "replay.csv")
+	raw := "0s,get,/a\n250ms,DELETE,/b\n"
+	if err := os.WriteFile(fn, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadSchedule(fn, 1, false, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Request.Method != "GET" || entries[1].At != 250*time.Millisecond {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+
+	if err := os.WriteFile(fn, []byte("0s,FETCH,/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSchedule(fn, 1, false, ','); err == nil {
+		t.Error("expected error for invalid method")
+	}
+}
+
+func TestLoadScheduleFailures(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "replay.csv")
+	// Success is the 15th field; the last record predates it.
+	raw := `2025-01-02T10:00:00,run,id-1,1,GET,/a,200,10ms,false,,,,,,true
+2025-01-02T10:00:01,run,id-2,2,POST,/b,503,12ms,false,,,,,,false
+2025-01-02T10:00:02,run,id-3,3,GET,/c,,200ms,true,,,,timeout,,false
+2025-01-02T10:00:03,run,id-4,4,GET,/d,404,11ms,false
+`
+	if err := os.WriteFile(fn, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadSchedule(fn, 1, true, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.At != 0 {
+			t.Errorf("expected every failure due at once, got %+v", e)
+		}
+		paths = append(paths, e.Request.Path)
+	}
+	if want := []string{"/b", "/c", "/d"}; !slices.Equal(paths, want) {
+		t.Errorf("expected failures %v, got %v", want, paths)
+	}
+
+	if err := os.WriteFile(fn, []byte(strings.SplitAfter(raw, "\n")[0]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSchedule(fn, 1, true, ','); err == nil {
+		t.Error("expected error for a file without failures")
+	}
+	if err := os.WriteFile(fn, []byte("0s,GET,/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSchedule(fn, 1, true, ','); err == nil {
+		t.Error("expected error for the reduced layout")
+	}
+}
+
+func TestLoadScheduleColumns(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "replay.csv")
+	raw := `ReqPath,ReqMethod,ReqTime
+/b,POST,2025-01-02T10:00:01.000Z
+/a,GET,2025-01-02T10:00:00.000Z
+`
+	if err := os.WriteFile(fn, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadSchedule(fn, 1, false, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Request.Path != "/a" || entries[1].Request.Method != "POST" || entries[1].At != time.Second {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if _, err := loadSchedule(fn, 1, true, ','); err == nil || !strings.Contains(err.Error(), "Success or RespCode") {
+		t.Errorf("expected error for failures without an outcome column, got %v", err)
+	}
+
+	if err := os.WriteFile(fn, []byte("ReqTime,ReqPath\n2025-01-02T10:00:00.000Z,/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSchedule(fn, 1, false, ','); err == nil || !strings.Contains(err.Error(), "ReqMethod") {
+		t.Errorf("expected error for a missing column, got %v", err)
+	}
+}
+
+func TestReplayDelimiter(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "replay.csv")
+	raw := "2025-01-02T10:00:00.000Z;run;id-1;1;GET;/a;200;10ms;false\n2025-01-02T10:00:01.000Z;run;id-2;2;POST;/b;200;12ms;false\n"
+	if err := os.WriteFile(fn, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := params{ReplayFile: fn, ReplayDelimiter: ";"}
+	schedule, err := p.prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 2 || schedule[1].Request.Path != "/b" || schedule[1].At != time.Second {
+		t.Errorf("unexpected schedule: %+v", schedule)
+	}
+
+	p = params{ReplayFile: fn}
+	if _, err := p.prepare(); err == nil {
+		t.Error("expected error reading a semicolon-separated file as comma-separated")
+	}
+	p = params{ReplayFile: fn, ReplayDelimiter: ";;"}
+	if _, err := p.prepare(); err == nil {
+		t.Error("expected error for an invalid delimiter")
+	}
+}
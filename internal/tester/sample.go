@@ -0,0 +1,133 @@
+package tester
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	defaultSampleMaxBytes   = 64 * 1024
+	defaultSampleMaxSamples = 100
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// bodySamples sets which response bodies the tester keeps for debugging: a
+// random share of them, set by Rate, and with OnError the first unsuccessful
+// response of each status class. At most MaxSamples bodies of up to MaxBytes
+// each are kept per run.
+type bodySamples struct {
+	Rate       float64 `json:"rate"`
+	OnError    bool    `json:"onError"`
+	MaxBytes   int64   `json:"maxBytes"`
+	MaxSamples int64   `json:"maxSamples"`
+}
+
+func (bs *bodySamples) enabled() bool {
+	return bs.Rate > 0 || bs.OnError
+}
+
+// prepare validates bs and fills in the defaults.
+func (bs *bodySamples) prepare() error {
+	if bs.Rate < 0 || bs.Rate > 1 || bs.MaxBytes < 0 || bs.MaxSamples < 0 {
+		return errors.New("rate must be >= 0 and <= 1, maxBytes and maxSamples >= 0")
+	}
+	if bs.MaxBytes == 0 {
+		bs.MaxBytes = defaultSampleMaxBytes
+	}
+	if bs.MaxSamples == 0 {
+		bs.MaxSamples = defaultSampleMaxSamples
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// bodySampler picks the response bodies to keep during a run and writes them
+// to dir, one file per request ID.
+type bodySampler struct {
+	cfg   bodySamples
+	dir   string
+	taken atomic.Int64
+
+	mu sync.Mutex
+	// failedClasses holds the status classes of the unsuccessful responses
+	// sampled so far.
+	failedClasses map[int]bool
+}
+
+func newBodySampler(cfg bodySamples, dir string) *bodySampler {
+	return &bodySampler{
+		cfg:           cfg,
+		dir:           dir,
+		failedClasses: make(map[int]bool),
+	}
+}
+
+// sample reports whether to keep the body of a response with code, ok telling
+// whether it counts as success.
+func (bs *bodySampler) sample(code int, ok bool) bool {
+	if bs.taken.Load() >= bs.cfg.MaxSamples {
+		return false
+	}
+	if !ok && bs.cfg.OnError {
+		bs.mu.Lock()
+		first := !bs.failedClasses[code/100]
+		bs.failedClasses[code/100] = true
+		bs.mu.Unlock()
+		if first {
+			return bs.take()
+		}
+	}
+	if bs.cfg.Rate > 0 && rand.Float64() < bs.cfg.Rate {
+		return bs.take()
+	}
+	return false
+}
+
+// take reserves one of the samples of the run.
+func (bs *bodySampler) take() bool {
+	for {
+		n := bs.taken.Load()
+		if n >= bs.cfg.MaxSamples {
+			return false
+		}
+		if bs.taken.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// save writes the body sampled from the request with id and returns the path
+// of the file.
+func (bs *bodySampler) save(id string, body []byte) (string, error) {
+	if err := os.MkdirAll(bs.dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(bs.dir, url.PathEscape(id)+".body")
+	return path, os.WriteFile(path, body, 0o644)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// sampleBuffer keeps the first max bytes written to it and discards the rest.
+type sampleBuffer struct {
+	b   []byte
+	max int64
+}
+
+func (sb *sampleBuffer) Write(p []byte) (int, error) {
+	if room := sb.max - int64(len(sb.b)); room > 0 {
+		sb.b = append(sb.b, p[:min(int64(len(p)), room)]...)
+	}
+	return len(p), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,51 @@
+package tester
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodySampler(t *testing.T) {
+	cfg := bodySamples{OnError: true}
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxSamples = 3
+	bs := newBodySampler(cfg, t.TempDir())
+
+	for _, tc := range []struct {
+		code   int
+		ok     bool
+		sample bool
+	}{
+		{200, true, false},
+		{503, false, true},
+		{500, false, false},
+		{404, false, true},
+		{302, false, true},
+		// The samples of the run are used up.
+		{429, false, false},
+	} {
+		if got := bs.sample(tc.code, tc.ok); got != tc.sample {
+			t.Errorf("%d: got sample %v, expected %v", tc.code, got, tc.sample)
+		}
+	}
+
+	bs = newBodySampler(bodySamples{Rate: 1, MaxBytes: 4, MaxSamples: 1}, t.TempDir())
+	if !bs.sample(200, true) || bs.sample(200, true) {
+		t.Error("expected exactly one sample at rate 1")
+	}
+	sb := &sampleBuffer{max: bs.cfg.MaxBytes}
+	if _, err := io.Copy(sb, strings.NewReader("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	file, err := bs.save("id/1", sb.b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(file); err != nil || string(b) != "hell" {
+		t.Errorf("expected the capped body in %s, got %q, %v", file, b, err)
+	}
+}
@@ -0,0 +1,165 @@
+package tester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ozla/hrtester/internal/config"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stdinRef is the body of the request sent with the body read from stdin at
+// startup.
+const stdinRef = "@-"
+
+// envRef matches a header value or body that is a reference to an environment
+// variable.
+var envRef = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// isSecretRef reports whether v is a secret reference. References are never
+// templates, so that the secrets they resolve to are sent as they are.
+func isSecretRef(v string) bool {
+	return envRef.MatchString(v) || (strings.HasPrefix(v, "@") && v != "@")
+}
+
+// resolveSecret resolves v if it is a secret reference: "${NAME}" stands for
+// the environment variable NAME, "@path" for the contents of the file at path,
+// without trailing line breaks, and "@@value" for the literal "@value". ok is
+// false if v is no reference.
+func resolveSecret(v string) (resolved string, ok bool, err error) {
+	if m := envRef.FindStringSubmatch(v); m != nil {
+		val, found := os.LookupEnv(m[1])
+		if !found {
+			return "", true, fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		return val, true, nil
+	}
+	if v == stdinRef {
+		return "", true, errors.New("stdin may only be referenced as a request body")
+	}
+	if lit, found := strings.CutPrefix(v, "@@"); found {
+		return "@" + lit, true, nil
+	}
+	if path, found := strings.CutPrefix(v, "@"); found && path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", true, err
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	return v, false, nil
+}
+
+// resolveHeader resolves the secret references among the values of h in
+// place. It returns the original values of the headers that had any, to show
+// instead of the secrets.
+func resolveHeader(h http.Header) (http.Header, error) {
+	var refs http.Header
+	for k, vs := range h {
+		orig := append([]string(nil), vs...)
+		isRef := false
+		for i, v := range vs {
+			resolved, ok, err := resolveSecret(v)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %v", k, err)
+			}
+			if ok {
+				vs[i], isRef = resolved, true
+			}
+		}
+		if isRef {
+			if refs == nil {
+				refs = make(http.Header)
+			}
+			refs[k] = orig
+		}
+	}
+	return refs, nil
+}
+
+// resolveStdinBody returns the body read from stdin at startup, as is.
+func resolveStdinBody() (string, error) {
+	if config.Tester.StdinBody == nil {
+		return "", errors.New("no body was read from stdin, start the tester with --stdin-body")
+	}
+	return string(config.Tester.StdinBody), nil
+}
+
+// resolveSecrets resolves the secret references in the headers and bodies of
+// p, once the requests are loaded. Marshaling p shows the references rather
+// than the secrets. Stdin can be read only once, so a single request may take
+// its body from there.
+func (p *params) resolveSecrets() error {
+	var err error
+	if p.headerRefs, err = resolveHeader(p.Headers); err != nil {
+		return err
+	}
+	stdinRequest := -1
+	for i := range p.Requests {
+		r := &p.Requests[i]
+		if r.headerRefs, err = resolveHeader(r.Header); err != nil {
+			return fmt.Errorf("request at index %d: %v", i, err)
+		}
+		var (
+			body string
+			ok   bool
+		)
+		if r.Body == stdinRef {
+			if stdinRequest >= 0 {
+				return fmt.Errorf(
+					"request at index %d: body: stdin is already the body of the request at index %d",
+					i, stdinRequest,
+				)
+			}
+			stdinRequest, ok = i, true
+			body, err = resolveStdinBody()
+		} else {
+			body, ok, err = resolveSecret(r.Body)
+		}
+		if err != nil {
+			return fmt.Errorf("request at index %d: body: %v", i, err)
+		}
+		if ok {
+			r.bodyRef, r.Body = r.Body, body
+		}
+	}
+	return nil
+}
+
+// redactHeader returns h with the values of the headers in refs replaced by
+// their references.
+func redactHeader(h, refs http.Header) http.Header {
+	if refs == nil {
+		return h
+	}
+	h = h.Clone()
+	for k, vs := range refs {
+		h[k] = vs
+	}
+	return h
+}
+
+func (p params) MarshalJSON() ([]byte, error) {
+	type alias params
+	a := alias(p)
+	a.Headers = redactHeader(p.Headers, p.headerRefs)
+	return json.Marshal(a)
+}
+
+func (r request) MarshalJSON() ([]byte, error) {
+	type alias request
+	a := alias(r)
+	a.Header = redactHeader(r.Header, r.headerRefs)
+	if r.bodyRef != "" {
+		a.Body = r.bodyRef
+	}
+	return json.Marshal(a)
+}
+
+////////////////////////////////////////////////////////////////////////////////
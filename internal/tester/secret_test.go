@@ -0,0 +1,125 @@
+package tester
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/config"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("HRTESTER_TEST_TOKEN", "s3cret")
+	secretFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := `{
+  "headers": {"Authorization": "Bearer ${HRTESTER_TEST_TOKEN}", "X-Token": "${HRTESTER_TEST_TOKEN}"},
+  "requests": [{"method": "POST", "path": "/", "header": {"X-Api-Key": "@` + secretFile + `"}, "body": "@` + secretFile + `"}]
+}`
+	var p params
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	r := p.Requests[0]
+	if p.Headers.Get("X-Token") != "s3cret" || r.Header.Get("X-Api-Key") != "file-secret" || r.Body != "file-secret" {
+		t.Errorf("unexpected resolved values: %v, %v, %q", p.Headers, r.Header, r.Body)
+	}
+	// Only whole values are references.
+	if v := p.Headers.Get("Authorization"); v != "Bearer ${HRTESTER_TEST_TOKEN}" {
+		t.Errorf("expected a partial reference to stay as is, got %q", v)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cret") || strings.Contains(string(b), "file-secret") {
+		t.Errorf("expected marshaled params without secrets, got %s", b)
+	}
+	if !strings.Contains(string(b), "${HRTESTER_TEST_TOKEN}") {
+		t.Errorf("expected marshaled params with the references, got %s", b)
+	}
+
+	// "@@" escapes a literal "@", and resolved values are no templates.
+	tplFile := filepath.Join(t.TempDir(), "tpl")
+	if err := os.WriteFile(tplFile, []byte("tok{{.RequestNum"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	raw = `{"requests": [{"method": "GET", "path": "/{{.RequestNum}}",
+  "header": {"X-Handle": "@@someone", "X-Token": "@` + tplFile + `"}}]}`
+	p = params{}
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	r, err = p.Requests[0].render(templateData{RequestNum: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != "/7" || r.Header.Get("X-Handle") != "@someone" || r.Header.Get("X-Token") != "tok{{.RequestNum" {
+		t.Errorf("unexpected rendered request: %q, %v", r.Path, r.Header)
+	}
+	if b, _ := json.Marshal(p); !strings.Contains(string(b), `"@@someone"`) {
+		t.Errorf("expected marshaled params with the escaped value, got %s", b)
+	}
+
+	for _, raw := range []string{
+		`{"headers": {"X-Token": "${HRTESTER_TEST_UNSET}"}, "requests": [{"method": "GET", "path": "/"}]}`,
+		`{"requests": [{"method": "GET", "path": "/", "header": {"X-Token": "@/nonexistent/secret"}}]}`,
+	} {
+		var p params
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.prepare(); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestStdinBody(t *testing.T) {
+	defer func(b []byte) { config.Tester.StdinBody = b }(config.Tester.StdinBody)
+	config.Tester.StdinBody = []byte("{\"piped\": \"{{true}}\"}\n")
+
+	prepare := func(raw string) (params, error) {
+		var p params
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		_, err := p.prepare()
+		return p, err
+	}
+	p, err := prepare(`{"requests": [{"method": "POST", "path": "/a", "body": "@-"}, {"method": "GET", "path": "/b"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := p.Requests[0].render(templateData{}); err != nil || r.Body != "{\"piped\": \"{{true}}\"}\n" {
+		t.Errorf("expected the stdin body as is, got %q (%v)", r.Body, err)
+	}
+	if b, _ := json.Marshal(p); !strings.Contains(string(b), `"body":"@-"`) {
+		t.Errorf("expected marshaled params with the reference, got %s", b)
+	}
+
+	for _, raw := range []string{
+		`{"requests": [{"method": "POST", "path": "/a", "body": "@-"}, {"method": "POST", "path": "/b", "body": "@-"}]}`,
+		`{"requests": [{"method": "GET", "path": "/", "header": {"X-Token": "@-"}}]}`,
+	} {
+		if _, err := prepare(raw); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+	config.Tester.StdinBody = nil
+	if _, err := prepare(`{"requests": [{"method": "POST", "path": "/", "body": "@-"}]}`); err == nil {
+		t.Error("expected error without a stdin body")
+	}
+}
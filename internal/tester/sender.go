@@ -0,0 +1,401 @@
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	collectorStreamPath = "/stream"
+	collectorRunPath    = "/run"
+)
+
+// Modes of delivering results to several collectors.
+const (
+	collectorModeMirror   = "mirror"
+	collectorModeFailover = "failover"
+)
+
+// streamFlushResults and streamFlushInterval bound the results pending on a
+// stream, which are delivered again if it fails.
+const (
+	streamFlushResults  = 256
+	streamFlushInterval = 100 * time.Millisecond
+)
+
+var errStreamClosed = errors.New("collector closed the result stream")
+
+////////////////////////////////////////////////////////////////////////////////
+
+// collector is a collector results are delivered to, with the delivery counts
+// of the current run.
+type collector struct {
+	addr   string
+	sent   atomic.Uint64
+	failed atomic.Uint64
+}
+
+func newCollectors(addrs []string) []*collector {
+	cs := make([]*collector, len(addrs))
+	for i, addr := range addrs {
+		cs[i] = &collector{addr: addr}
+	}
+	return cs
+}
+
+// url returns the URL of path on the collector, below its base path.
+func (c *collector) url(path string) url.URL {
+	scheme := config.Tester.CollectorScheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return url.URL{
+		Scheme: scheme,
+		Host:   c.addr,
+		Path:   config.Tester.CollectorPath + path,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// sendResults delivers results to the collectors, or to statsd if that is the
+// sink. In mirror mode every collector gets every result; in failover mode
+// each result goes to one collector, the next one taking over when it fails.
+func (s *service) sendResults() {
+	if config.Tester.Sink == sinkStatsdUDP {
+		s.statsdResults()
+		return
+	}
+	for _, c := range s.collectors {
+		c.sent.Store(0)
+		c.failed.Store(0)
+	}
+	if config.Tester.CollectorMode == collectorModeFailover {
+		s.failoverResults()
+	} else {
+		s.mirrorResults()
+	}
+	for _, c := range s.collectors {
+		s.logger.Info(
+			"results delivered to collector",
+			slog.String("collector", c.addr),
+			slog.Uint64("sent", c.sent.Load()),
+			slog.Uint64("failed", c.failed.Load()),
+		)
+	}
+}
+
+// mirrorResults copies every result to a sender per collector.
+func (s *service) mirrorResults() {
+	if len(s.collectors) == 1 {
+		s.deliverResults(s.collectors[0], s.results)
+		return
+	}
+	var wg sync.WaitGroup
+	chans := make([]chan shared.TestResult, len(s.collectors))
+	for i, c := range s.collectors {
+		chans[i] = make(chan shared.TestResult, cap(s.results))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliverResults(c, chans[i])
+		}()
+	}
+	for res := range s.results {
+		s.checkSaturation()
+		for _, ch := range chans {
+			ch <- res
+		}
+	}
+	for _, ch := range chans {
+		close(ch)
+	}
+	wg.Wait()
+}
+
+// deliverResults delivers results to c over a single streaming request. If
+// the stream fails, the remaining results are posted one by one.
+func (s *service) deliverResults(c *collector, results <-chan shared.TestResult) {
+	if unsent, err := s.streamResults(c, nil, results); err != nil {
+		s.logger.Warn(
+			"result stream to collector failed; falling back to single posts",
+			slog.String("collector", c.addr),
+			slog.Any("err", err),
+		)
+		for _, res := range unsent {
+			s.postResult(c, res)
+		}
+		for res := range results {
+			s.checkSaturation()
+			s.postResult(c, res)
+		}
+	}
+}
+
+// failoverResults streams the results to one collector at a time, moving on
+// to the next one when the stream fails. Once every stream has failed, the
+// remaining results are posted one by one, each to the first collector that
+// takes it.
+func (s *service) failoverResults() {
+	var (
+		cur    int
+		unsent []shared.TestResult
+		err    error
+	)
+	for range s.collectors {
+		c := s.collectors[cur]
+		if unsent, err = s.streamResults(c, unsent, s.results); err == nil {
+			return
+		}
+		cur = (cur + 1) % len(s.collectors)
+		s.logger.Warn(
+			"result stream to collector failed; failing over",
+			slog.String("collector", c.addr),
+			slog.String("next", s.collectors[cur].addr),
+			slog.Any("err", err),
+		)
+	}
+	post := func(res shared.TestResult) {
+		for range s.collectors {
+			if s.postResult(s.collectors[cur], res) {
+				return
+			}
+			cur = (cur + 1) % len(s.collectors)
+		}
+	}
+	for _, res := range unsent {
+		post(res)
+	}
+	for res := range s.results {
+		s.checkSaturation()
+		post(res)
+	}
+}
+
+// streamResults streams first, then results, to c. If the stream fails, it
+// returns the results not known to have reached the collector, for the caller
+// to deliver otherwise.
+func (s *service) streamResults(c *collector, first []shared.TestResult, results <-chan shared.TestResult) ([]shared.TestResult, error) {
+	u := c.url(collectorStreamPath)
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, u.String(), pr)
+	if err != nil {
+		return first, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := (&http.Client{Transport: s.collectorTransport}).Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				err = fmt.Errorf("unexpected collector response: %s", resp.Status)
+			}
+		}
+		if err == nil {
+			err = errStreamClosed
+		}
+		// Unblock the writer if the collector went away mid-stream.
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	// Results count as sent once flushed to the stream; until then they are
+	// pending. The stream is flushed whenever no result is waiting, and
+	// otherwise once enough results are pending or enough time passed.
+	var (
+		pending []shared.TestResult
+		flushed = time.Now()
+	)
+	w := bufio.NewWriter(pw)
+	write := func(res shared.TestResult, idle bool) error {
+		pending = append(pending, res)
+		_, err := w.WriteString(res.URLValues().Encode() + "\n")
+		if err == nil && (idle || len(pending) >= streamFlushResults || time.Since(flushed) >= streamFlushInterval) {
+			if err = w.Flush(); err == nil {
+				c.sent.Add(uint64(len(pending)))
+				pending, flushed = pending[:0], time.Now()
+			}
+		}
+		return err
+	}
+	fail := func(err error) ([]shared.TestResult, error) {
+		pw.CloseWithError(err)
+		return pending, <-done
+	}
+
+	for i, res := range first {
+		if err := write(res, i == len(first)-1 && len(results) == 0); err != nil {
+			unsent, err := fail(err)
+			return append(unsent, first[i+1:]...), err
+		}
+	}
+	for res := range results {
+		s.checkSaturation()
+		if err := write(res, len(results) == 0); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	c.sent.Add(uint64(len(pending)))
+	pending = nil
+	pw.Close()
+
+	if err := <-done; !errors.Is(err, errStreamClosed) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// postResult posts a single result to c and reports whether c took it.
+func (s *service) postResult(c *collector, res shared.TestResult) bool {
+	u := c.url("/")
+	client := &http.Client{
+		Transport: s.collectorTransport,
+		Timeout:   1 * time.Second,
+	}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		u.String(),
+		strings.NewReader(res.URLValues().Encode()),
+	)
+	if err != nil {
+		s.logger.Error("failed to create request for collector", err)
+		c.failed.Add(1)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		s.logger.Debug(
+			"failed to post result to collector",
+			slog.String("collector", c.addr),
+			slog.Any("err", err),
+		)
+		c.failed.Add(1)
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		c.failed.Add(1)
+		return false
+	}
+	c.sent.Add(1)
+	return true
+}
+
+// sendRunEvent tells the collectors that a run has started or ended. Failures
+// are logged only, as collectors without metadata recording are fine.
+func (s *service) sendRunEvent(ev shared.RunEvent) {
+	if s.embedded {
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		s.logger.Error("failed to marshal run event", err)
+		return
+	}
+	client := &http.Client{
+		Transport: s.collectorTransport,
+		Timeout:   1 * time.Second,
+	}
+	for _, c := range s.collectors {
+		u := c.url(collectorRunPath)
+		resp, err := client.Post(u.String(), "application/json", bytes.NewReader(b))
+		if err != nil {
+			s.logger.Debug(
+				"failed to send run event to collector",
+				slog.String("collector", c.addr),
+				slog.Any("err", err),
+			)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			s.logger.Debug(
+				"collector did not record run event",
+				slog.String("collector", c.addr),
+				slog.String("status", resp.Status),
+			)
+		}
+	}
+}
+
+func (s *service) checkSaturation() {
+	s.resultsBuffer.observe(len(s.results))
+	if len(s.results) > cap(s.results)/2 {
+		s.logger.Warn(
+			"results buffer saturation",
+			slog.Int("precentage", len(s.results)*100/cap(s.results)),
+		)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// bufferGauge tracks the occupancy of the results buffer of a run, as seen by
+// the sender. A buffer that fills up means the collector cannot keep up.
+type bufferGauge struct {
+	size    atomic.Int64
+	current atomic.Int64
+	peak    atomic.Int64
+}
+
+func (g *bufferGauge) reset(size int) {
+	g.size.Store(int64(size))
+	g.current.Store(0)
+	g.peak.Store(0)
+}
+
+func (g *bufferGauge) observe(n int) {
+	g.current.Store(int64(n))
+	for {
+		peak := g.peak.Load()
+		if int64(n) <= peak || g.peak.CompareAndSwap(peak, int64(n)) {
+			return
+		}
+	}
+}
+
+type bufferStatus struct {
+	Size           int64 `json:"size"`
+	Current        int64 `json:"current"`
+	Peak           int64 `json:"peak"`
+	PeakPercentage int64 `json:"peakPercentage"`
+}
+
+func (g *bufferGauge) status() bufferStatus {
+	st := bufferStatus{
+		Size:    g.size.Load(),
+		Current: g.current.Load(),
+		Peak:    g.peak.Load(),
+	}
+	if st.Size > 0 {
+		st.PeakPercentage = st.Peak * 100 / st.Size
+	}
+	return st
+}
+
+////////////////////////////////////////////////////////////////////////////////
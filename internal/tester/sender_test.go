@@ -0,0 +1,127 @@
+package tester
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+// testCollector counts the results it receives.
+func testCollector(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case collectorStreamPath:
+			sc := bufio.NewScanner(r.Body)
+			for sc.Scan() {
+				n.Add(1)
+			}
+		case "/":
+			n.Add(1)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func sendTestResults(s *service, n int) {
+	s.results = make(chan shared.TestResult, n)
+	for range n {
+		s.results <- shared.TestResult{}
+	}
+	close(s.results)
+	s.sendResults()
+}
+
+func TestSendResultsModes(t *testing.T) {
+	defer func(mode string) { config.Tester.CollectorMode = mode }(config.Tester.CollectorMode)
+
+	a, na := testCollector(t)
+	b, nb := testCollector(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	addr := func(srv *httptest.Server) string { return strings.TrimPrefix(srv.URL, "http://") }
+
+	s := &service{
+		logger:             log.With(),
+		collectorTransport: http.DefaultTransport,
+		collectors:         newCollectors([]string{addr(down), addr(a), addr(b)}),
+	}
+
+	config.Tester.CollectorMode = collectorModeMirror
+	sendTestResults(s, 10)
+	if na.Load() != 10 || nb.Load() != 10 {
+		t.Errorf("expected every collector to get all results, got %d and %d", na.Load(), nb.Load())
+	}
+	if c := s.collectors[0]; c.sent.Load() != 0 || c.failed.Load() == 0 {
+		t.Errorf("expected failed deliveries to the down collector, got %d sent, %d failed", c.sent.Load(), c.failed.Load())
+	}
+
+	na.Store(0)
+	nb.Store(0)
+	config.Tester.CollectorMode = collectorModeFailover
+	sendTestResults(s, 10)
+	if na.Load() != 10 || nb.Load() != 0 {
+		t.Errorf("expected the first live collector to get all results, got %d and %d", na.Load(), nb.Load())
+	}
+	if c := s.collectors[1]; c.sent.Load() != 10 {
+		t.Errorf("expected 10 results sent to the live collector, got %d", c.sent.Load())
+	}
+}
+
+func TestBufferGauge(t *testing.T) {
+	var g bufferGauge
+	g.reset(10)
+	for _, n := range []int{2, 7, 3} {
+		g.observe(n)
+	}
+	if st := g.status(); st != (bufferStatus{Size: 10, Current: 3, Peak: 7, PeakPercentage: 70}) {
+		t.Errorf("unexpected buffer status %+v", st)
+	}
+	g.reset(20)
+	if st := g.status(); st != (bufferStatus{Size: 20}) {
+		t.Errorf("expected a reset buffer status, got %+v", st)
+	}
+}
+
+func TestStreamPendingBound(t *testing.T) {
+	const (
+		total    = 2000
+		accepted = 300
+	)
+	var received atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The collector goes away mid-stream.
+		sc := bufio.NewScanner(r.Body)
+		for received.Load() < accepted && sc.Scan() {
+			received.Add(1)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := &service{logger: log.With(), collectorTransport: http.DefaultTransport}
+	c := &collector{addr: strings.TrimPrefix(srv.URL, "http://")}
+	// The results keep coming, so the stream is never idle.
+	results := make(chan shared.TestResult, total)
+	for range total {
+		results <- shared.TestResult{}
+	}
+	close(results)
+	unsent, err := s.streamResults(c, nil, results)
+	if err == nil {
+		t.Fatal("expected the stream to fail")
+	}
+	// Only the results pending when the stream failed are handed back.
+	if c.sent.Load() == 0 || len(unsent) > streamFlushResults {
+		t.Errorf("expected at most %d results pending, got %d with %d sent", streamFlushResults, len(unsent), c.sent.Load())
+	}
+}
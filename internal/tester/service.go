@@ -1,9 +1,13 @@
 package tester
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +17,11 @@ import (
 	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,20 +32,58 @@ import (
 	"github.com/ozla/hrtester/internal/log"
 	"github.com/ozla/hrtester/internal/shared"
 	"github.com/ozla/hrtester/internal/shared/middleware"
+	"golang.org/x/time/rate"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
 const (
 	statusReady uint32 = iota
+	// statusWaiting is the state of a run waiting to start, for its target
+	// to come up and its preflight check to pass.
+	statusWaiting
 	statusTesting
 	statusStopping
 
-	idsBufferSize     = 100
-	resultsBufferSize = 20
+	defaultIDsBufferSize     = 100
+	defaultResultsBufferSize = 20
+	// maxResultsBuffer and maxIDsBuffer bound the results and request IDs
+	// a run buffers, so that the buffers of a run fit in memory.
+	maxResultsBuffer = 1 << 20
+	maxIDsBuffer     = 1 << 20
+
+	collectorProbeTimeout = time.Second
+
+	// maxParamsBytes and paramsReadTimeout bound the params body of a test
+	// request.
+	maxParamsBytes    = 10 << 20
+	paramsReadTimeout = 30 * time.Second
+
+	// defaultTerminateWait bounds how long a terminate request with a bare
+	// wait parameter waits for the run to stop.
+	defaultTerminateWait = 30 * time.Second
+
+	defaultMaxIdleConns    = 100
+	defaultIdleConnTimeout = shared.Duration(30 * time.Second)
+
+	// bandwidthBurst bounds the bytes a throttled transfer moves at once.
+	bandwidthBurst = 16 * 1024
+
+	// Captured headers share one result column, so keep the list short.
+	maxCaptureHeaders = 4
+
+	// maxBodyDrain bounds the rest of a response body read after the tester
+	// is done with it, to keep the connection for reuse.
+	maxBodyDrain = 256 * 1024
+
+	// A run counts as saturated when more than 1/saturationFactor of its
+	// requests took longer than their tester's share of the pace allows.
+	saturationFactor = 10
 
 	spinupFactor      = 4
-	spinupMaxDuration = int64(10 * time.Second)
+	spinupMaxDuration = 10 * time.Second
+	// spinupIndefinite is the spinup window of runs without a duration.
+	spinupIndefinite = spinupMaxDuration
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -48,22 +94,78 @@ type service struct {
 	rootCAs      *x509.CertPool
 	status       *atomic.Uint32
 	terminated   chan struct{}
+	listening    chan struct{}
+	addr         net.Addr
 	shutdownOnce sync.Once
+	shuttingDown atomic.Bool
 	params       params
 	testCtx      context.Context
 	testCancel   context.CancelFunc
-	startedAt    time.Time
-	runningUntil time.Time
+	requests     *atomic.Uint64
+	overruns     *atomic.Uint64
+	failures     *atomic.Uint64
+	errored      *atomic.Uint64
+	timeouts     *atomic.Uint64
+	warmups      *atomic.Uint64
 	idGenDone    chan struct{}
 	testersDone  chan struct{}
-	ids          chan uuid.UUID
+	ids          chan string
 	results      chan shared.TestResult
+	senderDone   chan struct{}
+	schedule     []replayEntry
+	logger       *log.Logger
+	// testerClients holds the HTTP clients of each tester, created before
+	// the run so their connections can be warmed up.
+	testerClients []clients
+	// bandwidth holds the bandwidth limiter of each tester, if the params
+	// set a limit.
+	bandwidth []*rate.Limiter
+	// errWindow tracks the error rate of the run, if the params set
+	// abortOnErrorRate.
+	errWindow   *errorWindow
+	abortReason atomic.Pointer[string]
+	// measured is the measurement window of the run, if the params set
+	// one.
+	measured *timeWindow
+	// collectorTransport carries the results and run events to the
+	// collector.
+	collectorTransport http.RoundTripper
+	// target is the host:port requests are sent to.
+	target string
+	// collectors are the collectors results are delivered to.
+	collectors []*collector
+	// bodySampler keeps some response bodies, if the params ask for it.
+	bodySampler *bodySampler
+	// resultsBuffer tracks the occupancy of the results buffer.
+	resultsBuffer bufferGauge
+	// connWaits tracks the requests that waited for a free connection.
+	connWaits connWaitGauge
+	// embedded keeps the results in-process instead of sending them to the
+	// collector, when the tester is embedded with Run.
+	embedded bool
+	// stats aggregates the results of the run.
+	stats *shared.Stats
+	// run describes the current or last run, for the handlers outside of
+	// it. The fields above are owned by the run itself.
+	run atomic.Pointer[runInfo]
+	// cancelWait cancels the wait of a run waiting to start.
+	cancelWait atomic.Pointer[context.CancelFunc]
 }
 
 func NewService() *service {
 	s := &service{
 		status:     &atomic.Uint32{},
 		terminated: make(chan struct{}),
+		listening:  make(chan struct{}),
+		requests:   &atomic.Uint64{},
+		overruns:   &atomic.Uint64{},
+		failures:   &atomic.Uint64{},
+		errored:    &atomic.Uint64{},
+		timeouts:   &atomic.Uint64{},
+		warmups:    &atomic.Uint64{},
+		logger:     log.With(),
+		target:     config.Tester.Target,
+		collectors: newCollectors(config.Tester.Collectors),
 	}
 	s.status.Store(statusReady)
 	return s
@@ -87,6 +189,7 @@ func (s *service) Start() {
 			s.clientCert = &cert
 		}
 	}
+	s.collectorTransport = s.newCollectorTransport()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(
@@ -109,14 +212,23 @@ func (s *service) Start() {
 	if err != nil {
 		log.Fatal("failed to bind server to port", err, slog.Int("port", int(config.Tester.Port)))
 	}
+	s.addr = l.Addr()
+	close(s.listening)
+
+	switch {
+	case config.Tester.Insecure:
+		log.Warn("TLS certificate verification of the target is disabled")
+	case config.Tester.SkipNameCheck:
+		log.Info("TLS name verification of the target is disabled; the certificate chain is still verified")
+	}
 
 	log.Info(
 		"tester service is listening",
-		slog.Int("port", int(config.Tester.Port)),
+		slog.Int("port", l.Addr().(*net.TCPAddr).Port),
 	)
 
 	s.server = &http.Server{
-		Addr:              fmt.Sprintf(":%d", config.Tester.Port),
+		Addr:              l.Addr().String(),
 		Handler:           mux,
 		ReadHeaderTimeout: time.Minute,
 	}
@@ -127,19 +239,34 @@ func (s *service) Start() {
 		}
 	}()
 
-	<-s.terminated
+	shared.AwaitTermination(s.terminated, s.shutdown)
+}
+
+// Addr returns the address the tester listens on, once bound.
+func (s *service) Addr() net.Addr {
+	<-s.listening
+	return s.addr
+}
+
+// healthy reports whether the service is up and not shutting down.
+func (s *service) healthy() bool {
+	return !s.shuttingDown.Load()
 }
 
 func (s *service) shutdown() {
 	s.shutdownOnce.Do(
 		func() {
+			s.shuttingDown.Store(true)
 			log.Info("shutting down tester server; hrtester process will terminate")
 			go func() {
 				defer close(s.terminated)
-				if s.testCancel != nil {
-					s.testCancel()
+				if ri := s.run.Load(); ri != nil {
+					ri.cancel()
+				}
+				if cancel := s.cancelWait.Load(); cancel != nil {
+					(*cancel)()
 				}
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 				defer cancel()
 				if err := s.server.Shutdown(ctx); err != nil {
 					log.Warn("server forced to shut down", slog.Any("err", err))
@@ -153,82 +280,158 @@ func (s *service) shutdown() {
 
 func (s *service) handleTest(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
+	case http.MethodGet:
+		ri := s.run.Load()
+		if ri == nil {
+			shared.HTTPError(w, "No test has been configured.", http.StatusNotFound)
+			return
+		}
+		b, err := json.Marshal(ri.params)
+		if err != nil {
+			log.Debug("failed to marshal params", slog.Any("err", err))
+			shared.HTTPError(
+				w,
+				http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
 	case http.MethodPost:
-		if b, err := io.ReadAll(r.Body); err == nil {
-			if err = json.Unmarshal(b, &s.params); err != nil {
-				http.Error(
+		// Parse into a copy, so an invalid request leaves the current
+		// params untouched.
+		var p params
+		if err := s.readParams(w, r, &p); err != nil {
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr):
+				shared.HTTPError(
+					w,
+					fmt.Sprintf("Params exceed %d bytes", maxErr.Limit),
+					http.StatusRequestEntityTooLarge,
+				)
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				shared.HTTPError(
+					w,
+					"Timed out reading the params",
+					http.StatusRequestTimeout,
+				)
+			default:
+				shared.HTTPError(
 					w,
-					fmt.Sprintf("Malformed JSON: %v", err),
+					fmt.Sprintf("Invalid params: %v", err),
 					http.StatusBadRequest,
 				)
-				return
 			}
-		} else {
-			http.Error(
-				w,
-				"Failed to read request body",
-				http.StatusBadRequest,
-			)
-			log.Debug("failed to read request body", slog.Any("err", err))
+			log.Debug("failed to read params", slog.Any("err", err))
 			return
 		}
-		if s.params.Duration < 0 {
-			http.Error(
+		schedule, err := p.prepare()
+		if err == nil {
+			err = p.capDuration(config.Tester.MaxDuration)
+		}
+		if err != nil {
+			shared.HTTPError(
 				w,
-				"Invalid service duration: must be >= 0",
+				fmt.Sprintf("Invalid %v", err),
 				http.StatusBadRequest,
 			)
 			return
 		}
-		if s.params.ReqSchema == "" {
-			s.params.ReqSchema = "http"
-		}
-		if s.params.ReqVersion == [...]uint8{0, 0} {
-			s.params.ReqVersion = [...]uint8{1, 1}
-		}
-		if s.params.ReqIDHeader == "" {
-			s.params.ReqIDHeader = "X-Request-ID"
-		}
-		log.Info(
+		// Every log line of the run carries its ID.
+		runID := newRunID()
+		logger := log.With(slog.String("runID", runID))
+		logger.Info(
 			"loaded test service config",
-			slog.String("name", s.params.Name),
-			slog.Any("duration", s.params.Duration),
-			slog.Any("pace", s.params.Pace),
-			slog.Uint64("parallelTesters", uint64(s.params.ParallelTesters)),
+			slog.String("name", p.Name),
+			slog.Any("duration", p.Duration),
+			slog.Any("pace", p.Pace),
+			slog.Uint64("parallelTesters", uint64(p.ParallelTesters)),
+			slog.Uint64("inFlightPerTester", uint64(p.InFlightPerTester)),
+			slog.Uint64("warmupRequests", uint64(p.WarmupRequests)),
+			slog.Int("spikes", len(p.Spikes)),
+			slog.Uint64("seed", *p.Seed),
+			slog.Group(
+				"connPool",
+				slog.Int("maxIdleConns", p.MaxIdleConns),
+				slog.Int("maxIdleConnsPerHost", p.MaxIdleConnsPerHost),
+				slog.Int("maxConnsPerHost", p.MaxConnsPerHost),
+				slog.Any("idleConnTimeout", p.IdleConnTimeout),
+			),
+			slog.Group(
+				"buffers",
+				slog.Int("results", int(p.ParallelTesters)*int(p.InFlightPerTester)*p.ResultsBufferSize),
+				slog.Int("ids", p.IDsBufferSize),
+			),
 		)
 
-		if !s.status.CompareAndSwap(statusReady, statusTesting) {
-			http.Error(
+		if err := s.probeCollectors(logger); err != nil {
+			shared.HTTPError(
+				w,
+				fmt.Sprintf("Collectors are unreachable: %v", err),
+				http.StatusBadGateway,
+			)
+			return
+		}
+
+		if !s.status.CompareAndSwap(statusReady, statusWaiting) {
+			shared.HTTPError(
 				w,
 				"Service is already running. Please try again later.",
 				http.StatusServiceUnavailable,
 			)
+			return
 		}
-		s.startedAt = time.Now()
-		s.runningUntil = s.startedAt.Add(time.Duration(s.params.Duration))
-		ctx, cancel := context.WithDeadline(context.Background(), s.runningUntil)
-		s.testCtx, s.testCancel = ctx, cancel
-		s.startSender()
-		s.startIDGen()
-		s.startTesters()
-		go func() {
-			<-s.testCtx.Done()
-			<-s.testersDone
-			close(s.results)
+		// A shutdown cancels the wait as it does a run.
+		waitCtx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		s.cancelWait.Store(&cancel)
+		defer s.cancelWait.Store(nil)
+		if s.shuttingDown.Load() {
+			cancel()
+		}
+		if p.WaitForTarget > 0 {
+			if err := s.waitForTarget(waitCtx, time.Duration(p.WaitForTarget), logger); err != nil {
+				s.status.Store(statusReady)
+				shared.HTTPError(
+					w,
+					fmt.Sprintf("Target did not come up: %v", err),
+					http.StatusGatewayTimeout,
+				)
+				return
+			}
+		}
+		if pf := p.preflight(); pf != nil {
+			// The params of the service belong to the last run until this
+			// one starts.
+			if err := s.runPreflight(waitCtx, &p, pf, logger); err != nil {
+				s.status.Store(statusReady)
+				shared.HTTPError(
+					w,
+					fmt.Sprintf("Preflight failed: %v", err),
+					http.StatusUnprocessableEntity,
+				)
+				return
+			}
+			logger.Info("preflight passed", slog.Int("requests", len(p.Requests)))
+		}
+		if s.shuttingDown.Load() {
 			s.status.Store(statusReady)
-			log.Info(
-				"tester service has stopped",
-				slog.Time("startedAt", s.startedAt),
+			shared.HTTPError(
+				w,
+				"Service is shutting down.",
+				http.StatusServiceUnavailable,
 			)
-		}()
+			return
+		}
+		s.status.Store(statusTesting)
+		s.startRun(context.Background(), p, schedule, runID, logger)
 		w.WriteHeader(http.StatusOK)
-		log.Info(
-			"tester service has started",
-			slog.Time("finishesAt", s.runningUntil),
-		)
 	default:
-		w.Header().Set("Allow", http.MethodPost)
-		http.Error(
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusMethodNotAllowed),
 			http.StatusMethodNotAllowed,
@@ -236,33 +439,45 @@ func (s *service) handleTest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// readParams reads the params of a test request into p, JSON or YAML as the
+// content type says. The body is bounded in size and read time.
+func (s *service) readParams(w http.ResponseWriter, r *http.Request, p *params) error {
+	// Not every ResponseWriter supports deadlines; the size bound holds
+	// anyway.
+	http.NewResponseController(w).SetReadDeadline(time.Now().Add(paramsReadTimeout))
+	body := http.MaxBytesReader(w, r.Body, maxParamsBytes)
+	if !shared.IsYAML(r.Header.Get("Content-Type")) {
+		if err := decodeParams(body, p); err != nil {
+			return fmt.Errorf("malformed JSON: %w", err)
+		}
+		return nil
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if b, err = shared.YAMLToJSON(b); err != nil {
+		return fmt.Errorf("malformed YAML: %w", err)
+	}
+	if err := decodeParams(bytes.NewReader(b), p); err != nil {
+		return fmt.Errorf("malformed JSON: %w", err)
+	}
+	return nil
+}
+
 func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/__service", "/__service/":
 		switch r.Method {
 		case http.MethodGet:
-			var body struct {
-				Status   string          `json:"status"`
-				Duration shared.Duration `json:"duration,omitempty"`
-			}
-
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			w.WriteHeader(http.StatusOK)
 
-			switch s.status.Load() {
-			case statusReady:
-				body.Status = "ready"
-			case statusTesting:
-				body.Status = "testing"
-				body.Duration = shared.Duration(time.Until(s.runningUntil))
-			case statusStopping:
-				body.Status = "stopping"
-			}
-
+			body := s.serviceStatus()
 			b, err := json.Marshal(body)
 			if err != nil {
 				log.Debug("failed to marshal response body", slog.Any("err", err))
-				http.Error(
+				shared.HTTPError(
 					w,
 					http.StatusText(http.StatusInternalServerError),
 					http.StatusInternalServerError,
@@ -272,21 +487,29 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			w.Write(b)
 		default:
 			w.Header().Set("Allow", http.MethodGet)
-			http.Error(
+			shared.HTTPError(
 				w,
 				http.StatusText(http.StatusMethodNotAllowed),
 				http.StatusMethodNotAllowed,
 			)
 			return
 		}
+	case "/__service/stats", "/__service/stats/":
+		s.handleStats(w, r)
+	case "/__service/health", "/__service/health/":
+		shared.HandleHealth(w, r, s.healthy())
 	case "/__service/terminate", "/__service/terminate/":
 		switch r.Method {
 		case http.MethodPost:
+			if r.URL.Query().Has("wait") {
+				s.handleTerminateWait(w, r)
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			s.shutdown()
 		default:
 			w.Header().Set("Allow", http.MethodPost)
-			http.Error(
+			shared.HTTPError(
 				w,
 				http.StatusText(http.StatusMethodNotAllowed),
 				http.StatusMethodNotAllowed,
@@ -294,7 +517,7 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	default:
-		http.Error(
+		shared.HTTPError(
 			w,
 			http.StatusText(http.StatusNotFound),
 			http.StatusNotFound,
@@ -303,253 +526,990 @@ func (s *service) handleService(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// runInfo describes a run. It is never modified once stored, but replaced as a
+// whole, so the status handlers read a consistent snapshot while a run starts
+// or ends.
+type runInfo struct {
+	id     string
+	params params
+	replay bool
+	stats  *shared.Stats
+	// runningUntil is zero for runs without a duration, stoppedAt until the
+	// run has wound down.
+	startedAt    time.Time
+	runningUntil time.Time
+	stoppedAt    time.Time
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// startRun starts a run of p. The run ends when its duration is over, it is
+// aborted or parent is done; the done channel of its runInfo is closed once it
+// has wound down. A run without a duration lasts until it is stopped.
+func (s *service) startRun(parent context.Context, p params, schedule []replayEntry, runID string, logger *log.Logger) {
+	s.params = p
+	s.logger = logger
+	s.schedule = schedule
+	s.testerClients = s.newTesterClients()
+	s.bandwidth = nil
+	if s.params.BandwidthLimit > 0 {
+		s.bandwidth = make([]*rate.Limiter, s.params.ParallelTesters)
+		for i := range s.bandwidth {
+			s.bandwidth[i] = newBandwidthLimiter(s.params.BandwidthLimit)
+		}
+	}
+	if s.params.WarmupConnections {
+		s.warmupConnections(parent)
+	}
+	s.bodySampler = nil
+	if s.params.BodySamples.enabled() {
+		s.bodySampler = newBodySampler(
+			s.params.BodySamples,
+			filepath.Join(config.Tester.BodySamplesDir, runID),
+		)
+	}
+	s.requests.Store(0)
+	s.overruns.Store(0)
+	s.failures.Store(0)
+	s.errored.Store(0)
+	s.timeouts.Store(0)
+	s.warmups.Store(0)
+	s.connWaits.reset()
+	s.stats = shared.NewStats()
+	ri := &runInfo{
+		id:        runID,
+		params:    p,
+		replay:    schedule != nil,
+		stats:     s.stats,
+		startedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+	s.abortReason.Store(nil)
+	s.errWindow = nil
+	if s.params.AbortOnErrorRate > 0 {
+		s.errWindow = newErrorWindow(ri.startedAt, time.Duration(s.params.AbortWindow))
+	}
+	if s.params.indefinite() {
+		s.testCtx, s.testCancel = context.WithCancel(parent)
+	} else {
+		ri.runningUntil = ri.startedAt.Add(time.Duration(s.params.Duration))
+		s.testCtx, s.testCancel = context.WithDeadline(parent, ri.runningUntil)
+	}
+	s.measured = nil
+	if w := s.params.MeasurementWindow; w != nil {
+		s.measured = w.bounds(ri.startedAt, ri.runningUntil)
+	}
+	ri.cancel = s.testCancel
+	s.run.Store(ri)
+	s.sendStartEvent(ri)
+	s.startSender()
+	s.startIDGen()
+	s.startTesters()
+	progressDone := make(chan struct{})
+	if config.Tester.ProgressInterval > 0 {
+		go func() {
+			defer close(progressDone)
+			s.logProgress(s.testCtx, ri, s.logger, config.Tester.ProgressInterval)
+		}()
+	} else {
+		close(progressDone)
+	}
+	go func() {
+		defer close(ri.done)
+		<-s.testCtx.Done()
+		<-s.testersDone
+		<-progressDone
+		close(s.idGenDone)
+		close(s.results)
+		<-s.senderDone
+		ended := *ri
+		ended.stoppedAt = time.Now()
+		s.run.Store(&ended)
+		s.sendRunEvent(shared.RunEvent{
+			Event:    shared.RunEventEnd,
+			RunID:    ended.id,
+			Name:     s.params.Name,
+			Time:     ended.stoppedAt,
+			Requests: s.requests.Load(),
+		})
+		s.logger.Info(
+			"tester service has stopped",
+			slog.Time("startedAt", ended.startedAt),
+			slog.Uint64("requests", s.requests.Load()),
+			slog.Uint64("failures", s.failures.Load()),
+			slog.Any("achievedPace", s.achievedPace(&ended)),
+		)
+		if buf := s.resultsBuffer.status(); buf.Peak > buf.Size/2 {
+			s.logger.Warn(
+				"results buffer was more than half full; the collector could not keep up",
+				slog.Int64("peak", buf.Peak),
+				slog.Int64("size", buf.Size),
+				slog.Int64("peakPercentage", buf.PeakPercentage),
+			)
+		} else if !s.embedded {
+			s.logger.Info(
+				"results buffer peak",
+				slog.Int64("peak", buf.Peak),
+				slog.Int64("size", buf.Size),
+				slog.Int64("peakPercentage", buf.PeakPercentage),
+			)
+		}
+		if n, longest := s.connWaits.load(); n > 0 {
+			s.logger.Warn(
+				"requests waited for a free connection; raise maxConnsPerHost if the target allows",
+				slog.Uint64("count", n),
+				slog.Any("longest", shared.Duration(longest)),
+				slog.Int("maxConnsPerHost", s.params.MaxConnsPerHost),
+			)
+		}
+		if n := s.warmups.Load(); n > 0 {
+			s.logger.Info(
+				"warmup requests excluded from results",
+				slog.Uint64("count", n),
+			)
+		}
+		if s.saturated(&ended) {
+			s.logger.Warn(
+				"target could not keep up with the configured pace",
+				slog.Any("pace", s.params.Pace),
+				slog.Any("achievedPace", s.achievedPace(&ended)),
+				slog.Uint64("overruns", s.overruns.Load()),
+			)
+		}
+		// The next run may start once the status is ready, so the summary
+		// above must be done with the fields of this one.
+		s.status.Store(statusReady)
+	}()
+	if s.params.indefinite() {
+		s.logger.Info("tester service has started; running until stopped")
+	} else {
+		s.logger.Info(
+			"tester service has started",
+			slog.Time("finishesAt", ri.runningUntil),
+		)
+	}
+}
+
+type serviceStatus struct {
+	Status       string          `json:"status"`
+	RunID        string          `json:"runID,omitempty"`
+	Duration     shared.Duration `json:"duration,omitempty"`
+	Pace         pace            `json:"pace,omitempty"`
+	AchievedPace rpm             `json:"achievedPace,omitempty"`
+	Saturated    bool            `json:"saturated,omitempty"`
+	Requests     uint64          `json:"requests,omitempty"`
+	Failures     uint64          `json:"failures,omitempty"`
+	AbortReason  string          `json:"abortReason,omitempty"`
+	// ResultsBuffer is the occupancy of the results buffer of the current
+	// or last run.
+	ResultsBuffer *bufferStatus `json:"resultsBuffer,omitempty"`
+}
+
+func (s *service) serviceStatus() serviceStatus {
+	var st serviceStatus
+	ri := s.run.Load()
+	if ri != nil {
+		st.RunID = ri.id
+		st.Pace = ri.params.Pace
+		st.AchievedPace = s.achievedPace(ri)
+		st.Saturated = s.saturated(ri)
+		st.Requests = s.requests.Load()
+		st.Failures = s.failures.Load()
+		buf := s.resultsBuffer.status()
+		st.ResultsBuffer = &buf
+	}
+	switch s.status.Load() {
+	case statusReady:
+		st.Status = "ready"
+	case statusWaiting:
+		st.Status = "waiting"
+	case statusTesting:
+		st.Status = "testing"
+		// Runs without a duration have no time remaining to report, nor
+		// has a run that is still being set up.
+		if ri != nil && ri.stoppedAt.IsZero() && !ri.runningUntil.IsZero() {
+			st.Duration = shared.Duration(time.Until(ri.runningUntil))
+		}
+	case statusStopping:
+		st.Status = "stopping"
+	}
+	// An aborted run stays reported as such until the next run starts.
+	if reason := s.abortReason.Load(); reason != nil && ri != nil {
+		st.Status = "aborted"
+		st.AbortReason = *reason
+		st.Duration = 0
+	}
+	return st
+}
+
+// handleTerminateWait stops the current run, waits up to the timeout given by
+// the wait query parameter for it to wind down and responds with the final
+// status before shutting down.
+func (s *service) handleTerminateWait(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultTerminateWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			shared.HTTPError(
+				w,
+				"Invalid wait: must be a positive duration",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		timeout = d
+	}
+
+	if ri := s.run.Load(); ri != nil {
+		ri.cancel()
+		select {
+		case <-ri.done:
+		case <-time.After(timeout):
+			log.Warn("run did not stop in time", slog.Any("timeout", shared.Duration(timeout)))
+		}
+	}
+
+	b, err := json.Marshal(s.serviceStatus())
+	if err != nil {
+		log.Debug("failed to marshal response body", slog.Any("err", err))
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	}
+	s.shutdown()
+}
+
+// handleStats responds with the stats of the current or last run, empty
+// before the first run.
+func (s *service) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+	stats := shared.NewStats()
+	if ri := s.run.Load(); ri != nil {
+		stats = ri.stats
+	}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		log.Debug("failed to marshal response body", slog.Any("err", err))
+		shared.HTTPError(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
+// sendStartEvent announces the run to the collector along with its params and
+// a short hash of them.
+func (s *service) sendStartEvent(ri *runInfo) {
+	ev := shared.RunEvent{
+		Event: shared.RunEventStart,
+		RunID: ri.id,
+		Name:  s.params.Name,
+		Time:  ri.startedAt,
+	}
+	if b, err := json.Marshal(s.params); err == nil {
+		sum := sha256.Sum256(b)
+		ev.ParamsHash = hex.EncodeToString(sum[:8])
+		ev.Params = b
+	} else {
+		s.logger.Warn("failed to marshal params for the start event", slog.Any("err", err))
+	}
+	s.sendRunEvent(ev)
+}
+
+// probeCollectors checks that the collectors accept connections. Unreachable
+// collectors are logged; it fails only if none of them is reachable.
+func (s *service) probeCollectors(logger *log.Logger) error {
+	var errs []error
+	for _, c := range s.collectors {
+		logger.Debug("probing collector", slog.String("collector", c.addr))
+		conn, err := net.DialTimeout("tcp", c.addr, collectorProbeTimeout)
+		if err != nil {
+			logger.Error("collector is unreachable", err, slog.String("collector", c.addr))
+			errs = append(errs, fmt.Errorf("%s: %v", c.addr, err))
+			continue
+		}
+		conn.Close()
+	}
+	if len(errs) == len(s.collectors) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
 func (s *service) startSender() {
 	s.results = make(
 		chan shared.TestResult,
-		s.params.ParallelTesters*resultsBufferSize,
+		int(s.params.ParallelTesters)*int(s.params.InFlightPerTester)*s.params.ResultsBufferSize,
 	)
+	s.resultsBuffer.reset(cap(s.results))
+	s.senderDone = make(chan struct{})
 	go func() {
-		c := &http.Client{
-			Timeout: 1 * time.Second,
-		}
-		u := (&url.URL{Scheme: "http", Host: config.Tester.Collector}).String()
-		for res := range s.results {
-			if len(s.results) > cap(s.results)/2 {
-				log.Warn(
-					"results buffer saturation",
-					slog.Int("precentage", len(s.results)*100/cap(s.results)),
-				)
+		defer close(s.senderDone)
+		if s.embedded {
+			for range s.results {
 			}
-			req, err := http.NewRequest(
-				http.MethodPost,
-				u,
-				strings.NewReader(res.URLValues().Encode()),
-			)
-			if err != nil {
-				log.Error("failed to create request for collector", err)
-				continue
-			}
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-			c.Do(req)
+			return
 		}
+		s.sendResults()
 	}()
-	log.Debug("result sender started")
+	s.logger.Debug("result sender started")
 }
 
 func (s *service) startIDGen() {
-	s.ids = make(chan uuid.UUID, idsBufferSize)
+	s.ids = make(chan string, s.params.IDsBufferSize)
 	s.idGenDone = make(chan struct{})
-	go func() {
-		defer close(s.ids)
+	next := newIDGen(s.params.ReqIDFormat)
+	// The generator may outlive the run by a moment, so it must not read the
+	// fields the next run sets.
+	go func(ids chan<- string, done <-chan struct{}) {
+		defer close(ids)
 		for {
 			select {
-			case s.ids <- uuid.New():
-			case <-s.idGenDone:
+			case ids <- next():
+			case <-done:
 				return
 			}
 		}
-	}()
-	log.Debug("id generator started")
+	}(s.ids, s.idGenDone)
+	s.logger.Debug("id generator started")
+}
+
+// newRunID returns a short random ID for a test run.
+func newRunID() string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], rand.Uint64())
+	return hex.EncodeToString(b[:])
+}
+
+// newIDGen returns a generator of request IDs in the given format.
+func newIDGen(f idFormat) func() string {
+	switch f {
+	case "sequential":
+		var n uint64
+		return func() string {
+			n++
+			return strconv.FormatUint(n, 10)
+		}
+	case "traceparent":
+		return func() string {
+			// version-traceid-parentid-flags, see https://www.w3.org/TR/trace-context/
+			var parent [8]byte
+			binary.BigEndian.PutUint64(parent[:], rand.Uint64()|1)
+			trace := uuid.New()
+			return "00-" + hex.EncodeToString(trace[:]) + "-" + hex.EncodeToString(parent[:]) + "-01"
+		}
+	default:
+		return func() string {
+			return uuid.New().String()
+		}
+	}
 }
 
 func (s *service) startTesters() {
 	s.testersDone = make(chan struct{})
 	go runTesters(s)
-	log.Debug("target testers started")
+	s.logger.Debug("target testers started")
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
 func runTesters(s *service) {
-	totalRequests := &atomic.Uint64{}
-	targetDuration :=
-		time.Duration(
-			int64(math.Floor(6.0e4/float64(s.params.Pace))),
-		) * time.Millisecond
-	log.Debug(
+	defer close(s.testersDone)
+
+	if s.schedule != nil {
+		runReplay(s)
+		return
+	}
+
+	pacers := s.newPacers()
+	s.logger.Debug(
 		"starting testers",
 		slog.Int("paralletTesters", int(s.params.ParallelTesters)),
-		slog.String("targetDuration", targetDuration.Truncate(time.Millisecond).String()),
+		slog.String("targetDuration", pacers[0].interval.Round(time.Microsecond).String()),
 	)
+	for _, pc := range pacers {
+		if pc.name != scheduleRun {
+			s.logger.Debug(
+				"request paced on its own",
+				slog.String("schedule", pc.name),
+				slog.String("targetDuration", pc.interval.Round(time.Microsecond).String()),
+			)
+		}
+	}
+	// Spikes raise the pace of the run only.
+	if len(s.params.Spikes) > 0 && pacers[0].name == scheduleRun {
+		go s.runSpikes(pacers[0].limiter)
+	}
 
-	// Stagger tester startup across min(spinupMaxDuration, 1/spinupFactor of total test duration)
-	spinup := time.Duration(s.params.Duration).Nanoseconds() / int64(spinupFactor)
+	// Stagger tester startup across min(spinupMaxDuration, 1/spinupFactor of
+	// total test duration), or spinupIndefinite for runs without a duration.
+	spinup := time.Duration(s.params.Duration) / spinupFactor
 	if spinup > spinupMaxDuration {
 		spinup = spinupMaxDuration
 	}
-	spinup = spinup / int64(s.params.ParallelTesters)
+	if s.params.indefinite() {
+		spinup = spinupIndefinite
+	}
+
+	rampUp(s.testCtx, int(s.params.ParallelTesters), spinup, func(i int) {
+		s.logger.Debug("starting tester", slog.Int("num", i))
 
+		var loops sync.WaitGroup
+		for j, pc := range pacers {
+			var randSrc *rand.Rand
+			if j == 0 {
+				// Each tester has its own stream of the run's seed.
+				// Only the pacer of the run chooses among requests.
+				randSrc = rand.New(rand.NewPCG(*s.params.Seed, uint64(i)))
+			}
+			loops.Add(1)
+			go func() {
+				defer loops.Done()
+				s.runPacer(i, pc, randSrc)
+			}()
+		}
+		loops.Wait()
+	})
+}
+
+// rampUp runs start for each of n testers in its own goroutine, after a random
+// delay within window, and waits for them all to return. The delays run
+// concurrently, so the last tester starts within window however many there
+// are. Testers whose delay is cut short by ctx do not start.
+func rampUp(ctx context.Context, n int, window time.Duration, start func(i int)) {
 	wg := sync.WaitGroup{}
-	for i := range int(s.params.ParallelTesters) {
-		time.Sleep(time.Duration(rand.Int64N(spinup)))
+	for i := range n {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
-			log.Debug("starting tester", slog.Int("num", i))
+			if window > 0 {
+				t := time.NewTimer(time.Duration(rand.Int64N(int64(window))))
+				defer t.Stop()
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+			}
+			start(i)
+		}()
+	}
+	wg.Wait()
+}
 
-			var (
-				client         = &http.Client{}
-				randSrc        = rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
-				targetDuration = targetDuration * time.Duration(s.params.ParallelTesters)
-				localN         = 0
+// runPacer sends the requests of pc from tester until the run ends. The
+// tester has up to inFlightPerTester requests of each of its pacers in flight.
+func (s *service) runPacer(tester int, pc *pacer, randSrc *rand.Rand) {
+	var (
+		clients = s.testerClients[tester]
+		// A round trip slower than this means the tester cannot keep up
+		// with its share of the pace.
+		overrunDuration = pc.interval *
+			time.Duration(s.params.ParallelTesters) *
+			time.Duration(s.params.InFlightPerTester)
+		localN = 0
 
-				r request
-			)
+		// vars holds the values captured in the current sequence iteration
+		// of the tester.
+		vars map[string]string
 
-			if s.params.ReqSchema == "https" {
-				c := tls.Config{}
-				if config.Tester.SkipNameCheck {
-					c.InsecureSkipVerify = true
-					c.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-						opts := x509.VerifyOptions{
-							Roots: s.rootCAs,
-						}
-						var (
-							cert *x509.Certificate
-							err  error
-						)
-						switch n := len(rawCerts); n {
-						case 0:
-							return fmt.Errorf("no server certificate received")
-						case 1:
-							if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
-								return fmt.Errorf("failed to parse certificate: %w", err)
-							}
-						default:
-							if cert, err = x509.ParseCertificate(rawCerts[0]); err != nil {
-								return fmt.Errorf("failed to parse certificate: %w", err)
-							}
-							opts.Intermediates = x509.NewCertPool()
-							for _, rc := range rawCerts[1:] {
-								c, err := x509.ParseCertificate(rc)
-								if err != nil {
-									return fmt.Errorf("failed to parse certificate: %w", err)
-								}
-								opts.Intermediates.AddCert(c)
-							}
-						}
-						_, err = cert.Verify(opts)
-						if err != nil {
-							return fmt.Errorf("certificate verification failed: %w", err)
-						}
-						return nil
-					}
-				}
-				if s.rootCAs != nil {
-					c.RootCAs = s.rootCAs
-				}
-				if s.clientCert != nil {
-					c.Certificates = []tls.Certificate{*s.clientCert}
-				}
-				client.Transport = &http.Transport{
-					IdleConnTimeout:     30 * time.Second,
-					MaxIdleConns:        100,
-					MaxIdleConnsPerHost: int(s.params.ParallelTesters),
-					TLSClientConfig:     &c,
-				}
+		// slots bounds the requests in flight.
+		slots    = make(chan struct{}, s.params.InFlightPerTester)
+		inFlight sync.WaitGroup
+
+		// resumeAt holds all the slots back until the backoff requested by
+		// the target is over.
+		resumeAt atomic.Int64
+	)
+	defer inFlight.Wait()
+	if s.params.Choice == "sequence" && len(pc.requests) > 0 {
+		vars = make(map[string]string)
+	}
+
+	for {
+		select {
+		case <-s.testCtx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+		if !s.waitResume(&resumeAt) {
+			return
+		}
+		if err := pc.limiter.Wait(s.testCtx); err != nil {
+			return
+		}
+
+		globalN := s.requests.Add(1)
+		localN++
+		r := pc.pick(s.params.Choice, localN, randSrc)
+		// A sequence iteration starts with no captured values.
+		if vars != nil && (localN-1)%len(pc.requests) == 0 {
+			clear(vars)
+		}
+		warmup := localN <= int(s.params.WarmupRequests)
+
+		inFlight.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				inFlight.Done()
+			}()
+
+			start := time.Now()
+			var (
+				tRes shared.TestResult
+				body []byte
+				err  error
+			)
+			if s.params.DialOnly {
+				tRes = s.dial(clients.get(r), globalN)
 			} else {
-				client.Transport = &http.Transport{
-					IdleConnTimeout:     30 * time.Second,
-					MaxIdleConns:        100,
-					MaxIdleConnsPerHost: int(s.params.ParallelTesters),
-				}
+				tRes, body, err = s.roundTrip(clients.get(r), tester, globalN, r, vars)
+			}
+			if err != nil {
+				s.logger.Error("failed to create request", err)
+				return
+			}
+			tRes.SetSchedule(pc.name)
+			if time.Since(start) >= overrunDuration {
+				s.overruns.Add(1)
 			}
+			if warmup {
+				s.warmups.Add(1)
+			} else {
+				s.judge(&tRes, r, body)
+				s.results <- tRes
+			}
+			holdOff(&resumeAt, tRes)
+		}()
+	}
+}
 
-			for {
-				select {
-				case <-s.testCtx.Done():
-					return
-				default:
-					globalN := totalRequests.Add(1)
-					localN++
-					if n := len(s.params.Requests); n == 1 {
-						r = s.params.Requests[0]
-					} else {
-						switch s.params.Choice {
-						case "roundrobin":
-							r = s.params.Requests[localN%n]
-						case "random":
-							r = s.params.Requests[randSrc.IntN(n)]
-						}
-					}
-
-					u := &url.URL{
-						Scheme: string(s.params.ReqSchema),
-						Host:   config.Tester.Target,
-						Path:   r.Path,
-					}
-					reqCtx, reqCancel := context.WithTimeout(
-						context.Background(),
-						time.Duration(s.params.Timeout),
-					)
-					req, err := http.NewRequestWithContext(
-						reqCtx,
-						string(r.Method),
-						u.String(),
-						strings.NewReader(r.Body),
-					)
-					if err != nil {
-						log.Error("failed to create request", err)
-						reqCancel()
-						continue
-					}
-					for k, v := range r.Header {
-						req.Header[k] = append([]string(nil), v...)
-					}
-					id := <-s.ids
-					req.Header.Add(s.params.ReqIDHeader, id.String())
-
-					var tRes shared.TestResult
-					start := time.Now()
-					log.Debug(
-						"request",
-						slog.Group(
-							"client",
-							slog.Int("num", i),
-						),
-						slog.Group(
-							"request",
-							slog.Int("num", int(globalN)),
-							slog.String("path", r.Path),
-						),
-					)
-					tRes.SetRequestTime(start.Truncate(time.Millisecond))
-					resp, err := client.Do(req)
-					reqCancel()
-					if err != nil {
-						if errors.Is(err, context.DeadlineExceeded) {
-							tRes.SetTimedOut(true)
-						} else {
-							log.Error("request failed", err, slog.Any("url", u))
-						}
-					} else {
-						tRes.SetTimedOut(false)
-					}
-					elapsed := time.Since(start).Truncate(time.Millisecond)
-					tRes.SetTestName(s.params.Name)
-					tRes.SetRequestID(id)
-					tRes.SetRequestNum(globalN)
-					tRes.SetRequesMethod(string(r.Method))
-					tRes.SetRequestPath(r.Path)
-					tRes.SetRoundDuration(shared.Duration(elapsed))
-					if resp != nil {
-						tRes.SetResponseCode(resp.StatusCode)
-						io.Copy(io.Discard, resp.Body)
-						resp.Body.Close()
-					}
-					if elapsed < targetDuration {
-						time.Sleep(targetDuration - elapsed)
-					}
-					s.results <- tRes
+////////////////////////////////////////////////////////////////////////////////
+
+// achievedPace returns the pace reached by the run ri, the current or last.
+func (s *service) achievedPace(ri *runInfo) rpm {
+	end := ri.stoppedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	elapsed := end.Sub(ri.startedAt).Minutes()
+	if elapsed <= 0 {
+		return 0
+	}
+	return rpm(math.Round(float64(s.requests.Load()) / elapsed))
+}
+
+// saturated reports whether the target failed to keep up with the configured
+// pace in the run ri, the current or last.
+func (s *service) saturated(ri *runInfo) bool {
+	if ri.replay {
+		return false
+	}
+	return s.overruns.Load()*saturationFactor > s.requests.Load()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// roundTrip sends r and records its result. In sequence mode, vars holds the
+// captured values that r references and receives those it captures.
+func (s *service) roundTrip(client *http.Client, tester int, globalN uint64, r request, vars map[string]string) (shared.TestResult, []byte, error) {
+	var tRes shared.TestResult
+
+	id := <-s.ids
+	// Results are recorded under the path as configured, not as rendered.
+	path := r.path()
+	if r.templates != nil {
+		var err error
+		data := templateData{Captured: vars, RequestID: id, RequestNum: globalN}
+		if r, err = r.render(data); err != nil {
+			return tRes, nil, err
+		}
+	}
+
+	u := r.targetURL(s.params.ReqSchema, s.target)
+	reqCtx, reqCancel := context.WithTimeout(
+		context.Background(),
+		s.params.requestTimeout(r),
+	)
+	defer reqCancel()
+	var bw *rate.Limiter
+	if s.bandwidth != nil {
+		bw = s.bandwidth[tester]
+	}
+	// newRequest builds a request for every attempt, traced by trace.
+	newRequest := func(trace *connTrace) (*http.Request, error) {
+		var body io.Reader = strings.NewReader(r.Body)
+		if r.BodySize > 0 {
+			body = &fillReader{n: r.BodySize}
+		}
+		if bw != nil && s.params.ThrottleUploads && (r.BodySize > 0 || r.Body != "") {
+			body = &throttledReader{ctx: reqCtx, r: body, l: bw}
+		}
+		req, err := http.NewRequestWithContext(
+			httptrace.WithClientTrace(reqCtx, trace.clientTrace()),
+			string(r.Method),
+			u.String(),
+			body,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if r.BodySize > 0 {
+			req.ContentLength = r.BodySize
+			if r.Chunked {
+				req.ContentLength = -1
+			}
+		} else if _, ok := body.(*throttledReader); ok {
+			req.ContentLength = int64(len(r.Body))
+		}
+		s.params.setRequest(req, r)
+		req.Header.Add(s.params.ReqIDHeader, id)
+		return req, nil
+	}
+	trace := &connTrace{countHeaders: s.params.CountHeaderBytes}
+	req, err := newRequest(trace)
+	if err != nil {
+		return tRes, nil, err
+	}
+
+	start := time.Now()
+	if log.Enabled(slog.LevelDebug) {
+		s.logger.Debug(
+			"request",
+			slog.Group(
+				"client",
+				slog.Int("num", tester),
+			),
+			slog.Group(
+				"request",
+				slog.Int("num", int(globalN)),
+				slog.String("path", r.path()),
+			),
+		)
+	}
+	tRes.SetRequestTime(start.Truncate(time.Millisecond))
+	resp, err := client.Do(req)
+	// The target may have closed the idle connection the request was sent on,
+	// typically one opened early in the spinup. Such a request is sent once
+	// more on a new connection, and timed from there. The other idle
+	// connections are likely closed too, so the retry does not use the pool.
+	if err != nil && trace.reusedConn() && staleConnError(err) && retryable(req.Method) {
+		s.logger.Debug(
+			"retrying request after its reused connection was closed",
+			slog.Int("num", int(globalN)),
+			slog.Any("err", err),
+		)
+		trace = &connTrace{countHeaders: s.params.CountHeaderBytes}
+		if req, err = newRequest(trace); err != nil {
+			return tRes, nil, err
+		}
+		start = time.Now()
+		tRes.SetRequestTime(start.Truncate(time.Millisecond))
+		tRes.SetRetried(true)
+		resp, err = newConnClient(client).Do(req)
+	}
+	elapsed := time.Since(start).Truncate(time.Millisecond)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			tRes.SetTimedOut(true)
+			tRes.SetErrorClass(errClassTimeout)
+		} else if isTLS, attrs := classifyTLSError(err); isTLS {
+			tRes.SetTimedOut(false)
+			tRes.SetErrorClass(errClassTLS)
+			s.logger.Error(
+				"TLS handshake failed",
+				err,
+				append([]slog.Attr{slog.Any("url", u)}, attrs...)...,
+			)
+		} else {
+			tRes.SetTimedOut(false)
+			tRes.SetErrorClass(errClassOther)
+			s.logger.Error("request failed", err, slog.Any("url", u))
+		}
+	} else {
+		tRes.SetTimedOut(false)
+	}
+	// checked keeps the start of the body for the criteria, if they check it.
+	var checked *sampleBuffer
+	if resp != nil {
+		// wire counts the bytes of the body as received, counted those the
+		// tester reads, which differ if it decodes the body.
+		wire := &countingBody{ReadCloser: resp.Body}
+		counted := wire
+		if s.params.CountWireBytes {
+			// Decoded bodies are throttled on the wire.
+			var src io.Reader = wire
+			if bw != nil {
+				src = &throttledReader{ctx: reqCtx, r: wire, l: bw}
+			}
+			if dec := newDecodingBody(wire, src, resp.Header.Get("Content-Encoding")); dec != nil {
+				counted = &countingBody{ReadCloser: dec}
+			}
+		}
+		resp.Body = counted
+		var sample *sampleBuffer
+		if s.bodySampler != nil &&
+			s.bodySampler.sample(resp.StatusCode, s.params.SuccessStatuses.match(resp.StatusCode)) {
+			sample = &sampleBuffer{max: s.params.BodySamples.MaxBytes}
+			counted.ReadCloser = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(counted.ReadCloser, sample), counted.ReadCloser}
+		}
+		if s.criteria(r).checksBody() {
+			checked = &sampleBuffer{max: maxCriteriaBody}
+			counted.ReadCloser = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(counted.ReadCloser, checked), counted.ReadCloser}
+		}
+		if vars != nil && len(r.Capture) > 0 {
+			if err := captureValues(resp, r.Capture, vars); err != nil {
+				s.logger.Debug("capture failed", slog.Any("err", err), slog.String("path", path))
+			}
+		}
+		var body io.Reader = counted
+		if bw != nil && counted == wire {
+			body = &throttledReader{ctx: reqCtx, r: body, l: bw}
+		}
+		rerr := s.params.ReadBody.read(body)
+		if rerr != nil && counted != wire && !errors.Is(rerr, context.DeadlineExceeded) {
+			s.logger.Debug("failed to decode response body", slog.Any("err", rerr), slog.String("path", path))
+		}
+		if s.params.ReadBody.timed() || bw != nil {
+			// The round duration includes the body read.
+			elapsed = time.Since(start).Truncate(time.Millisecond)
+			if errors.Is(rerr, context.DeadlineExceeded) {
+				tRes.SetTimedOut(true)
+				tRes.SetErrorClass(errClassTimeout)
+			}
+		}
+		tRes.SetBodyBytes(wire.n)
+		if counted != wire {
+			tRes.SetDecodedBytes(counted.n)
+		}
+		drainBody(resp.Body)
+		if sample != nil {
+			if file, err := s.bodySampler.save(id, sample.b); err != nil {
+				s.logger.Warn("failed to save response body sample", slog.Any("err", err))
+			} else {
+				s.logger.Info(
+					"response body sampled",
+					slog.String("reqID", id),
+					slog.Int("status", resp.StatusCode),
+					slog.String("file", file),
+				)
+			}
+		}
+	}
+	tRes.SetTestName(s.params.Name)
+	tRes.SetInstance(config.Tester.Instance)
+	tRes.SetRequestID(id)
+	tRes.SetRequestNum(globalN)
+	tRes.SetRequesMethod(string(r.Method))
+	tRes.SetRequestPath(path)
+	tRes.SetRequestTarget(u.Scheme, u.Host)
+	tRes.SetRoundDuration(shared.Duration(elapsed))
+	trace.record(&tRes)
+	if d := trace.queued(); d > 0 {
+		if s.connWaits.observe(d) {
+			s.logger.Warn(
+				"requests are waiting for a free connection",
+				slog.Any("waited", shared.Duration(d)),
+				slog.Int("maxConnsPerHost", s.params.MaxConnsPerHost),
+			)
+		} else {
+			s.logger.Debug(
+				"request waited for a free connection",
+				slog.String("reqID", id),
+				slog.Any("waited", shared.Duration(d)),
+			)
+		}
+	}
+	if budget := s.params.latencyBudget(r); budget > 0 {
+		// Failed and timed out requests miss the budget too.
+		tRes.SetSLAMet(tRes.ErrorClass() == "" && elapsed <= budget)
+	}
+	if resp != nil {
+		tRes.SetResponseCode(resp.StatusCode)
+		if s.params.CountHeaderBytes {
+			tRes.SetHeaderBytes(trace.requestHeaderBytes(), headerSize(resp.Header))
+		}
+		if resp.TLS != nil {
+			tRes.SetTLSVersion(tls.VersionName(resp.TLS.Version))
+		} else if v := trace.handshakeVersion(); v != 0 {
+			// HTTP/1.0 connections complete their handshake themselves.
+			tRes.SetTLSVersion(tls.VersionName(v))
+		}
+		if s.params.RespectRetryAfter {
+			if d := retryAfter(resp); d > 0 {
+				tRes.SetRetryAfter(shared.Duration(d))
+			}
+		}
+		if len(s.params.CaptureHeaders) > 0 {
+			h := make(url.Values, len(s.params.CaptureHeaders))
+			for _, n := range s.params.CaptureHeaders {
+				if v := resp.Header.Values(n); len(v) > 0 {
+					h[n] = v
 				}
 			}
-		}()
+			tRes.SetResponseHeaders(h)
+		}
+	}
+
+	if checked != nil {
+		return tRes, checked.b, nil
+	}
+	return tRes, nil, nil
+}
+
+// requestTimeout returns the timeout of r, which takes precedence over the
+// timeout of p.
+func (p *params) requestTimeout(r request) time.Duration {
+	if r.Timeout > 0 {
+		return time.Duration(r.Timeout)
+	}
+	return time.Duration(p.Timeout)
+}
+
+// latencyBudget returns the latency budget of r, which takes precedence over
+// the budget of p.
+func (p *params) latencyBudget(r request) time.Duration {
+	if r.LatencyBudget > 0 {
+		return time.Duration(r.LatencyBudget)
+	}
+	return time.Duration(p.LatencyBudget)
+}
+
+// setRequest sets the headers, Host and protocol version sent with r on req.
+func (p *params) setRequest(req *http.Request, r request) {
+	req.Header = p.requestHeader(r)
+	if host := p.requestHost(r); host != "" {
+		req.Host = host
+	}
+	p.ReqVersion.apply(req)
+}
+
+// requestHost returns the Host header sent with r, its own over that of p, or
+// "" for the target.
+func (p *params) requestHost(r request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return p.Host
+}
+
+// requestHeader merges the headers sent with r. Per-request headers take
+// precedence over the default headers, which take precedence over the
+// User-Agent.
+func (p *params) requestHeader(r request) http.Header {
+	h := make(http.Header, len(p.Headers)+len(r.Header)+2)
+	for k, v := range p.Headers {
+		h[k] = append([]string(nil), v...)
+	}
+	for k, v := range r.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	if _, ok := h["User-Agent"]; !ok {
+		ua := p.UserAgent
+		if ua == "" {
+			ua = config.Tester.UserAgent
+		}
+		h.Set("User-Agent", ua)
+	}
+	// The transport asks for gzip only when it decodes bodies itself.
+	if _, ok := h["Accept-Encoding"]; !ok && p.CountWireBytes {
+		h.Set("Accept-Encoding", "gzip, deflate")
+	}
+	return h
+}
+
+// retryAfter returns the backoff requested by a 429 or 503 response through
+// its Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// backOff sleeps for the backoff requested in tRes, returning early if the
+// test ends.
+func (s *service) backOff(tRes shared.TestResult) {
+	d := tRes.RetryAfter()
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-time.After(d):
+	case <-s.testCtx.Done():
+	}
+}
+
+// holdOff moves resumeAt, in unix nanoseconds, to the end of the backoff
+// requested in tRes, unless it is later already.
+func holdOff(resumeAt *atomic.Int64, tRes shared.TestResult) {
+	d := tRes.RetryAfter()
+	if d <= 0 {
+		return
+	}
+	until := time.Now().Add(d).UnixNano()
+	for {
+		cur := resumeAt.Load()
+		if cur >= until || resumeAt.CompareAndSwap(cur, until) {
+			return
+		}
+	}
+}
+
+// waitResume waits until resumeAt, in unix nanoseconds, and reports whether
+// the test is still on by then.
+func (s *service) waitResume(resumeAt *atomic.Int64) bool {
+	for {
+		d := time.Until(time.Unix(0, resumeAt.Load()))
+		if d <= 0 {
+			return true
+		}
+		select {
+		case <-time.After(d):
+		case <-s.testCtx.Done():
+			return false
+		}
 	}
-	wg.Wait()
-	close(s.testersDone)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
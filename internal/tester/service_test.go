@@ -0,0 +1,432 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestNewIDGen(t *testing.T) {
+	next := newIDGen("sequential")
+	if a, b := next(), next(); a != "1" || b != "2" {
+		t.Errorf("unexpected sequential ids: %s, %s", a, b)
+	}
+
+	if _, err := uuid.Parse(newIDGen("uuid")()); err != nil {
+		t.Error(err)
+	}
+
+	tp := newIDGen("traceparent")()
+	if len(tp) != 55 || !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(tp) {
+		t.Errorf("invalid traceparent: %s", tp)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"2"}},
+	}
+	if d := retryAfter(resp); d != 2*time.Second {
+		t.Errorf("unexpected backoff: %v", d)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if d := retryAfter(resp); d < 58*time.Second || d > time.Minute {
+		t.Errorf("unexpected backoff: %v", d)
+	}
+
+	resp.StatusCode = http.StatusOK
+	if d := retryAfter(resp); d != 0 {
+		t.Errorf("unexpected backoff for 200: %v", d)
+	}
+}
+
+func TestBackOffHoldsAllSlots(t *testing.T) {
+	var received atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received.Add(1) == 1 {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	params := `{"reqSchema": "http", "duration": "500ms", "pace": "6000rpm", "parallelTesters": 1, "inFlightPerTester": 4, "timeout": "1s", "respectRetryAfter": true, "requests": [{"path": "/"}]}`
+	if _, err := Run(context.Background(), strings.TrimPrefix(srv.URL, "http://"), []byte(params)); err != nil {
+		t.Fatal(err)
+	}
+	// Past the 429, only the requests already on their way are sent.
+	if n := received.Load(); n > 1+4 {
+		t.Errorf("expected the backoff to hold every slot, got %d requests", n)
+	}
+}
+
+func TestInFlightLimit(t *testing.T) {
+	var cur, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := cur.Add(1)
+		defer cur.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	params := `{"reqSchema": "http", "duration": "300ms", "pace": "6000rpm", "parallelTesters": 1, "inFlightPerTester": 3, "timeout": "1s", "requests": [{"path": "/"}]}`
+	if _, err := Run(context.Background(), strings.TrimPrefix(srv.URL, "http://"), []byte(params)); err != nil {
+		t.Fatal(err)
+	}
+	if n := peak.Load(); n < 2 || n > 3 {
+		t.Errorf("expected up to 3 requests in flight, got %d at once", n)
+	}
+}
+
+func TestWarmupRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	collector, received := testCollector(t)
+
+	s := NewService()
+	s.target = strings.TrimPrefix(srv.URL, "http://")
+	s.collectors = newCollectors([]string{strings.TrimPrefix(collector.URL, "http://")})
+	var p params
+	if err := json.Unmarshal([]byte(`{"reqSchema": "http", "duration": "300ms", "pace": "6000rpm", "parallelTesters": 2, "timeout": "1s", "warmupRequests": 3, "requests": [{"path": "/"}]}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := p.prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.status.Store(statusTesting)
+	s.startRun(context.Background(), p, schedule, newRunID(), log.With())
+	<-s.run.Load().done
+
+	// Each tester keeps its first 3 results to itself.
+	if n := s.warmups.Load(); n != 2*3 {
+		t.Errorf("expected 6 warmup requests, got %d", n)
+	}
+	sent := int64(s.requests.Load() - s.warmups.Load())
+	if n := received.Load(); n == 0 || n != sent {
+		t.Errorf("expected the collector to receive %d results, got %d", sent, n)
+	}
+	if n := s.stats.Overall().Count; int64(n) != sent {
+		t.Errorf("expected %d requests in the stats, got %d", sent, n)
+	}
+}
+
+func TestRequestHeaderPrecedence(t *testing.T) {
+	s := &service{
+		params: params{
+			UserAgent: "custom/1.0",
+			Headers: http.Header{
+				"Accept": []string{"text/plain"},
+				"X-Env":  []string{"staging"},
+			},
+		},
+	}
+
+	h := s.params.requestHeader(request{Header: http.Header{"Accept": []string{"application/json"}}})
+	if v := h.Get("Accept"); v != "application/json" {
+		t.Errorf("per-request header should override default: %s", v)
+	}
+	if v := h.Get("X-Env"); v != "staging" {
+		t.Errorf("default header missing: %s", v)
+	}
+	if v := h.Get("User-Agent"); v != "custom/1.0" {
+		t.Errorf("unexpected User-Agent: %s", v)
+	}
+
+	s.params.Headers.Set("User-Agent", "default/1.0")
+	if v := s.params.requestHeader(request{}).Get("User-Agent"); v != "default/1.0" {
+		t.Errorf("default header should override userAgent: %s", v)
+	}
+	h = s.params.requestHeader(request{Header: http.Header{"User-Agent": []string{"req/1.0"}}})
+	if v := h.Get("User-Agent"); v != "req/1.0" {
+		t.Errorf("per-request header should override User-Agent: %s", v)
+	}
+}
+
+func TestRequestTimeoutPrecedence(t *testing.T) {
+	s := &service{params: params{Timeout: shared.Duration(time.Second)}}
+	if d := s.params.requestTimeout(request{}); d != time.Second {
+		t.Errorf("expected the params timeout, got %v", d)
+	}
+	if d := s.params.requestTimeout(request{Timeout: shared.Duration(time.Minute)}); d != time.Minute {
+		t.Errorf("per-request timeout should override the params: %v", d)
+	}
+
+	var r request
+	if err := json.Unmarshal([]byte(`{"path": "/", "timeout": "-1s"}`), &r); err == nil || !strings.Contains(err.Error(), ">= 0") {
+		t.Errorf("expected a negative timeout to fail, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/", "timeout": "0s"}`), &r); err != nil {
+		t.Errorf("expected a zero timeout to keep the params timeout, got %v", err)
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	const (
+		testers = 50
+		window  = 200 * time.Millisecond
+	)
+	var (
+		mu     sync.Mutex
+		starts []time.Duration
+		begin  = time.Now()
+	)
+	rampUp(context.Background(), testers, window, func(int) {
+		mu.Lock()
+		starts = append(starts, time.Since(begin))
+		mu.Unlock()
+	})
+	if len(starts) != testers {
+		t.Fatalf("expected %d testers started, got %d", testers, len(starts))
+	}
+	// Delays taken one after the other would add up to about testers*window/2.
+	if elapsed := time.Since(begin); elapsed > 2*window {
+		t.Errorf("expected the ramp to take at most %v, took %v", 2*window, elapsed)
+	}
+	var late int
+	for _, d := range starts {
+		if d > window/2 {
+			late++
+		}
+	}
+	if late == 0 || late == testers {
+		t.Errorf("expected the starts spread across %v, got %v", window, starts)
+	}
+
+	// Testers still waiting when the run ends do not start.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var started int
+	rampUp(ctx, testers, time.Minute, func(int) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+	})
+	if started != 0 {
+		t.Errorf("expected no tester started after the run ended, got %d", started)
+	}
+}
+
+func TestServiceStatusIndefinite(t *testing.T) {
+	s := NewService()
+	s.status.Store(statusTesting)
+	s.run.Store(&runInfo{startedAt: time.Now()})
+	if st := s.serviceStatus(); st.Duration != 0 {
+		t.Errorf("expected no remaining duration, got %v", st.Duration)
+	}
+	s.run.Store(&runInfo{startedAt: time.Now(), runningUntil: time.Now().Add(time.Minute)})
+	if st := s.serviceStatus(); st.Duration <= 0 {
+		t.Errorf("expected a remaining duration, got %v", st.Duration)
+	}
+}
+
+// TestServiceStatusDuringStart polls the status while runs start and end; run
+// it with -race.
+func TestServiceStatusDuringStart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	s := NewService()
+	s.target = strings.TrimPrefix(srv.URL, "http://")
+	s.embedded = true
+
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			s.serviceStatus()
+			w := httptest.NewRecorder()
+			s.handleTest(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+		}
+	}()
+
+	for range 3 {
+		var p params
+		if err := json.Unmarshal([]byte(`{"duration": "50ms", "pace": "6000rpm", "parallelTesters": 2, "timeout": "1s", "requests": [{"path": "/"}]}`), &p); err != nil {
+			t.Fatal(err)
+		}
+		schedule, err := p.prepare()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.status.Store(statusTesting)
+		s.startRun(context.Background(), p, schedule, newRunID(), log.With())
+		<-s.run.Load().done
+	}
+	close(done)
+	<-polled
+
+	if st := s.serviceStatus(); st.Status != "ready" || st.RunID != s.run.Load().id {
+		t.Errorf("unexpected final status: %+v", st)
+	}
+}
+
+// TestServiceStartWhileStopping posts runs back to back, so each arrives while
+// the last one winds down; run it with -race.
+func TestServiceStartWhileStopping(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	s := NewService()
+	s.target = strings.TrimPrefix(srv.URL, "http://")
+	s.embedded = true
+
+	const (
+		runs = 10
+		body = `{"duration": "10ms", "pace": "6000rpm", "parallelTesters": 2, "timeout": "1s", "requests": [{"path": "/"}]}`
+	)
+	var started int
+	deadline := time.Now().Add(10 * time.Second)
+	for started < runs && time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		s.handleTest(w, httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body)))
+		switch w.Code {
+		case http.StatusOK:
+			started++
+		case http.StatusServiceUnavailable:
+		default:
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+		}
+	}
+	if started < runs {
+		t.Fatalf("expected %d runs started, got %d", runs, started)
+	}
+	<-s.run.Load().done
+
+	if st := s.serviceStatus(); st.Status != "ready" {
+		t.Errorf("unexpected final status: %+v", st)
+	}
+}
+
+func TestGetTestWithoutMethod(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	s := NewService()
+	s.target = strings.TrimPrefix(srv.URL, "http://")
+	s.embedded = true
+	w := httptest.NewRecorder()
+	s.handleTest(w, httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(
+		`{"duration": "10ms", "pace": "6000rpm", "timeout": "1s", "requests": [{"path": "/"}]}`,
+	)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	<-s.run.Load().done
+
+	w = httptest.NewRecorder()
+	s.handleTest(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"method":"GET"`) {
+		t.Errorf("expected the params with a GET request, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTerminateWait(t *testing.T) {
+	terminate := func(wait string, stops bool) (*httptest.ResponseRecorder, time.Duration) {
+		s := NewService()
+		s.embedded = true
+		s.server = &http.Server{}
+		ctx, cancel := context.WithCancel(context.Background())
+		ri := &runInfo{id: "run", cancel: cancel, done: make(chan struct{}), stats: shared.NewStats()}
+		if stops {
+			context.AfterFunc(ctx, func() { close(ri.done) })
+		}
+		s.run.Store(ri)
+
+		w := httptest.NewRecorder()
+		start := time.Now()
+		s.handleTerminateWait(w, httptest.NewRequest(http.MethodPost, "/terminate?wait="+wait, nil))
+		d := time.Since(start)
+		if w.Code == http.StatusOK {
+			<-s.terminated
+		}
+		return w, d
+	}
+
+	// The run winds down once cancelled, well before the wait is over.
+	w, d := terminate("5s", true)
+	if w.Code != http.StatusOK || d > time.Second {
+		t.Errorf("expected the status once the run stopped, got %d after %v", w.Code, d)
+	}
+	var st serviceStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil || st.RunID != "run" {
+		t.Errorf("expected the status of the run, got %s (%v)", w.Body, err)
+	}
+	// A run that does not wind down is given up on after the wait.
+	w, d = terminate("100ms", false)
+	if w.Code != http.StatusOK || d < 100*time.Millisecond || d > time.Second {
+		t.Errorf("expected the status after the wait, got %d after %v", w.Code, d)
+	}
+	for _, wait := range []string{"soon", "0s", "-1s"} {
+		if w, _ := terminate(wait, true); w.Code != http.StatusBadRequest {
+			t.Errorf("expected wait=%s rejected, got %d", wait, w.Code)
+		}
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer func(d time.Duration) { config.ShutdownTimeout = d }(config.ShutdownTimeout)
+	config.ShutdownTimeout = 100 * time.Millisecond
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	go http.Get(srv.URL)
+	<-entered
+
+	s := NewService()
+	s.server = srv.Config
+	start := time.Now()
+	s.shutdown()
+	select {
+	case <-s.terminated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the tester to shut down")
+	}
+	if d := time.Since(start); d < config.ShutdownTimeout {
+		t.Errorf("expected the tester to wait %v for the open request, shut down after %v", config.ShutdownTimeout, d)
+	}
+}
+
+func TestAchievedPace(t *testing.T) {
+	s := NewService()
+	now := time.Now()
+	ri := &runInfo{startedAt: now.Add(-time.Minute), stoppedAt: now}
+	// Beyond the range of a configured pace.
+	s.requests.Store(70000)
+	if got := s.achievedPace(ri); got != 70000 {
+		t.Errorf("expected 70000rpm, got %v", got)
+	}
+	if b, err := json.Marshal(s.achievedPace(ri)); err != nil || string(b) != `"70000rpm"` {
+		t.Errorf("unexpected marshaled pace %s, %v", b, err)
+	}
+}
@@ -0,0 +1,77 @@
+package tester
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+	"golang.org/x/time/rate"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// spike raises the pace by PaceFactor for Duration, starting At after the
+// start of the run.
+type spike struct {
+	At         shared.Duration `json:"at"`
+	Duration   shared.Duration `json:"duration"`
+	PaceFactor float64         `json:"paceFactor"`
+}
+
+// validateSpikes sorts the spikes by start and rejects invalid or overlapping
+// windows.
+func validateSpikes(spikes []spike) error {
+	sort.Slice(spikes, func(i, j int) bool { return spikes[i].At < spikes[j].At })
+	for i, sp := range spikes {
+		if sp.At < 0 || sp.Duration <= 0 {
+			return fmt.Errorf("spike %d: at must be >= 0 and duration > 0", i)
+		}
+		if sp.PaceFactor <= 0 {
+			return fmt.Errorf("spike %d: paceFactor must be > 0", i)
+		}
+		if i > 0 && spikes[i-1].At+spikes[i-1].Duration > sp.At {
+			return fmt.Errorf("spike %d overlaps the previous one", i)
+		}
+	}
+	return nil
+}
+
+// runSpikes adjusts the limiter of the testers during the spike windows and
+// restores the steady pace after each of them.
+func (s *service) runSpikes(limiter *rate.Limiter) {
+	steady := limiter.Limit()
+	startedAt := s.run.Load().startedAt
+	for _, sp := range s.params.Spikes {
+		if !s.sleepUntil(startedAt.Add(time.Duration(sp.At))) {
+			return
+		}
+		s.logger.Info(
+			"load spike started",
+			slog.Float64("paceFactor", sp.PaceFactor),
+			slog.Any("duration", sp.Duration),
+		)
+		limiter.SetLimit(steady * rate.Limit(sp.PaceFactor))
+		ok := s.sleepUntil(startedAt.Add(time.Duration(sp.At + sp.Duration)))
+		limiter.SetLimit(steady)
+		if !ok {
+			return
+		}
+		s.logger.Info("load spike ended")
+	}
+}
+
+// sleepUntil waits until t and reports false if the run ended before.
+func (s *service) sleepUntil(t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.testCtx.Done():
+		return false
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,34 @@
+package tester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestValidateSpikes(t *testing.T) {
+	sec := func(n int) shared.Duration { return shared.Duration(time.Duration(n) * time.Second) }
+
+	spikes := []spike{
+		{At: sec(60), Duration: sec(10), PaceFactor: 2},
+		{At: sec(10), Duration: sec(10), PaceFactor: 3},
+	}
+	if err := validateSpikes(spikes); err != nil {
+		t.Fatal(err)
+	}
+	if spikes[0].At != sec(10) {
+		t.Errorf("spikes not sorted: %+v", spikes)
+	}
+
+	for _, spikes := range [][]spike{
+		{{At: sec(-1), Duration: sec(10), PaceFactor: 2}},
+		{{At: sec(0), Duration: 0, PaceFactor: 2}},
+		{{At: sec(0), Duration: sec(10), PaceFactor: 0}},
+		{{At: sec(0), Duration: sec(10), PaceFactor: 2}, {At: sec(5), Duration: sec(10), PaceFactor: 2}},
+	} {
+		if err := validateSpikes(spikes); err == nil {
+			t.Errorf("expected error for %+v", spikes)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package tester
+
+////////////////////////////////////////////////////////////////////////////////
+
+// starterYAML and starterJSON are the starter params of hrtester init, with
+// and without comments. Both describe the same params.
+const (
+	starterYAML = `# Starter params for hrtester. POST them to the tester's /test endpoint with
+# Content-Type: application/yaml, or convert them to JSON.
+name: starter
+# How long the run lasts; 0s runs until stopped.
+duration: 1m
+# Requests per second (rps), minute (rpm) or hour (rph), across all testers.
+pace: 10rps
+# Concurrent testers, each with its own connections, and requests in flight
+# per tester.
+parallelTesters: 2
+inFlightPerTester: 1
+# Requests taking longer time out.
+timeout: 5s
+# Results within this latency get SLAMet true.
+latencyBudget: 500ms
+# How the testers pick requests: roundrobin, random or sequence.
+choice: roundrobin
+reqSchema: http
+reqVersion: "1.1"
+# Each request carries a generated ID in this header: uuid, sequential or
+# traceparent.
+reqIDHeader: X-Request-ID
+reqIDFormat: uuid
+# Headers of every request; requests may add or replace them.
+headers:
+  Accept: application/json
+# Statuses that count as success: codes, classes like 2xx or ranges.
+successStatuses: ["2xx"]
+# Requests sent before the measured run, left out of the results.
+warmupRequests: 0
+# How much of each response body to read: full, none or first:<bytes>.
+readBody: full
+requests:
+  - method: GET
+    path: /health
+  - method: POST
+    path: /api/items
+    header:
+      Content-Type: application/json
+    body: '{"name": "example"}'
+`
+
+	starterJSON = `{
+  "name": "starter",
+  "duration": "1m",
+  "pace": "10rps",
+  "parallelTesters": 2,
+  "inFlightPerTester": 1,
+  "timeout": "5s",
+  "latencyBudget": "500ms",
+  "choice": "roundrobin",
+  "reqSchema": "http",
+  "reqVersion": "1.1",
+  "reqIDHeader": "X-Request-ID",
+  "reqIDFormat": "uuid",
+  "headers": {
+    "Accept": "application/json"
+  },
+  "successStatuses": ["2xx"],
+  "warmupRequests": 0,
+  "readBody": "full",
+  "requests": [
+    {
+      "method": "GET",
+      "path": "/health"
+    },
+    {
+      "method": "POST",
+      "path": "/api/items",
+      "header": {
+        "Content-Type": "application/json"
+      },
+      "body": "{\"name\": \"example\"}"
+    }
+  ]
+}
+`
+)
+
+// StarterParams returns example params to start from, as commented YAML or as
+// JSON. The tester accepts both as they are.
+func StarterParams(asJSON bool) string {
+	if asJSON {
+		return starterJSON
+	}
+	return starterYAML
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,36 @@
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestStarterParams(t *testing.T) {
+	var fromJSON, fromYAML params
+	if err := decodeParams(strings.NewReader(StarterParams(true)), &fromJSON); err != nil {
+		t.Fatalf("invalid JSON starter: %v", err)
+	}
+	b, err := shared.YAMLToJSON([]byte(StarterParams(false)))
+	if err != nil {
+		t.Fatalf("invalid YAML starter: %v", err)
+	}
+	if err := decodeParams(bytes.NewReader(b), &fromYAML); err != nil {
+		t.Fatalf("invalid YAML starter: %v", err)
+	}
+	for _, p := range []*params{&fromJSON, &fromYAML} {
+		if _, err := p.prepare(); err != nil {
+			t.Fatalf("invalid starter: %v", err)
+		}
+		// The seeds are random.
+		p.Seed = nil
+	}
+	j, _ := json.Marshal(fromJSON)
+	y, _ := json.Marshal(fromYAML)
+	if !bytes.Equal(j, y) {
+		t.Errorf("expected the same starter params, got\n%s\nand\n%s", j, y)
+	}
+}
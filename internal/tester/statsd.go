@@ -0,0 +1,128 @@
+package tester
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Sinks the results of a run go to.
+const (
+	sinkCollectorHTTP = "collector-http"
+	sinkStatsdUDP     = "statsd-udp"
+)
+
+// statsdMaxPacket is the most bytes of metrics sent in one UDP packet, which
+// fits the payload of an Ethernet frame.
+const statsdMaxPacket = 1432
+
+////////////////////////////////////////////////////////////////////////////////
+
+// statsdSink sends the results as statsd metrics over UDP, several lines to a
+// packet. Delivery is fire and forget: lost packets go unnoticed.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+	buf    []byte
+	// results counts the results sent, packets and failed the packets
+	// written and those that failed to be.
+	results, packets, failed uint64
+}
+
+// add appends the metrics of res to the packet being built, sending it first
+// if they do not fit.
+func (st *statsdSink) add(res shared.TestResult) {
+	st.results++
+	st.line("requests", "1|c")
+	switch {
+	case res.TimedOut():
+		st.line("timeouts", "1|c")
+	case res.ErrorClass() != "":
+		st.line("errors", "1|c")
+	default:
+		if code := res.ResponseCode(); code != "" {
+			st.line("status."+code, "1|c")
+		}
+		if d, err := res.RoundDuration(); err == nil {
+			st.line("latency", strconv.FormatInt(d.Milliseconds(), 10)+"|ms")
+		}
+	}
+	if passed, ok := res.Passed(); ok && passed {
+		st.line("passed", "1|c")
+	}
+}
+
+// line appends the metric name with value, as "<prefix>.<name>:<value>".
+func (st *statsdSink) line(name, value string) {
+	n := len(st.prefix) + 1 + len(name) + 1 + len(value)
+	if len(st.buf) > 0 && len(st.buf)+1+n > statsdMaxPacket {
+		st.flush()
+	}
+	if len(st.buf) > 0 {
+		st.buf = append(st.buf, '\n')
+	}
+	st.buf = append(st.buf, st.prefix...)
+	st.buf = append(st.buf, '.')
+	st.buf = append(st.buf, name...)
+	st.buf = append(st.buf, ':')
+	st.buf = append(st.buf, value...)
+}
+
+// flush sends the packet built so far, if any.
+func (st *statsdSink) flush() {
+	if len(st.buf) == 0 {
+		return
+	}
+	if _, err := st.conn.Write(st.buf); err != nil {
+		st.failed++
+	} else {
+		st.packets++
+	}
+	st.buf = st.buf[:0]
+}
+
+// statsdResults sends the results to the statsd server instead of the
+// collectors. Results outside the measurement window are left out, as in the
+// run stats. A packet goes out whenever the results buffer runs empty, so
+// metrics do not lag behind a slow run.
+func (s *service) statsdResults() {
+	conn, err := net.Dial("udp", config.Tester.StatsdAddr)
+	if err != nil {
+		s.logger.Error("failed to open statsd socket", err, slog.String("statsd", config.Tester.StatsdAddr))
+		for range s.results {
+		}
+		return
+	}
+	defer conn.Close()
+
+	st := &statsdSink{
+		conn:   conn,
+		prefix: config.Tester.StatsdPrefix,
+		buf:    make([]byte, 0, statsdMaxPacket),
+	}
+	for res := range s.results {
+		s.checkSaturation()
+		if measured, ok := res.Measured(); ok && !measured {
+			continue
+		}
+		st.add(res)
+		if len(s.results) == 0 {
+			st.flush()
+		}
+	}
+	st.flush()
+	s.logger.Info(
+		"results delivered to statsd",
+		slog.String("statsd", config.Tester.StatsdAddr),
+		slog.Uint64("results", st.results),
+		slog.Uint64("packets", st.packets),
+		slog.Uint64("failed", st.failed),
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,105 @@
+package tester
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/config"
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+func TestStatsdResults(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	defer func(sink, addr, prefix string) {
+		config.Tester.Sink, config.Tester.StatsdAddr, config.Tester.StatsdPrefix = sink, addr, prefix
+	}(config.Tester.Sink, config.Tester.StatsdAddr, config.Tester.StatsdPrefix)
+	config.Tester.Sink = sinkStatsdUDP
+	config.Tester.StatsdAddr = pc.LocalAddr().String()
+	config.Tester.StatsdPrefix = "ht"
+
+	var ok, timedOut, unmeasured shared.TestResult
+	ok.SetResponseCode(200)
+	ok.SetRoundDuration(shared.Duration(42 * time.Millisecond))
+	ok.SetPassed(true)
+	timedOut.SetTimedOut(true)
+	timedOut.SetErrorClass(errClassTimeout)
+	unmeasured.SetResponseCode(500)
+	unmeasured.SetMeasured(false)
+
+	s := &service{logger: log.With(), results: make(chan shared.TestResult, 3)}
+	s.results <- ok
+	s.results <- timedOut
+	s.results <- unmeasured
+	close(s.results)
+	s.sendResults()
+
+	// The results were buffered, so they go out in a single packet.
+	buf := make([]byte, statsdMaxPacket)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ht.requests:1|c",
+		"ht.status.200:1|c",
+		"ht.latency:42|ms",
+		"ht.passed:1|c",
+		"ht.requests:1|c",
+		"ht.timeouts:1|c",
+	}
+	if got := strings.Split(string(buf[:n]), "\n"); !slices.Equal(got, want) {
+		t.Errorf("expected metrics %q, got %q", want, got)
+	}
+}
+
+func TestStatsdPackets(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	var packets []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 2*statsdMaxPacket)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}()
+
+	st := &statsdSink{conn: client, prefix: "hrtester"}
+	var res shared.TestResult
+	res.SetResponseCode(204)
+	for range 100 {
+		st.add(res)
+	}
+	st.flush()
+	client.Close()
+	<-done
+
+	if len(packets) < 2 {
+		t.Fatalf("expected the metrics split across packets, got %d", len(packets))
+	}
+	var lines int
+	for _, p := range packets {
+		if len(p) > statsdMaxPacket {
+			t.Errorf("packet of %d bytes exceeds %d", len(p), statsdMaxPacket)
+		}
+		lines += strings.Count(p, "\n") + 1
+	}
+	if lines != 200 {
+		t.Errorf("expected 200 metrics, got %d", lines)
+	}
+}
@@ -0,0 +1,146 @@
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// statusRange is an inclusive range of response status codes.
+type statusRange struct {
+	lo, hi int
+}
+
+func (sr statusRange) String() string {
+	switch {
+	case sr.lo == sr.hi:
+		return strconv.Itoa(sr.lo)
+	case sr.lo%100 == 0 && sr.hi == sr.lo+99:
+		return strconv.Itoa(sr.lo/100) + "xx"
+	default:
+		return fmt.Sprintf("%d-%d", sr.lo, sr.hi)
+	}
+}
+
+// parseStatusRange parses a status code ("204"), a class ("2xx") or a range
+// ("200-299").
+func parseStatusRange(s string) (statusRange, error) {
+	invalid := fmt.Errorf(
+		"invalid status '%s': must be a code, a class like '2xx' or a range like '200-299'",
+		s,
+	)
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		c := int(s[0] - '0')
+		if c < 1 || c > 5 {
+			return statusRange{}, invalid
+		}
+		return statusRange{c * 100, c*100 + 99}, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	l, err := strconv.Atoi(lo)
+	if err != nil {
+		return statusRange{}, invalid
+	}
+	h := l
+	if isRange {
+		if h, err = strconv.Atoi(hi); err != nil {
+			return statusRange{}, invalid
+		}
+	}
+	if l < 100 || h > 599 || l > h {
+		return statusRange{}, invalid
+	}
+	return statusRange{l, h}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// successStatuses lists the response status codes that count as success. An
+// empty list means 2xx.
+type successStatuses []statusRange
+
+func (ss successStatuses) MarshalJSON() ([]byte, error) {
+	strs := make([]string, len(ss))
+	for i, sr := range ss {
+		strs[i] = sr.String()
+	}
+	return json.Marshal(strs)
+}
+
+func (ss *successStatuses) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return fmt.Errorf("invalid JSON array: %v", err)
+	}
+	*ss = make(successStatuses, len(raws))
+	for i, raw := range raws {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			// Plain status codes may be given as numbers.
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return fmt.Errorf("invalid status at index %d: must be a number or a string", i)
+			}
+			s = strconv.Itoa(n)
+		}
+		sr, err := parseStatusRange(s)
+		if err != nil {
+			return err
+		}
+		(*ss)[i] = sr
+	}
+	return nil
+}
+
+func (ss successStatuses) match(code int) bool {
+	if len(ss) == 0 {
+		return code >= 200 && code <= 299
+	}
+	for _, sr := range ss {
+		if code >= sr.lo && code <= sr.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// judge records whether the request succeeded: it got a response with one of
+// the success statuses and did not fail or time out otherwise. It also records
+// whether the result of r, with the given start of its body, passed its
+// criteria and whether it was sent within the measurement window, counts the
+// failed and timed out requests, and adds the result to the run stats.
+func (s *service) judge(tRes *shared.TestResult, r request, body []byte) bool {
+	if s.measured != nil {
+		t, _ := tRes.RequestTime()
+		tRes.SetMeasured(s.measured.contains(t))
+	}
+	ok := false
+	switch tRes.ErrorClass() {
+	case "":
+		// A dial-only round succeeds once its connection is established.
+		if s.params.DialOnly {
+			ok = true
+		} else if code, err := strconv.Atoi(tRes.ResponseCode()); err == nil {
+			ok = s.params.SuccessStatuses.match(code)
+		}
+	case errClassTimeout:
+		s.timeouts.Add(1)
+	default:
+		s.errored.Add(1)
+	}
+	tRes.SetSuccess(ok)
+	tRes.SetPassed(s.passed(*tRes, r, body))
+	if !ok {
+		s.failures.Add(1)
+	}
+	s.checkErrorRate(ok)
+	s.stats.Add(*tRes)
+	return ok
+}
+
+////////////////////////////////////////////////////////////////////////////////
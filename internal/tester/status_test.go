@@ -0,0 +1,32 @@
+package tester
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSuccessStatuses(t *testing.T) {
+	var ss successStatuses
+	if !ss.match(204) || ss.match(301) {
+		t.Error("expected 2xx by default")
+	}
+
+	if err := json.Unmarshal([]byte(`[200, "3xx", "404-410"]`), &ss); err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[int]bool{200: true, 201: false, 302: true, 404: true, 410: true, 500: false} {
+		if ss.match(code) != want {
+			t.Errorf("match(%d): expected %v", code, want)
+		}
+	}
+	b, err := json.Marshal(ss)
+	if err != nil || string(b) != `["200","3xx","404-410"]` {
+		t.Errorf("unexpected marshaled statuses: %s, %v", b, err)
+	}
+
+	for _, raw := range []string{`["6xx"]`, `["410-404"]`, `[99]`, `["ok"]`, `[true]`} {
+		if err := json.Unmarshal([]byte(raw), &ss); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
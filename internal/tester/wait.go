@@ -0,0 +1,69 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// waitFirstBackoff is the pause after the first failed connection to the
+	// target; each further one doubles it, up to waitMaxBackoff.
+	waitFirstBackoff = 100 * time.Millisecond
+	waitMaxBackoff   = 5 * time.Second
+	// waitDialTimeout bounds each connection attempt.
+	waitDialTimeout = 2 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// waitForTarget connects to the target until it accepts a connection, backing
+// off between attempts, and gives up after timeout. It returns the last
+// connection error if the target never came up.
+func (s *service) waitForTarget(ctx context.Context, timeout time.Duration, logger *log.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		dialer  net.Dialer
+		start   = time.Now()
+		backoff = waitFirstBackoff
+	)
+	for attempt := 1; ; attempt++ {
+		dialCtx, dialCancel := context.WithTimeout(ctx, waitDialTimeout)
+		conn, err := dialer.DialContext(dialCtx, "tcp", s.target)
+		dialCancel()
+		if err == nil {
+			conn.Close()
+			if attempt > 1 {
+				logger.Info(
+					"target is up",
+					slog.Int("attempts", attempt),
+					slog.Any("waited", shared.Duration(time.Since(start))),
+				)
+			}
+			return nil
+		}
+		logger.Warn(
+			"target is unreachable, retrying",
+			slog.Int("attempt", attempt),
+			slog.Any("backoff", shared.Duration(backoff)),
+			slog.Any("err", err),
+		)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s after %d attempts in %v: %v", s.target, attempt, timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, waitMaxBackoff)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,90 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozla/hrtester/internal/log"
+)
+
+func TestWaitForTarget(t *testing.T) {
+	// Reserve a port, then free it until the target comes up.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := &service{target: addr}
+	if err := s.waitForTarget(context.Background(), 300*time.Millisecond, log.With()); err == nil {
+		t.Fatal("expected an error while the target is down")
+	}
+
+	up := make(chan net.Listener, 1)
+	time.AfterFunc(250*time.Millisecond, func() {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+		}
+		up <- ln
+	})
+	err = s.waitForTarget(context.Background(), 5*time.Second, log.With())
+	if ln := <-up; ln != nil {
+		ln.Close()
+	}
+	if err != nil {
+		t.Errorf("expected the target to come up, got %v", err)
+	}
+}
+
+func TestTerminateCancelsWait(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := NewService()
+	s.target = addr
+	s.embedded = true
+	s.server = &http.Server{}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		s.handleTest(w, httptest.NewRequest(
+			http.MethodPost,
+			"/test",
+			strings.NewReader(`{"duration": "1s", "waitForTarget": "1m", "requests": [{"path": "/"}]}`),
+		))
+		done <- w
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.serviceStatus().Status != "waiting" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the service to report waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.shutdown()
+	select {
+	case w := <-done:
+		if w.Code == http.StatusOK {
+			t.Errorf("expected the start to fail, got %d", w.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected terminate to cancel the wait")
+	}
+	if st := s.serviceStatus(); st.Status != "ready" || s.run.Load() != nil {
+		t.Errorf("expected no run started, got %+v", st)
+	}
+	<-s.terminated
+}
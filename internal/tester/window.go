@@ -0,0 +1,109 @@
+package tester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// windowEdge is a part of the run at its start or end, given as a duration
+// ("30s") or as a share of the run duration ("10%").
+type windowEdge struct {
+	d   time.Duration
+	pct float64
+}
+
+func (e windowEdge) MarshalJSON() ([]byte, error) {
+	if e.pct > 0 {
+		return json.Marshal(strconv.FormatFloat(e.pct, 'f', -1, 64) + "%")
+	}
+	return json.Marshal(shared.Duration(e.d))
+}
+
+func (e *windowEdge) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid JSON string: %v", err)
+	}
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		pct, err := strconv.ParseFloat(v, 64)
+		if err != nil || pct < 0 || pct >= 100 {
+			return fmt.Errorf("invalid share '%s': must be in [0%%, 100%%)", s)
+		}
+		*e = windowEdge{pct: pct}
+		return nil
+	}
+	var d shared.Duration
+	if err := d.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if d < 0 {
+		return errors.New("invalid duration: must be >= 0")
+	}
+	*e = windowEdge{d: time.Duration(d)}
+	return nil
+}
+
+// of returns the length of e in a run of the given duration.
+func (e windowEdge) of(duration time.Duration) time.Duration {
+	if e.pct > 0 {
+		return time.Duration(float64(duration) * e.pct / 100)
+	}
+	return e.d
+}
+
+func (e windowEdge) isZero() bool {
+	return e.d == 0 && e.pct == 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// measurementWindow leaves the start and the end of a run, where the testers
+// spin up and wind down, out of its stats.
+type measurementWindow struct {
+	SkipStart windowEdge `json:"skipStart"`
+	SkipEnd   windowEdge `json:"skipEnd"`
+}
+
+// validate checks w against the duration of the run, 0 if it has none.
+func (w *measurementWindow) validate(duration time.Duration) error {
+	if duration == 0 && (!w.SkipEnd.isZero() || w.SkipStart.pct > 0) {
+		return errors.New("skipEnd and shares of the run require a duration")
+	}
+	if duration > 0 && w.SkipStart.of(duration)+w.SkipEnd.of(duration) >= duration {
+		return errors.New("skipStart and skipEnd leave nothing to measure")
+	}
+	return nil
+}
+
+// bounds returns the measured part of a run from startedAt until
+// runningUntil, which is zero for runs without a duration.
+func (w *measurementWindow) bounds(startedAt, runningUntil time.Time) *timeWindow {
+	tw := &timeWindow{}
+	if runningUntil.IsZero() {
+		tw.from = startedAt.Add(w.SkipStart.d)
+		return tw
+	}
+	duration := runningUntil.Sub(startedAt)
+	tw.from = startedAt.Add(w.SkipStart.of(duration))
+	tw.to = runningUntil.Add(-w.SkipEnd.of(duration))
+	return tw
+}
+
+// timeWindow spans from from until to, or on if to is zero.
+type timeWindow struct {
+	from, to time.Time
+}
+
+func (tw *timeWindow) contains(t time.Time) bool {
+	return !t.Before(tw.from) && (tw.to.IsZero() || t.Before(tw.to))
+}
+
+////////////////////////////////////////////////////////////////////////////////
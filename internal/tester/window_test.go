@@ -0,0 +1,63 @@
+package tester
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMeasurementWindow(t *testing.T) {
+	var w measurementWindow
+	if err := json.Unmarshal([]byte(`{"skipStart": "10%", "skipEnd": "5s"}`), &w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.validate(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	tw := w.bounds(start, start.Add(time.Minute))
+	for offset, want := range map[time.Duration]bool{
+		0:                       false,
+		5999 * time.Millisecond: false,
+		6 * time.Second:         true,
+		54 * time.Second:        true,
+		55 * time.Second:        false,
+	} {
+		if got := tw.contains(start.Add(offset)); got != want {
+			t.Errorf("at %v: expected %v, got %v", offset, want, got)
+		}
+	}
+	if b, err := json.Marshal(w); err != nil || string(b) != `{"skipStart":"10%","skipEnd":"5000ms"}` {
+		t.Errorf("unexpected marshaled window: %s, %v", b, err)
+	}
+
+	// Runs without a duration skip their start only.
+	w = measurementWindow{SkipStart: windowEdge{d: 10 * time.Second}}
+	if err := w.validate(0); err != nil {
+		t.Fatal(err)
+	}
+	if tw := w.bounds(start, time.Time{}); tw.contains(start.Add(9*time.Second)) || !tw.contains(start.Add(time.Hour)) {
+		t.Errorf("unexpected window of a run without a duration: %+v", tw)
+	}
+
+	for _, c := range []struct {
+		raw      string
+		duration time.Duration
+	}{
+		{`{"skipStart": "10%"}`, 0},
+		{`{"skipEnd": "10s"}`, 0},
+		{`{"skipStart": "30s", "skipEnd": "30s"}`, time.Minute},
+		{`{"skipStart": "100%"}`, time.Minute},
+		{`{"skipStart": "-1s"}`, time.Minute},
+		{`{"skipStart": "ten%"}`, time.Minute},
+	} {
+		var w measurementWindow
+		err := json.Unmarshal([]byte(c.raw), &w)
+		if err == nil {
+			err = w.validate(c.duration)
+		}
+		if err == nil {
+			t.Errorf("expected error for %s over %v", c.raw, c.duration)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package hrtester runs hrtester load tests in-process, so Go programs and
+// test suites can drive them without running the tester, mock and collector
+// services.
+package hrtester
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ozla/hrtester/internal/shared"
+	"github.com/ozla/hrtester/internal/tester"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Results holds the aggregated results of a run.
+type Results = tester.Summary
+
+// LatencySummary summarizes the round durations of a run.
+type LatencySummary = tester.LatencySummary
+
+// Stats holds the stats of a run per test name and per path. It marshals to
+// the JSON of the tester's stats endpoint and of hrtester report --json.
+type Stats = shared.Stats
+
+// GroupStats holds the stats of a group of requests.
+type GroupStats = shared.GroupStats
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Params describes a test run. The fields mirror the JSON params of the
+// tester's /test endpoint; zero values take the same defaults.
+type Params struct {
+	// Target is the host:port requests are sent to.
+	Target string
+	// Scheme is "http" (default) or "https".
+	Scheme string
+	Name   string
+	// Duration is the length of the run; zero runs until ctx is cancelled.
+	Duration time.Duration
+	// Pace is the request rate, e.g. "10rps", "600rpm" or "60rph".
+	Pace              string
+	ParallelTesters   uint8
+	InFlightPerTester uint8
+	Timeout           time.Duration
+	// Choice is "roundrobin" (default), "random" or "sequence".
+	Choice          string
+	Seed            *uint64
+	UserAgent       string
+	Headers         http.Header
+	SuccessStatuses []string
+	// AbortOnErrorRate ends the run early once the share of failed requests
+	// exceeds it. 0 disables it.
+	AbortOnErrorRate float64
+	Requests         []Request
+	// Extra holds further params by their JSON name, e.g. "readBody" or
+	// "spikes", with the values as the JSON params take them.
+	Extra map[string]any
+}
+
+// Request is a request the testers send.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Query  url.Values
+	Body   string
+}
+
+// RunTest runs the test described by p and returns its aggregated results
+// once the run is over. Cancelling ctx ends the run early; the results then
+// cover the requests sent so far and the error is ctx.Err().
+func RunTest(ctx context.Context, p Params) (Results, error) {
+	if p.Target == "" {
+		return Results{}, errors.New("invalid target: must be set")
+	}
+	b, err := json.Marshal(p.jsonParams())
+	if err != nil {
+		return Results{}, fmt.Errorf("malformed params: %v", err)
+	}
+	return tester.Run(ctx, p.Target, b)
+}
+
+// jsonParams returns p as the JSON params of the tester, leaving out unset
+// fields.
+func (p Params) jsonParams() map[string]any {
+	m := make(map[string]any, len(p.Extra)+16)
+	for k, v := range p.Extra {
+		m[k] = v
+	}
+	set := func(k string, v any, ok bool) {
+		if ok {
+			m[k] = v
+		}
+	}
+	set("reqSchema", p.Scheme, p.Scheme != "")
+	set("name", p.Name, p.Name != "")
+	set("duration", duration(p.Duration), p.Duration != 0)
+	set("pace", p.Pace, p.Pace != "")
+	set("parallelTesters", p.ParallelTesters, p.ParallelTesters != 0)
+	set("inFlightPerTester", p.InFlightPerTester, p.InFlightPerTester != 0)
+	set("timeout", duration(p.Timeout), p.Timeout != 0)
+	set("choice", p.Choice, p.Choice != "")
+	set("seed", p.Seed, p.Seed != nil)
+	set("userAgent", p.UserAgent, p.UserAgent != "")
+	set("headers", p.Headers, p.Headers != nil)
+	set("successStatuses", p.SuccessStatuses, p.SuccessStatuses != nil)
+	set("abortOnErrorRate", p.AbortOnErrorRate, p.AbortOnErrorRate != 0)
+	if p.Requests != nil {
+		reqs := make([]map[string]any, len(p.Requests))
+		for i, r := range p.Requests {
+			req := map[string]any{"path": r.Path}
+			set := func(k string, v any, ok bool) {
+				if ok {
+					req[k] = v
+				}
+			}
+			set("method", r.Method, r.Method != "")
+			set("header", r.Header, r.Header != nil)
+			set("query", r.Query, r.Query != nil)
+			set("body", r.Body, r.Body != "")
+			reqs[i] = req
+		}
+		m["requests"] = reqs
+	}
+	return m
+}
+
+// duration formats d the way the JSON params take durations.
+func duration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+////////////////////////////////////////////////////////////////////////////////
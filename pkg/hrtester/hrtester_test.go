@@ -0,0 +1,59 @@
+package hrtester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	res, err := RunTest(context.Background(), Params{
+		Target:          strings.TrimPrefix(srv.URL, "http://"),
+		Name:            "embedded",
+		Duration:        500 * time.Millisecond,
+		Pace:            "40rps",
+		ParallelTesters: 2,
+		Timeout:         time.Second,
+		Requests: []Request{
+			{Path: "/ok"},
+			{Path: "/missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "embedded" || res.Requests == 0 {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+	if got := res.StatusCodes[200] + res.StatusCodes[404]; got != res.Requests {
+		t.Errorf("expected %d responses, got %v", res.Requests, res.StatusCodes)
+	}
+	if res.Failures != res.StatusCodes[404] {
+		t.Errorf("expected the 404s to fail, got %d failures", res.Failures)
+	}
+	if res.Passed != res.StatusCodes[200] || res.PassRate != float64(res.Passed)/float64(res.Requests) {
+		t.Errorf("expected the 200s to pass, got %d passed, rate %v", res.Passed, res.PassRate)
+	}
+	if res.Latency.Min > res.Latency.P50 || res.Latency.P50 > res.Latency.Max {
+		t.Errorf("inconsistent latency summary: %+v", res.Latency)
+	}
+	if st := res.Stats.ByPath()["/missing"]; st.StatusCodes[404] != res.StatusCodes[404] {
+		t.Errorf("expected the 404s in the stats of /missing, got %+v", st)
+	}
+
+	if _, err := RunTest(context.Background(), Params{Target: "localhost:1"}); err == nil {
+		t.Error("expected params without requests to fail")
+	}
+}